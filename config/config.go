@@ -1,12 +1,47 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/spf13/viper"
 )
 
+// envFileCandidates lists where LoadEnv looks for a .env file, in order:
+// ENV_FILE if set, the working directory, then its parent so tests run from
+// a package directory still find the repository's file
+func envFileCandidates() []string {
+	candidates := []string{".env", filepath.Join("..", ".env")}
+	if path := os.Getenv("ENV_FILE"); path != "" {
+		candidates = append([]string{path}, candidates...)
+	}
+	return candidates
+}
+
+// LoadEnv makes environment variables visible to viper and reads the first
+// .env file found, returning its path or "" if there is none. Real
+// environment variables take precedence over values from the file.
+func LoadEnv() string {
+	viper.AutomaticEnv()
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	for _, path := range envFileCandidates() {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		viper.SetConfigFile(path)
+		viper.SetConfigType("env")
+		_ = viper.ReadInConfig()
+		return path
+	}
+	return ""
+}
+
 func GetPort() string {
 	port := viper.GetString("PORT")
 	if port == "" {
@@ -15,6 +50,204 @@ func GetPort() string {
 	return ":" + port
 }
 
+// GetLowStockThreshold returns the default stock level at or below which a product needs restocking
+func GetLowStockThreshold() int {
+	threshold := viper.GetInt("LOW_STOCK_THRESHOLD")
+	if threshold <= 0 {
+		threshold = 10
+	}
+	return threshold
+}
+
+// GetCORSMaxAge returns how long, in seconds, browsers may cache CORS preflight responses
+func GetCORSMaxAge() int {
+	if !viper.IsSet("CORS_MAX_AGE") {
+		return 600
+	}
+	return viper.GetInt("CORS_MAX_AGE")
+}
+
+// AllowNullPrice reports whether products may be stored without a price (NULL)
+// instead of defaulting to 0
+func AllowNullPrice() bool {
+	return viper.GetBool("ALLOW_NULL_PRICE")
+}
+
+// IsStrictContentLength reports whether request bodies must match their declared
+// Content-Length exactly. Off by default to avoid false positives with proxies.
+func IsStrictContentLength() bool {
+	return viper.GetBool("STRICT_CONTENT_LENGTH")
+}
+
+// GetSearchMaxResults returns the most rows an unpaginated search returns
+func GetSearchMaxResults() int {
+	max := viper.GetInt("SEARCH_MAX_RESULTS")
+	if max <= 0 {
+		max = 50
+	}
+	return max
+}
+
+// GetJSONIndent returns how many spaces JSON responses are indented with;
+// 0 (the default) keeps them compact
+func GetJSONIndent() int {
+	indent := viper.GetInt("JSON_INDENT")
+	if indent < 0 {
+		indent = 0
+	}
+	return indent
+}
+
+// IsOpaqueIDFormat reports whether ids are exposed as opaque strings
+// (ID_FORMAT=opaque) instead of integers
+func IsOpaqueIDFormat() bool {
+	return strings.EqualFold(viper.GetString("ID_FORMAT"), "opaque")
+}
+
+// IsProblemErrorFormat reports whether error responses use RFC 7807
+// application/problem+json (ERROR_FORMAT=problem) instead of the JSON envelope
+func IsProblemErrorFormat() bool {
+	return strings.EqualFold(viper.GetString("ERROR_FORMAT"), "problem")
+}
+
+// GetMaxConcurrent returns the maximum number of requests served at once
+func GetMaxConcurrent() int {
+	max := viper.GetInt("MAX_CONCURRENT")
+	if max <= 0 {
+		max = 100
+	}
+	return max
+}
+
+// GetRateLimitPerMinute returns how many requests a client IP may make per
+// minute, from RATE_LIMIT_PER_MINUTE (default 60). Zero or less disables
+// rate limiting.
+func GetRateLimitPerMinute() int {
+	if !viper.IsSet("RATE_LIMIT_PER_MINUTE") {
+		return 60
+	}
+	return viper.GetInt("RATE_LIMIT_PER_MINUTE")
+}
+
+// TrustProxyHeaders reports whether X-Forwarded-For identifies the client.
+// TRUST_PROXY defaults to false, since a client connecting directly could
+// forge the header, except on Railway, detected by the
+// RAILWAY_ENVIRONMENT_NAME variable it sets on every deployment, whose proxy
+// always sets it.
+func TrustProxyHeaders() bool {
+	if !viper.IsSet("TRUST_PROXY") {
+		return viper.GetString("RAILWAY_ENVIRONMENT_NAME") != ""
+	}
+	return viper.GetBool("TRUST_PROXY")
+}
+
+// GetGzipMinSize returns the response size in bytes from which gzip
+// compression is applied, from GZIP_MIN_BYTES (default 1024)
+func GetGzipMinSize() int {
+	size := viper.GetInt("GZIP_MIN_BYTES")
+	if size <= 0 {
+		size = 1024
+	}
+	return size
+}
+
+// GetSlowRequestThreshold returns the latency at or above which a request is
+// logged as slow
+func GetSlowRequestThreshold() time.Duration {
+	ms := viper.GetInt("SLOW_REQUEST_MS")
+	if ms <= 0 {
+		ms = 1000
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// GetDBQueryTimeout returns how long a single repository call may run.
+// DB_QUERY_TIMEOUT takes a Go duration such as "5s" or "750ms"; it defaults
+// to 5 seconds when unset or invalid.
+func GetDBQueryTimeout() time.Duration {
+	timeout, err := time.ParseDuration(viper.GetString("DB_QUERY_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return timeout
+}
+
+// GetDBConnectAttempts returns how many times startup tries to connect to the
+// database, from DB_CONNECT_ATTEMPTS (default 5)
+func GetDBConnectAttempts() int {
+	attempts := viper.GetInt("DB_CONNECT_ATTEMPTS")
+	if attempts <= 0 {
+		attempts = 5
+	}
+	return attempts
+}
+
+// GetDBConnectBackoff returns the wait before the second connection attempt;
+// it doubles after each further failure. DB_CONNECT_BACKOFF takes a Go
+// duration and defaults to 1 second when unset or invalid.
+func GetDBConnectBackoff() time.Duration {
+	backoff, err := time.ParseDuration(viper.GetString("DB_CONNECT_BACKOFF"))
+	if err != nil || backoff <= 0 {
+		backoff = time.Second
+	}
+	return backoff
+}
+
+// GetMetricsRefreshInterval returns how often the catalog gauges on /metrics
+// are recounted. METRICS_REFRESH_INTERVAL takes a Go duration and defaults to
+// 30 seconds when unset or invalid.
+func GetMetricsRefreshInterval() time.Duration {
+	interval, err := time.ParseDuration(viper.GetString("METRICS_REFRESH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return interval
+}
+
+// maxPriceScale is the largest accepted PRICE_SCALE
+const maxPriceScale = 6
+
+// GetMaxPrice returns the highest price a product may have. MAX_PRICE
+// defaults to 99999999.99; zero or negative values fall back to it.
+func GetMaxPrice() float64 {
+	max := viper.GetFloat64("MAX_PRICE")
+	if max <= 0 {
+		max = 99999999.99
+	}
+	return max
+}
+
+// GetPriceScale returns how many decimal places prices are stored and
+// rendered with. PRICE_SCALE defaults to 2 and is clamped to 0-6.
+func GetPriceScale() int {
+	if !viper.IsSet("PRICE_SCALE") {
+		return 2
+	}
+	return min(max(viper.GetInt("PRICE_SCALE"), 0), maxPriceScale)
+}
+
+// GetAppVersion returns the version reported by GET /, from APP_VERSION
+func GetAppVersion() string {
+	version := viper.GetString("APP_VERSION")
+	if version == "" {
+		version = "dev"
+	}
+	return version
+}
+
+// GetDatabaseSSLMode returns the sslmode for a connection string built from
+// the PG* variables, from PGSSLMODE (default "disable"). Managed Postgres
+// usually needs "require" or "verify-full".
+func GetDatabaseSSLMode() string {
+	mode := viper.GetString("PGSSLMODE")
+	if mode == "" {
+		mode = "disable"
+	}
+	return mode
+}
+
+// GetDatabaseURL returns DATABASE_URL as is, or else a URL built from the PG*
+// variables
 func GetDatabaseURL() string {
 	// First try DATABASE_URL (Railway's default)
 	dbURL := viper.GetString("DATABASE_URL")
@@ -34,9 +267,33 @@ func GetDatabaseURL() string {
 		if port == "" {
 			port = "5432"
 		}
-		return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-			user, password, host, port, database)
+		return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+			user, password, host, port, database, GetDatabaseSSLMode())
 	}
 
 	return ""
 }
+
+// ValidateDatabaseURL checks that url is a usable connection string before
+// anything tries to connect with it, so misconfiguration fails with a clear
+// message
+func ValidateDatabaseURL(url string) error {
+	if url == "" {
+		return errors.New("database URL is empty: set DATABASE_URL, or PGHOST, PGUSER and PGDATABASE")
+	}
+	if _, err := pgx.ParseConfig(url); err != nil {
+		return fmt.Errorf("invalid database URL: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKey returns the key required on write requests, from API_KEY. Empty
+// (the default) leaves writes unauthenticated.
+func GetAPIKey() string {
+	return viper.GetString("API_KEY")
+}
+
+// IsSelfTestEnabled reports whether the startup CRUD self-test should run
+func IsSelfTestEnabled() bool {
+	return viper.GetBool("SELF_TEST")
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"errors"
 	"log"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var ErrEmptyConnectionString = errors.New("DATABASE_URL environment variable is empty")
 
-func InitDB(connectionString string) (*pgx.Conn, error) {
+// InitDB opens a connection pool. A single pgx connection is not safe for
+// concurrent use, so every request borrows its own connection from the pool.
+func InitDB(connectionString string) (*pgxpool.Pool, error) {
 	// Check if connection string is provided
 	if connectionString == "" {
 		log.Println("ERROR: DATABASE_URL is empty or not set")
@@ -20,7 +25,7 @@ func InitDB(connectionString string) (*pgx.Conn, error) {
 	log.Printf("Connecting to database...")
 
 	// Parse connection config
-	config, err := pgx.ParseConfig(connectionString)
+	config, err := pgxpool.ParseConfig(connectionString)
 	if err != nil {
 		log.Printf("ERROR: Failed to parse connection string: %v", err)
 		return nil, err
@@ -28,10 +33,10 @@ func InitDB(connectionString string) (*pgx.Conn, error) {
 
 	// Disable prepared statement cache for compatibility with connection poolers
 	// (PgBouncer, Supabase, Railway, etc.)
-	config.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
 
 	// Open database
-	db, err := pgx.ConnectConfig(context.Background(), config)
+	db, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		log.Printf("ERROR: Failed to connect to database: %v", err)
 		return nil, err
@@ -41,6 +46,7 @@ func InitDB(connectionString string) (*pgx.Conn, error) {
 	err = db.Ping(context.Background())
 	if err != nil {
 		log.Printf("ERROR: Failed to ping database: %v", err)
+		db.Close()
 		return nil, err
 	}
 
@@ -48,6 +54,7 @@ func InitDB(connectionString string) (*pgx.Conn, error) {
 	var version string
 	if err := db.QueryRow(context.Background(), "SELECT version()").Scan(&version); err != nil {
 		log.Printf("ERROR: Query failed: %v", err)
+		db.Close()
 		return nil, err
 	}
 
@@ -55,3 +62,44 @@ func InitDB(connectionString string) (*pgx.Conn, error) {
 	log.Println("Database connected successfully")
 	return db, nil
 }
+
+// InitDBWithRetry calls InitDB up to attempts times, waiting backoff after the
+// first failure and doubling the wait after each one after that. It is meant
+// for startup, where the database may still be coming up. A missing or
+// malformed connection string fails immediately.
+func InitDBWithRetry(connectionString string, attempts int, backoff time.Duration) (*pgxpool.Pool, error) {
+	connect := func() (*pgxpool.Pool, error) {
+		return InitDB(connectionString)
+	}
+	return connectWithRetry(connect, attempts, backoff, time.Sleep)
+}
+
+// connectWithRetry runs connect until it succeeds or attempts are used up,
+// returning the last error
+func connectWithRetry(connect func() (*pgxpool.Pool, error), attempts int, backoff time.Duration, sleep func(time.Duration)) (*pgxpool.Pool, error) {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		log.Printf("Database connection attempt %d/%d", attempt, attempts)
+
+		var db *pgxpool.Pool
+		db, err = connect()
+		if err == nil {
+			return db, nil
+		}
+		if permanentConnectError(err) || attempt == attempts {
+			break
+		}
+
+		log.Printf("Retrying database connection in %s", backoff)
+		sleep(backoff)
+		backoff *= 2
+	}
+	return nil, err
+}
+
+// permanentConnectError reports whether retrying cannot help, because the
+// connection string itself is missing or invalid
+func permanentConnectError(err error) bool {
+	var parseErr *pgconn.ParseConfigError
+	return errors.Is(err, ErrEmptyConnectionString) || errors.As(err, &parseErr)
+}
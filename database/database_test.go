@@ -0,0 +1,61 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestConnectWithRetry tests the number of attempts and the doubling backoff
+// between them
+func TestConnectWithRetry(t *testing.T) {
+	errRefused := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		failures  int
+		connErr   error
+		attempts  int
+		wantCalls int
+		wantSleep []time.Duration
+		wantErr   error
+	}{
+		{"exhausts attempts", 10, errRefused, 4, 4, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, errRefused},
+		{"succeeds after failures", 2, errRefused, 5, 3, []time.Duration{time.Second, 2 * time.Second}, nil},
+		{"first attempt succeeds", 0, errRefused, 5, 1, nil, nil},
+		{"empty url is not retried", 10, ErrEmptyConnectionString, 5, 1, nil, ErrEmptyConnectionString},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			connect := func() (*pgxpool.Pool, error) {
+				calls++
+				if calls <= tt.failures {
+					return nil, tt.connErr
+				}
+				return &pgxpool.Pool{}, nil
+			}
+			var slept []time.Duration
+			sleep := func(d time.Duration) { slept = append(slept, d) }
+
+			db, err := connectWithRetry(connect, tt.attempts, time.Second, sleep)
+
+			if err != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if (db == nil) != (tt.wantErr != nil) {
+				t.Errorf("Expected a pool only on success, got %v", db)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Expected %d connection attempts, got %d", tt.wantCalls, calls)
+			}
+			if !slices.Equal(slept, tt.wantSleep) {
+				t.Errorf("Expected waits %v, got %v", tt.wantSleep, slept)
+			}
+		})
+	}
+}
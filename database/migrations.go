@@ -2,27 +2,44 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 
+	"github.com/KAnggara75/BelajarGolang/config"
+	"github.com/KAnggara75/BelajarGolang/models"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // RunMigrations creates the necessary database tables
-func RunMigrations(db *pgx.Conn) error {
+func RunMigrations(db *pgxpool.Pool) error {
+	priceType := fmt.Sprintf("DECIMAL(%d, %d)", models.PricePrecision, config.GetPriceScale())
+
 	migrations := []string{
 		`CREATE TABLE IF NOT EXISTS categories (
 			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL UNIQUE,
+			name VARCHAR(255) NOT NULL,
 			description TEXT,
+			parent_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+			created_by TEXT NOT NULL DEFAULT 'system',
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 		`CREATE TABLE IF NOT EXISTS products (
 			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL UNIQUE,
-			price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			name VARCHAR(255) NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			sku VARCHAR(64) UNIQUE,
+			version INTEGER NOT NULL DEFAULT 1,
+			price ` + priceType + ` NOT NULL DEFAULT 0,
 			stock INTEGER NOT NULL DEFAULT 0,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			reorder_point INTEGER NOT NULL DEFAULT 0,
+			reorder_qty INTEGER NOT NULL DEFAULT 0,
 			category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+			category_removed_at TIMESTAMP,
+			created_by TEXT NOT NULL DEFAULT 'system',
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -36,6 +53,70 @@ func RunMigrations(db *pgx.Conn) error {
 				ALTER TABLE products ADD COLUMN category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL;
 			END IF;
 		END $$`,
+		// Add active column if it doesn't exist (for existing databases)
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE`,
+		// Add parent_id column if it doesn't exist (for existing databases)
+		`ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES categories(id) ON DELETE SET NULL`,
+		// Add category_removed_at column if it doesn't exist (for existing databases)
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS category_removed_at TIMESTAMP`,
+		// Add created_by columns if they don't exist (for existing databases)
+		`ALTER TABLE categories ADD COLUMN IF NOT EXISTS created_by TEXT NOT NULL DEFAULT 'system'`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS created_by TEXT NOT NULL DEFAULT 'system'`,
+		// Add reorder columns if they don't exist (for existing databases)
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS reorder_point INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS reorder_qty INTEGER NOT NULL DEFAULT 0`,
+		// Add description column if it doesn't exist (for existing databases)
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT ''`,
+		// Add sku column if it doesn't exist (for existing databases). Products
+		// without a SKU store NULL, which the unique constraint allows repeatedly.
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(64) UNIQUE`,
+		// Add version column if it doesn't exist (for existing databases)
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1`,
+		// Category names are unique case-insensitively. The functional index is
+		// created before the plain constraint is dropped, so names differing
+		// only in case make this migration fail instead of losing uniqueness.
+		`CREATE UNIQUE INDEX IF NOT EXISTS categories_name_lower_key ON categories (LOWER(name))`,
+		`ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_name_key`,
+		// Product names likewise
+		`CREATE UNIQUE INDEX IF NOT EXISTS products_name_lower_key ON products (LOWER(name))`,
+		`ALTER TABLE products DROP CONSTRAINT IF EXISTS products_name_key`,
+		`CREATE TABLE IF NOT EXISTS product_price_history (
+			id SERIAL PRIMARY KEY,
+			product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			old_price ` + priceType + `,
+			new_price ` + priceType + `,
+			changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS product_stock_history (
+			id SERIAL PRIMARY KEY,
+			product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			old_stock INTEGER NOT NULL,
+			new_stock INTEGER NOT NULL,
+			changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Category ids are kept without a foreign key so the history outlives
+		// a deleted category; NULL means uncategorized
+		`CREATE TABLE IF NOT EXISTS product_category_history (
+			id SERIAL PRIMARY KEY,
+			product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			old_category_id INTEGER,
+			new_category_id INTEGER,
+			changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Idempotency-Key values of product creates, remembered for a day so a
+		// retried POST returns the product it already created
+		`CREATE TABLE IF NOT EXISTS product_idempotency_keys (
+			key VARCHAR(255) PRIMARY KEY,
+			product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS product_idempotency_keys_created_at_idx ON product_idempotency_keys (created_at)`,
+	}
+
+	// Only relax the price constraint when NULL prices are allowed. Turning the
+	// flag back off does not restore NOT NULL since NULL rows may already exist.
+	if config.AllowNullPrice() {
+		migrations = append(migrations, `ALTER TABLE products ALTER COLUMN price DROP NOT NULL`)
 	}
 
 	for _, migration := range migrations {
@@ -45,12 +126,53 @@ func RunMigrations(db *pgx.Conn) error {
 		}
 	}
 
+	if err := alterPriceColumns(context.Background(), db, models.PricePrecision, config.GetPriceScale()); err != nil {
+		return err
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
 
+// priceColumns are the columns that follow PRICE_SCALE on existing databases
+var priceColumns = []struct{ table, column string }{
+	{"products", "price"},
+	{"product_price_history", "old_price"},
+	{"product_price_history", "new_price"},
+}
+
+// alterPriceColumns retypes the price columns to DECIMAL(precision, scale)
+// where information_schema reports a different type, so a restart with
+// unchanged settings takes no ACCESS EXCLUSIVE lock. Lowering the scale would
+// round stored prices, so it is refused and left to a manual migration.
+func alterPriceColumns(ctx context.Context, db *pgxpool.Pool, precision, scale int) error {
+	for _, c := range priceColumns {
+		var currentPrecision, currentScale *int
+		query := `SELECT numeric_precision, numeric_scale FROM information_schema.columns
+				  WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`
+		if err := db.QueryRow(ctx, query, c.table, c.column).Scan(&currentPrecision, &currentScale); err != nil {
+			return err
+		}
+		if currentPrecision != nil && currentScale != nil && *currentPrecision == precision && *currentScale == scale {
+			continue
+		}
+		if currentScale != nil && scale < *currentScale {
+			log.Printf("ERROR: PRICE_SCALE %d is below the scale %d of %s.%s", scale, *currentScale, c.table, c.column)
+			return fmt.Errorf("refusing to lower the scale of %s.%s from %d to %d: stored prices would be rounded",
+				c.table, c.column, *currentScale, scale)
+		}
+
+		log.Printf("Changing %s.%s to DECIMAL(%d, %d)", c.table, c.column, precision, scale)
+		alter := fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE DECIMAL(%d, %d)`, c.table, c.column, precision, scale)
+		if _, err := db.Exec(ctx, alter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // SeedCategories seeds initial category data if the table is empty
-func SeedCategories(db *pgx.Conn) error {
+func SeedCategories(db *pgxpool.Pool) error {
 	// Check if data already exists
 	var count int
 	err := db.QueryRow(context.Background(), "SELECT COUNT(*) FROM categories").Scan(&count)
@@ -89,7 +211,7 @@ func SeedCategories(db *pgx.Conn) error {
 }
 
 // SeedProducts seeds initial product data if the table is empty
-func SeedProducts(db *pgx.Conn) error {
+func SeedProducts(db *pgxpool.Pool) error {
 	// Check if data already exists
 	var count int
 	err := db.QueryRow(context.Background(), "SELECT COUNT(*) FROM products").Scan(&count)
@@ -102,24 +224,34 @@ func SeedProducts(db *pgx.Conn) error {
 		return nil
 	}
 
-	// Seed initial data with category_id (all Electronics = category_id 1)
+	// Seed products go into the first category. SeedCategories skips a
+	// non-empty table, so that need not be Electronics or even id 1; with no
+	// categories at all the products are left uncategorized.
+	var categoryID *int
+	err = db.QueryRow(context.Background(), "SELECT id FROM categories ORDER BY id LIMIT 1").Scan(&categoryID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if categoryID == nil {
+		log.Println("Warning: no categories found, seeding products without a category")
+	}
+
 	seedData := []struct {
-		Name       string
-		Price      float64
-		Stock      int
-		CategoryID int
+		Name  string
+		Price float64
+		Stock int
 	}{
-		{"iPhone 15 Pro", 999.99, 50, 1},
-		{"MacBook Pro M3", 2499.99, 25, 1},
-		{"AirPods Pro", 249.99, 100, 1},
-		{"iPad Air", 599.99, 40, 1},
-		{"Apple Watch Series 9", 399.99, 60, 1},
+		{"iPhone 15 Pro", 999.99, 50},
+		{"MacBook Pro M3", 2499.99, 25},
+		{"AirPods Pro", 249.99, 100},
+		{"iPad Air", 599.99, 40},
+		{"Apple Watch Series 9", 399.99, 60},
 	}
 
 	for _, data := range seedData {
 		_, err := db.Exec(context.Background(),
 			"INSERT INTO products (name, price, stock, category_id) VALUES ($1, $2, $3, $4)",
-			data.Name, data.Price, data.Stock, data.CategoryID)
+			data.Name, data.Price, data.Stock, categoryID)
 		if err != nil {
 			return err
 		}
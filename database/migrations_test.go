@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/KAnggara75/BelajarGolang/config"
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// openTestDB connects to TEST_DATABASE_URL, migrates and empties the tables,
+// skipping the test when no database is configured
+func openTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping database integration test")
+	}
+
+	db, err := InitDB(url)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	truncate := `TRUNCATE product_idempotency_keys, product_price_history, product_stock_history, product_category_history, products, categories RESTART IDENTITY CASCADE`
+	if _, err := db.Exec(context.Background(), truncate); err != nil {
+		t.Fatalf("Failed to truncate tables: %v", err)
+	}
+
+	return db
+}
+
+// TestSeedProducts_CategoryLookup tests that seed products go into the first
+// existing category, or stay uncategorized when there is none
+func TestSeedProducts_CategoryLookup(t *testing.T) {
+	tests := []struct {
+		name       string
+		categories []string
+		// want is the category name the products land in; "" means none
+		want string
+	}{
+		{"no categories", nil, ""},
+		{"first category is not id 1", []string{"Garden", "Toys"}, "Garden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			ctx := context.Background()
+
+			// Consume id 1 so the first remaining category has a later id
+			if _, err := db.Exec(ctx, "SELECT nextval('categories_id_seq')"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, name := range tt.categories {
+				if _, err := db.Exec(ctx, "INSERT INTO categories (name) VALUES ($1)", name); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			if err := SeedProducts(db); err != nil {
+				t.Fatalf("Expected seeding to succeed, got %v", err)
+			}
+
+			rows, err := db.Query(ctx, `SELECT COALESCE(c.name, '') FROM products p
+				LEFT JOIN categories c ON p.category_id = c.id`)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer rows.Close()
+
+			seeded := 0
+			for rows.Next() {
+				var category string
+				if err := rows.Scan(&category); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if category != tt.want {
+					t.Errorf("Expected category %q, got %q", tt.want, category)
+				}
+				seeded++
+			}
+			if seeded == 0 {
+				t.Error("Expected seed products to be inserted")
+			}
+		})
+	}
+}
+
+// TestAlterPriceColumns tests that the price columns are only retyped when
+// the scale changes, and that lowering it is refused
+func TestAlterPriceColumns(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	precision, scale := models.PricePrecision, config.GetPriceScale()
+	t.Cleanup(func() {
+		// Restore the configured type for the tests that follow
+		for _, c := range priceColumns {
+			db.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE DECIMAL(%d, %d)`, c.table, c.column, precision, scale))
+		}
+	})
+
+	columnScale := func() int {
+		var got int
+		query := `SELECT numeric_scale FROM information_schema.columns
+				  WHERE table_schema = current_schema() AND table_name = 'products' AND column_name = 'price'`
+		if err := db.QueryRow(ctx, query).Scan(&got); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return got
+	}
+
+	if err := alterPriceColumns(ctx, db, precision, scale); err != nil {
+		t.Fatalf("Expected an unchanged scale to pass, got %v", err)
+	}
+	if err := alterPriceColumns(ctx, db, precision, scale+1); err != nil {
+		t.Fatalf("Expected a higher scale to apply, got %v", err)
+	}
+	if got := columnScale(); got != scale+1 {
+		t.Errorf("Expected scale %d, got %d", scale+1, got)
+	}
+	if err := alterPriceColumns(ctx, db, precision, scale); err == nil {
+		t.Error("Expected lowering the scale to be refused")
+	}
+	if got := columnScale(); got != scale+1 {
+		t.Errorf("Expected the refused change to keep scale %d, got %d", scale+1, got)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/KAnggara75/BelajarGolang/repository"
+)
+
+// AdminHandler serves diagnostic endpoints under /admin/products
+type AdminHandler struct {
+	productRepo repository.ProductRepository
+	basePath    string
+}
+
+// NewAdminHandler serves the admin product routes mounted at basePath, such
+// as "/v1/admin/products"
+func NewAdminHandler(productRepo repository.ProductRepository, basePath string) *AdminHandler {
+	return &AdminHandler{productRepo: productRepo, basePath: basePath}
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	path := strings.TrimPrefix(r.URL.Path, h.basePath)
+	path = strings.Trim(path, "/")
+
+	switch path {
+	case "anomalies":
+		setRoute(r, h.basePath, path)
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetAnomalies(w, r)
+	default:
+		h.sendError(w, r, http.StatusNotFound, ErrCodeNotFound, "Not found")
+	}
+}
+
+// GetAnomalies lists products whose data needs cleaning up: a zero or
+// negative price, active while out of stock, or a blank name
+func (h *AdminHandler) GetAnomalies(w http.ResponseWriter, r *http.Request) {
+	anomalies, err := h.productRepo.GetAnomalies(r.Context())
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve product anomalies")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Product anomalies retrieved successfully", anomalies)
+}
+
+func (h *AdminHandler) sendSuccess(w http.ResponseWriter, r *http.Request, status int, message string, data interface{}) {
+	writeSuccess(w, r, status, message, data, nil)
+}
+
+func (h *AdminHandler) sendError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeError(w, r, status, code, message)
+}
+
+func (h *AdminHandler) sendServerError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	writeServerError(w, r, err, message)
+}
+
+func (h *AdminHandler) methodNotAllowed(w http.ResponseWriter, r *http.Request, allow string) {
+	writeMethodNotAllowed(w, r, allow)
+}
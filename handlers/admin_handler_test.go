@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+)
+
+// TestGetAnomalies tests GET /admin/products/anomalies groups suspicious products by type
+func TestGetAnomalies(t *testing.T) {
+	repo := newMockProductRepository()
+	repo.SeedData()
+	ctx := context.Background()
+	_, _ = repo.Create(ctx, models.Product{Name: "Free Sample", Price: pricePtr(0), Stock: 5})
+	_, _ = repo.Create(ctx, models.Product{Name: "Sold Out", Price: pricePtr(10), Stock: 0})
+	_, _ = repo.Create(ctx, models.Product{Name: "   ", Price: pricePtr(0), Stock: 0})
+	handler := NewAdminHandler(repo, "/admin/products")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/products/anomalies", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	expected := map[string][]string{
+		"non_positive_price":  {"Free Sample", "   "},
+		"active_out_of_stock": {"Sold Out", "   "},
+		"blank_name":          {"   "},
+	}
+	for key, names := range expected {
+		items, ok := data[key].([]any)
+		if !ok {
+			t.Fatalf("Expected %s to be an array, got %v", key, data[key])
+		}
+		if len(items) != len(names) {
+			t.Errorf("%s: expected %d products, got %d", key, len(names), len(items))
+			continue
+		}
+		for i, item := range items {
+			if got := item.(map[string]any)["name"]; got != names[i] {
+				t.Errorf("%s[%d]: expected %q, got %q", key, i, names[i], got)
+			}
+		}
+	}
+}
+
+// TestGetAnomalies_Clean tests that a clean catalog returns empty lists
+func TestGetAnomalies_Clean(t *testing.T) {
+	repo := newMockProductRepository()
+	repo.SeedData()
+	handler := NewAdminHandler(repo, "/admin/products")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/products/anomalies", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	for key, value := range response.Data.(map[string]any) {
+		if items, ok := value.([]any); !ok || len(items) != 0 {
+			t.Errorf("Expected %s to be an empty array, got %v", key, value)
+		}
+	}
+}
+
+// TestAdminHandler_Routes tests method and path handling
+func TestAdminHandler_Routes(t *testing.T) {
+	handler := NewAdminHandler(newMockProductRepository(), "/admin/products")
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPost, "/admin/products/anomalies", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/admin/products/unknown", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KAnggara75/BelajarGolang/config"
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/KAnggara75/BelajarGolang/repository"
+)
+
+// maxImportRows caps the number of categories and of products in one import
+const maxImportRows = 1000
+
+// Policies for names repeated within one import, selected with ?duplicate_policy=
+const (
+	// duplicateError rejects the batch, reporting every repeated row
+	duplicateError = "error"
+	// duplicateSkip leaves out every row whose name is repeated
+	duplicateSkip = "skip"
+	// duplicateFirstWins keeps the first row of each name and drops the rest
+	duplicateFirstWins = "first-wins"
+)
+
+type CatalogHandler struct {
+	repo     repository.CatalogRepository
+	basePath string
+}
+
+// NewCatalogHandler serves the catalog routes mounted at basePath, such as
+// "/v1/admin/catalog"
+func NewCatalogHandler(repo repository.CatalogRepository, basePath string) *CatalogHandler {
+	return &CatalogHandler{repo: repo, basePath: basePath}
+}
+
+func (h *CatalogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	path := strings.TrimPrefix(r.URL.Path, h.basePath)
+	path = strings.Trim(path, "/")
+
+	if path != "import" {
+		h.sendError(w, r, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	setRoute(r, h.basePath, path)
+
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w, r, "POST")
+		return
+	}
+	h.Import(w, r)
+}
+
+// Import creates categories and products from one payload, resolving product
+// categories by name
+func (h *CatalogHandler) Import(w http.ResponseWriter, r *http.Request) {
+	policy := r.URL.Query().Get("duplicate_policy")
+	switch policy {
+	case "":
+		policy = duplicateError
+	case duplicateError, duplicateSkip, duplicateFirstWins:
+	default:
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid duplicate_policy parameter (error, skip or first-wins)")
+		return
+	}
+
+	var input models.CatalogImport
+	if err := decodeJSON(r, &input); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
+		return
+	}
+
+	if err := validateCatalogImport(&input); err != nil {
+		h.sendValidationError(w, r, err)
+		return
+	}
+
+	dropped, err := applyDuplicatePolicy(&input, policy)
+	if err != nil {
+		h.sendValidationError(w, r, err)
+		return
+	}
+
+	result, err := h.repo.Import(r.Context(), input, requestUser(r))
+	if err != nil {
+		var catErr *repository.ImportCategoryError
+		if errors.As(err, &catErr) {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeCategoryNotFound, fmt.Sprintf("Category not found: %q", catErr.Name))
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to import catalog")
+		return
+	}
+	result.Skipped = append(dropped, result.Skipped...)
+	h.sendSuccess(w, r, http.StatusCreated, "Catalog imported successfully", result)
+}
+
+// validateCatalogImport checks every row before anything is written,
+// defaulting missing prices the same way product creation does. Names
+// repeated within the payload are left to applyDuplicatePolicy. It returns a
+// *validationErrors listing every invalid field, such as products[2].price,
+// or nil.
+func validateCatalogImport(input *models.CatalogImport) error {
+	verr := &validationErrors{}
+	if len(input.Categories) == 0 && len(input.Products) == 0 {
+		verr.add("", "Nothing to import")
+		return verr
+	}
+	if len(input.Categories) > maxImportRows {
+		verr.add("categories", fmt.Sprintf("At most %d categories can be imported at once", maxImportRows))
+	}
+	if len(input.Products) > maxImportRows {
+		verr.add("products", fmt.Sprintf("At most %d products can be imported at once", maxImportRows))
+	}
+	if err := verr.orNil(); err != nil {
+		return err
+	}
+
+	for i := range input.Categories {
+		cat := &input.Categories[i]
+		cat.Name = strings.TrimSpace(cat.Name)
+		cat.Description = strings.TrimSpace(cat.Description)
+		if err := verr.addRow(fmt.Sprintf("categories[%d]", i), validateStruct(cat)); err != nil {
+			return err
+		}
+	}
+
+	for i := range input.Products {
+		p := &input.Products[i]
+		p.Name = strings.TrimSpace(p.Name)
+		p.Category = strings.TrimSpace(p.Category)
+		if p.Price == nil && !config.AllowNullPrice() {
+			p.Price = &models.Price{}
+		}
+		if err := verr.addRow(fmt.Sprintf("products[%d]", i), validateStruct(p)); err != nil {
+			return err
+		}
+	}
+
+	return verr.orNil()
+}
+
+// applyDuplicatePolicy handles names repeated within the payload, compared
+// case-insensitively like the unique name indexes. Rows it drops are returned
+// as skipped items; under duplicateError it returns a *validationErrors
+// listing every repeated row instead.
+func applyDuplicatePolicy(input *models.CatalogImport, policy string) ([]models.CatalogSkippedItem, error) {
+	categoryNames := make([]string, len(input.Categories))
+	for i, cat := range input.Categories {
+		categoryNames[i] = cat.Name
+	}
+	productNames := make([]string, len(input.Products))
+	for i, p := range input.Products {
+		productNames[i] = p.Name
+	}
+
+	categoryDrop := duplicateRows(categoryNames, policy)
+	productDrop := duplicateRows(productNames, policy)
+	if len(categoryDrop) == 0 && len(productDrop) == 0 {
+		return nil, nil
+	}
+
+	if policy == duplicateError {
+		verr := &validationErrors{}
+		for _, i := range categoryDrop {
+			verr.add(fmt.Sprintf("categories[%d].name", i), "Name repeated in payload")
+		}
+		for _, i := range productDrop {
+			verr.add(fmt.Sprintf("products[%d].name", i), "Name repeated in payload")
+		}
+		return nil, verr
+	}
+
+	skipped := make([]models.CatalogSkippedItem, 0, len(categoryDrop)+len(productDrop))
+	for _, i := range categoryDrop {
+		skipped = append(skipped, models.CatalogSkippedItem{Type: "category", Name: categoryNames[i], Reason: "duplicate in payload"})
+	}
+	for _, i := range productDrop {
+		skipped = append(skipped, models.CatalogSkippedItem{Type: "product", Name: productNames[i], Reason: "duplicate in payload"})
+	}
+	input.Categories = withoutRows(input.Categories, categoryDrop)
+	input.Products = withoutRows(input.Products, productDrop)
+	return skipped, nil
+}
+
+// duplicateRows returns, in order, the indices of names that occur more than
+// once. Under duplicateFirstWins the first occurrence of each name is kept
+// out of the result.
+func duplicateRows(names []string, policy string) []int {
+	counts := make(map[string]int, len(names))
+	for _, name := range names {
+		counts[strings.ToLower(name)]++
+	}
+
+	var rows []int
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		key := strings.ToLower(name)
+		if counts[key] < 2 {
+			continue
+		}
+		if policy == duplicateFirstWins && !seen[key] {
+			seen[key] = true
+			continue
+		}
+		rows = append(rows, i)
+	}
+	return rows
+}
+
+// withoutRows returns items minus the rows at the given ascending indices
+func withoutRows[T any](items []T, rows []int) []T {
+	kept := make([]T, 0, len(items)-len(rows))
+	for i, item := range items {
+		if len(rows) > 0 && rows[0] == i {
+			rows = rows[1:]
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+func (h *CatalogHandler) sendSuccess(w http.ResponseWriter, r *http.Request, status int, message string, data interface{}) {
+	writeSuccess(w, r, status, message, data, nil)
+}
+
+func (h *CatalogHandler) sendError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeError(w, r, status, code, message)
+}
+
+func (h *CatalogHandler) sendValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	writeValidationError(w, r, err)
+}
+
+func (h *CatalogHandler) sendServerError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	writeServerError(w, r, err, message)
+}
+
+func (h *CatalogHandler) methodNotAllowed(w http.ResponseWriter, r *http.Request, allow string) {
+	writeMethodNotAllowed(w, r, allow)
+}
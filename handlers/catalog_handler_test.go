@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/KAnggara75/BelajarGolang/repository"
+)
+
+// mockCatalogRepository is a mock implementation of CatalogRepository for testing
+type mockCatalogRepository struct {
+	categories map[string]bool
+	products   map[string]bool
+	calls      int
+}
+
+func newMockCatalogRepository() *mockCatalogRepository {
+	return &mockCatalogRepository{
+		categories: map[string]bool{"Electronics": true},
+		products:   map[string]bool{"iPhone 15 Pro": true},
+	}
+}
+
+func (m *mockCatalogRepository) Import(ctx context.Context, input models.CatalogImport, createdBy string) (models.CatalogImportResult, error) {
+	m.calls++
+	result := models.CatalogImportResult{Skipped: []models.CatalogSkippedItem{}}
+
+	// Resolve categories against a copy so a failed import leaves no trace
+	categories := make(map[string]bool, len(m.categories))
+	for name := range m.categories {
+		categories[name] = true
+	}
+
+	for _, cat := range input.Categories {
+		if categories[cat.Name] {
+			result.Skipped = append(result.Skipped, models.CatalogSkippedItem{Type: "category", Name: cat.Name, Reason: "name already exists"})
+			continue
+		}
+		categories[cat.Name] = true
+		result.CategoriesCreated++
+	}
+
+	var created []string
+	for _, p := range input.Products {
+		if p.Category != "" && !categories[p.Category] {
+			return models.CatalogImportResult{}, &repository.ImportCategoryError{Name: p.Category}
+		}
+		if m.products[p.Name] {
+			result.Skipped = append(result.Skipped, models.CatalogSkippedItem{Type: "product", Name: p.Name, Reason: "name already exists"})
+			continue
+		}
+		created = append(created, p.Name)
+		result.ProductsCreated++
+	}
+
+	m.categories = categories
+	for _, name := range created {
+		m.products[name] = true
+	}
+	return result, nil
+}
+
+func postCatalogImport(t *testing.T, handler http.Handler, payload string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/catalog/import", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return rec, response
+}
+
+// responseFieldErrors returns the data.errors list of a validation failure
+func responseFieldErrors(t *testing.T, response Response) []fieldError {
+	t.Helper()
+
+	encoded, err := json.Marshal(response.Data)
+	if err != nil {
+		t.Fatalf("Failed to encode data: %v", err)
+	}
+	var data struct {
+		Errors []fieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+	return data.Errors
+}
+
+// TestCatalogImport_Success tests POST /admin/catalog/import with new and conflicting rows
+func TestCatalogImport_Success(t *testing.T) {
+	repo := newMockCatalogRepository()
+	handler := NewCatalogHandler(repo, "/admin/catalog")
+
+	payload := `{
+		"categories": [{"name": "Books"}, {"name": "Electronics"}],
+		"products": [
+			{"name": "Go Book", "price": 39.5, "stock": 5, "category": "Books"},
+			{"name": "USB Cable", "price": 5, "stock": 100, "category": "Electronics"},
+			{"name": "iPhone 15 Pro", "price": 999.99, "stock": 1, "category": "Electronics"}
+		]
+	}`
+	rec, response := postCatalogImport(t, handler, payload)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, response.Message)
+	}
+
+	data, ok := response.Data.(map[string]any)
+	if !ok {
+		t.Fatalf("Expected data to be an object, got %T", response.Data)
+	}
+
+	if data["categories_created"] != float64(1) {
+		t.Errorf("Expected 1 category created, got %v", data["categories_created"])
+	}
+	if data["products_created"] != float64(2) {
+		t.Errorf("Expected 2 products created, got %v", data["products_created"])
+	}
+
+	skipped, ok := data["skipped"].([]any)
+	if !ok || len(skipped) != 2 {
+		t.Fatalf("Expected 2 skipped rows, got %v", data["skipped"])
+	}
+	first := skipped[0].(map[string]any)
+	if first["type"] != "category" || first["name"] != "Electronics" {
+		t.Errorf("Expected skipped category Electronics, got %v", first)
+	}
+	second := skipped[1].(map[string]any)
+	if second["type"] != "product" || second["name"] != "iPhone 15 Pro" {
+		t.Errorf("Expected skipped product iPhone 15 Pro, got %v", second)
+	}
+}
+
+// TestCatalogImport_ValidationFailsBeforeWrite tests that an invalid row
+// rejects the whole payload with 422 listing every invalid field, and that a
+// body that cannot be decoded is a 400
+func TestCatalogImport_ValidationFailsBeforeWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		status  int
+		errors  []fieldError
+	}{
+		{"empty payload", `{}`, http.StatusUnprocessableEntity, []fieldError{{"", "Nothing to import"}}},
+		{"category without name", `{"categories":[{"name":"Books"},{"name":""}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{"categories[1].name", "Name is required"}}},
+		{"category description too long", `{"categories":[{"name":"Books","description":"` + strings.Repeat("x", maxDescriptionLength+1) + `"}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{"categories[0].description", "Description too long (max 2000 characters)"}}},
+		{"duplicate category", `{"categories":[{"name":"Books"},{"name":"Books"}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{"categories[0].name", "Name repeated in payload"}, {"categories[1].name", "Name repeated in payload"}}},
+		{"product without name", `{"products":[{"price":1}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{"products[0].name", "Name is required"}}},
+		{"duplicate product", `{"products":[{"name":"Pen"},{"name":"Pen"}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{"products[0].name", "Name repeated in payload"}, {"products[1].name", "Name repeated in payload"}}},
+		{"negative price", `{"products":[{"name":"Pen","price":-1}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{"products[0].price", "Price cannot be negative"}}},
+		{"price over maximum", `{"products":[{"name":"Pen","price":100000000}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{"products[0].price", "Price exceeds maximum (99999999.99)"}}},
+		{"negative stock", `{"products":[{"name":"Pen","stock":-1}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{"products[0].stock", "Stock cannot be negative"}}},
+		{"every invalid row", `{"categories":[{"name":""}],"products":[{"name":"Pen","price":-1,"stock":-1},{"name":""}]}`, http.StatusUnprocessableEntity,
+			[]fieldError{
+				{"categories[0].name", "Name is required"},
+				{"products[0].price", "Price cannot be negative"},
+				{"products[0].stock", "Stock cannot be negative"},
+				{"products[1].name", "Name is required"},
+			}},
+		{"invalid json", `{"products":`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockCatalogRepository()
+			handler := NewCatalogHandler(repo, "/admin/catalog")
+
+			rec, response := postCatalogImport(t, handler, tt.payload)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := responseFieldErrors(t, response); !slices.Equal(got, tt.errors) {
+				t.Errorf("Expected errors %v, got %v", tt.errors, got)
+			}
+			if repo.calls != 0 {
+				t.Errorf("Expected no write for an invalid payload, got %d calls", repo.calls)
+			}
+		})
+	}
+}
+
+// TestCatalogImport_DuplicatePolicy tests each ?duplicate_policy= against a
+// payload that repeats names internally
+func TestCatalogImport_DuplicatePolicy(t *testing.T) {
+	payload := `{
+		"categories": [{"name": "Books"}, {"name": "Garden"}, {"name": "BOOKS"}],
+		"products": [
+			{"name": "Pen", "price": 1},
+			{"name": "Go Book", "price": 39.5, "category": "Garden"},
+			{"name": "pen", "price": 2},
+			{"name": "Pen", "price": 3}
+		]
+	}`
+
+	repeated := []fieldError{
+		{"categories[0].name", "Name repeated in payload"},
+		{"categories[2].name", "Name repeated in payload"},
+		{"products[0].name", "Name repeated in payload"},
+		{"products[2].name", "Name repeated in payload"},
+		{"products[3].name", "Name repeated in payload"},
+	}
+
+	tests := []struct {
+		policy     string
+		status     int
+		errors     []fieldError
+		categories float64
+		products   float64
+		skipped    []string
+	}{
+		{"", http.StatusUnprocessableEntity, repeated, 0, 0, nil},
+		{"error", http.StatusUnprocessableEntity, repeated, 0, 0, nil},
+		{"skip", http.StatusCreated, nil, 1, 1, []string{"Books", "BOOKS", "Pen", "pen", "Pen"}},
+		{"first-wins", http.StatusCreated, nil, 2, 2, []string{"BOOKS", "pen", "Pen"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("policy="+tt.policy, func(t *testing.T) {
+			repo := newMockCatalogRepository()
+			handler := NewCatalogHandler(repo, "/admin/catalog")
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/catalog/import?duplicate_policy="+tt.policy, bytes.NewBufferString(payload))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if tt.status == http.StatusUnprocessableEntity {
+				if got := responseFieldErrors(t, response); !slices.Equal(got, tt.errors) {
+					t.Errorf("Expected errors %v, got %v", tt.errors, got)
+				}
+				if repo.calls != 0 {
+					t.Errorf("Expected no write for a rejected payload, got %d calls", repo.calls)
+				}
+				return
+			}
+
+			data := response.Data.(map[string]any)
+			if data["categories_created"] != tt.categories || data["products_created"] != tt.products {
+				t.Errorf("Expected %v categories and %v products created, got %v and %v",
+					tt.categories, tt.products, data["categories_created"], data["products_created"])
+			}
+
+			var skipped []string
+			for _, item := range data["skipped"].([]any) {
+				row := item.(map[string]any)
+				if row["reason"] != "duplicate in payload" {
+					t.Errorf("Unexpected skip reason: %v", row)
+				}
+				skipped = append(skipped, row["name"].(string))
+			}
+			if !slices.Equal(skipped, tt.skipped) {
+				t.Errorf("Expected skipped %v, got %v", tt.skipped, skipped)
+			}
+		})
+	}
+}
+
+// TestCatalogImport_InvalidDuplicatePolicy tests that unknown policies are rejected
+func TestCatalogImport_InvalidDuplicatePolicy(t *testing.T) {
+	repo := newMockCatalogRepository()
+	handler := NewCatalogHandler(repo, "/admin/catalog")
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/catalog/import?duplicate_policy=last-wins", bytes.NewBufferString(`{"categories":[{"name":"Books"}]}`))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest || repo.calls != 0 {
+		t.Errorf("Expected status %d and no write, got %d with %d calls", http.StatusBadRequest, rec.Code, repo.calls)
+	}
+}
+
+// TestCatalogImport_UnknownCategory tests that a product referencing a missing category aborts the import
+func TestCatalogImport_UnknownCategory(t *testing.T) {
+	repo := newMockCatalogRepository()
+	handler := NewCatalogHandler(repo, "/admin/catalog")
+
+	payload := `{"categories":[{"name":"Books"}],"products":[{"name":"Pen","category":"Stationery"}]}`
+	rec, response := postCatalogImport(t, handler, payload)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if response.Message != `Category not found: "Stationery"` {
+		t.Errorf("Unexpected message: %s", response.Message)
+	}
+	if response.Code != ErrCodeCategoryNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeCategoryNotFound, response.Code)
+	}
+	if repo.categories["Books"] {
+		t.Error("Expected the failed import to leave no categories behind")
+	}
+}
+
+// TestCatalogImport_MethodNotAllowed tests that only POST is accepted
+func TestCatalogImport_MethodNotAllowed(t *testing.T) {
+	handler := NewCatalogHandler(newMockCatalogRepository(), "/admin/catalog")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/catalog/import", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
@@ -1,55 +1,119 @@
 package handlers
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
+	"github.com/KAnggara75/BelajarGolang/config"
 	"github.com/KAnggara75/BelajarGolang/models"
 	"github.com/KAnggara75/BelajarGolang/repository"
 )
 
 type CategoryHandler struct {
-	repo repository.CategoryRepository
+	repo        repository.CategoryRepository
+	productRepo repository.ProductRepository
+	basePath    string
 }
 
-func NewCategoryHandler(repo repository.CategoryRepository) *CategoryHandler {
-	return &CategoryHandler{repo: repo}
+// NewCategoryHandler serves the category routes mounted at basePath, such as
+// "/v1/categories"
+func NewCategoryHandler(repo repository.CategoryRepository, productRepo repository.ProductRepository, basePath string) *CategoryHandler {
+	return &CategoryHandler{repo: repo, productRepo: productRepo, basePath: basePath}
 }
 
+// Methods served on the category collection and on a single category, as
+// reported in the Allow header
+const (
+	categoryCollectionMethods = "GET, POST, DELETE"
+	categoryResourceMethods   = "GET, PUT, DELETE"
+)
+
+// Response is the JSON envelope. Code is set only on errors, to one of the
+// ErrCode constants.
 type Response struct {
 	Success bool   `json:"success"`
 	Message string `json:"message,omitempty"`
+	Code    string `json:"code,omitempty"`
 	Data    any    `json:"data,omitempty"`
+	Meta    any    `json:"meta,omitempty"`
 }
 
 func (h *CategoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	path := strings.TrimPrefix(r.URL.Path, "/categories")
-	path = strings.TrimPrefix(path, "/")
+	// A trailing slash is ignored, so "/categories/" is the collection
+	path, ok := resourcePath(r, h.basePath)
+	if !ok {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid path: empty segment")
+		return
+	}
+	setRoute(r, h.basePath, path)
 
 	if path == "" {
-		// Handle collection routes: GET /categories, POST /categories
+		// Handle collection routes: GET /categories, POST /categories, DELETE /categories?ids=
 		switch r.Method {
 		case http.MethodGet:
 			h.GetAll(w, r)
 		case http.MethodPost:
 			h.Create(w, r)
+		case http.MethodDelete:
+			h.DeleteMany(w, r)
+		case http.MethodOptions:
+			writeOptions(w, categoryCollectionMethods)
 		default:
-			h.methodNotAllowed(w)
+			h.methodNotAllowed(w, r, categoryCollectionMethods)
 		}
 		return
 	}
 
-	// Handle single resource routes: GET/PUT/DELETE /categories/{id}
-	id, err := strconv.Atoi(path)
+	if path == "descriptions" {
+		if r.Method != http.MethodPatch {
+			h.methodNotAllowed(w, r, "PATCH")
+			return
+		}
+		h.UpdateDescriptions(w, r)
+		return
+	}
+
+	if path == "count" {
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.Count(w, r)
+		return
+	}
+
+	if path == "tree" {
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetTree(w, r)
+		return
+	}
+
+	// Split off an optional sub-resource: /categories/{id}/{sub}
+	idPart, sub, _ := strings.Cut(path, "/")
+	setRoute(r, h.basePath, idRoute(""))
+
+	id, err := models.ParseID(idPart)
 	if err != nil {
-		h.sendError(w, http.StatusBadRequest, "Invalid category ID")
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid category ID")
 		return
 	}
 
+	if sub != "" {
+		setRoute(r, h.basePath, idRoute(sub))
+		h.serveSubResource(w, r, id, sub)
+		return
+	}
+
+	// Handle single resource routes: GET/PUT/DELETE /categories/{id}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.GetByID(w, r, id)
@@ -57,115 +121,521 @@ func (h *CategoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.Update(w, r, id)
 	case http.MethodDelete:
 		h.Delete(w, r, id)
+	case http.MethodOptions:
+		writeOptions(w, categoryResourceMethods)
+	default:
+		h.methodNotAllowed(w, r, categoryResourceMethods)
+	}
+}
+
+// serveSubResource handles routes nested under a single category
+func (h *CategoryHandler) serveSubResource(w http.ResponseWriter, r *http.Request, id int, sub string) {
+	switch sub {
+	case "products":
+		switch r.Method {
+		case http.MethodGet:
+			h.GetProducts(w, r, id)
+		case http.MethodPost:
+			h.CreateProduct(w, r, id)
+		default:
+			h.methodNotAllowed(w, r, "GET, POST")
+		}
+	case "low-stock":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetLowStock(w, r, id)
+	case "cheapest":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetCheapest(w, r, id)
+	case "deactivate-products", "activate-products":
+		if r.Method != http.MethodPost {
+			h.methodNotAllowed(w, r, "POST")
+			return
+		}
+		h.SetProductsActive(w, r, id, sub == "activate-products")
 	default:
-		h.methodNotAllowed(w)
+		// Unknown sub-resources share one route so the label stays bounded
+		setRoute(r, h.basePath, idRoute("*"))
+		h.sendError(w, r, http.StatusNotFound, ErrCodeNotFound, "Not found")
 	}
 }
 
-// GetAll returns all categories
+// GetAll returns all categories, each with its product_count when
+// ?with_counts=true
 func (h *CategoryHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	if withCounts := r.URL.Query().Get("with_counts"); withCounts != "" {
+		counted, err := strconv.ParseBool(withCounts)
+		if err != nil {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid with_counts parameter (true or false)")
+			return
+		}
+		if counted {
+			h.getAllWithCounts(w, r)
+			return
+		}
+	}
+
+	categories, err := h.repo.GetAll(r.Context())
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve categories")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Categories retrieved successfully", categories)
+}
+
+// getAllWithCounts lists every category with its product_count, for
+// ?with_counts=true
+func (h *CategoryHandler) getAllWithCounts(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.repo.GetAllWithCounts(r.Context())
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve categories")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Categories retrieved successfully", categories)
+}
+
+// GetTree returns the full category hierarchy as nested nodes
+func (h *CategoryHandler) GetTree(w http.ResponseWriter, r *http.Request) {
 	categories, err := h.repo.GetAll(r.Context())
 	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, "Failed to retrieve categories")
+		h.sendServerError(w, r, err, "Failed to retrieve categories")
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Categories retrieved successfully", categories)
+	h.sendSuccess(w, r, http.StatusOK, "Category tree retrieved successfully", buildCategoryTree(categories))
 }
 
-// GetByID returns a single category
+// categoryDetail is a category response extended with the sections
+// requested through ?include=
+type categoryDetail struct {
+	models.Category
+	Breadcrumb   []models.Category `json:"breadcrumb,omitempty"`
+	ProductCount *int              `json:"product_count,omitempty"`
+	Products     *[]models.Product `json:"products,omitempty"`
+}
+
+// GetByID returns a single category. ?include= takes a comma list of
+// breadcrumb (ancestor path, root first), count (number of products) and
+// products (the products themselves).
 func (h *CategoryHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	var includes map[string]bool
+	if include := r.URL.Query().Get("include"); include != "" {
+		var err error
+		includes, err = parseIncludes(include, "breadcrumb", "count", "products")
+		if err != nil {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid include parameter")
+			return
+		}
+	}
+
 	category, err := h.repo.GetByID(r.Context(), id)
 	if err != nil {
 		if err == repository.ErrNotFound {
-			h.sendError(w, http.StatusNotFound, "Category not found")
+			h.sendError(w, r, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found")
 			return
 		}
-		h.sendError(w, http.StatusInternalServerError, "Failed to retrieve category")
+		h.sendServerError(w, r, err, "Failed to retrieve category")
+		return
+	}
+
+	if len(includes) == 0 {
+		h.sendSuccess(w, r, http.StatusOK, "Category retrieved successfully", category)
+		return
+	}
+
+	detail := categoryDetail{Category: category}
+	if includes["breadcrumb"] {
+		detail.Breadcrumb, err = h.productRepo.GetCategoryPath(r.Context(), id)
+		if err != nil {
+			h.sendServerError(w, r, err, "Failed to retrieve category path")
+			return
+		}
+	}
+	if includes["count"] {
+		count, err := h.productRepo.Count(r.Context(), repository.ProductFilter{CategoryIDs: []int{id}})
+		if err != nil {
+			h.sendServerError(w, r, err, "Failed to count products")
+			return
+		}
+		detail.ProductCount = &count
+	}
+	if includes["products"] {
+		products, err := h.productRepo.GetByCategory(r.Context(), id)
+		if err != nil {
+			h.sendServerError(w, r, err, "Failed to retrieve products")
+			return
+		}
+		detail.Products = &products
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Category retrieved successfully", detail)
+}
+
+// Count returns the number of categories
+func (h *CategoryHandler) Count(w http.ResponseWriter, r *http.Request) {
+	count, err := h.repo.Count(r.Context())
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to count categories")
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Category retrieved successfully", category)
+	h.sendSuccess(w, r, http.StatusOK, "Categories counted successfully", map[string]any{"count": count})
 }
 
 // Create adds a new category
 func (h *CategoryHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var cat models.Category
-	if err := json.NewDecoder(r.Body).Decode(&cat); err != nil {
-		h.sendError(w, http.StatusBadRequest, "Invalid request body")
+	if err := decodeBody(r, &cat, func(form url.Values) error {
+		return categoryFromForm(form, &cat)
+	}); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
 		return
 	}
 
-	if cat.Name == "" {
-		h.sendError(w, http.StatusBadRequest, "Name is required")
+	if err := validateCategory(&cat); err != nil {
+		h.sendValidationError(w, r, err)
 		return
 	}
 
+	cat.CreatedBy = requestUser(r)
+
 	created, err := h.repo.Create(r.Context(), cat)
 	if err != nil {
 		if err == repository.ErrNameExists {
-			h.sendError(w, http.StatusConflict, "Category name already exists")
+			h.sendError(w, r, http.StatusConflict, ErrCodeDuplicateName, "Category name already exists")
+			return
+		}
+		if err == repository.ErrParentNotFound {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeCategoryNotFound, "Parent category not found")
 			return
 		}
-		h.sendError(w, http.StatusInternalServerError, "Failed to create category")
+		h.sendServerError(w, r, err, "Failed to create category")
 		return
 	}
-	h.sendSuccess(w, http.StatusCreated, "Category created successfully", created)
+	h.sendSuccess(w, r, http.StatusCreated, "Category created successfully", created)
 }
 
 // Update updates an existing category
 func (h *CategoryHandler) Update(w http.ResponseWriter, r *http.Request, id int) {
 	var cat models.Category
-	if err := json.NewDecoder(r.Body).Decode(&cat); err != nil {
-		h.sendError(w, http.StatusBadRequest, "Invalid request body")
+	if err := decodeJSON(r, &cat); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
+		return
+	}
+
+	if err := validateCategory(&cat); err != nil {
+		h.sendValidationError(w, r, err)
 		return
 	}
 
-	if cat.Name == "" {
-		h.sendError(w, http.StatusBadRequest, "Name is required")
+	if cat.ParentID != nil && int(*cat.ParentID) == id {
+		h.sendError(w, r, http.StatusUnprocessableEntity, ErrCodeValidation, "Invalid parent_id")
 		return
 	}
 
 	updated, err := h.repo.Update(r.Context(), id, cat)
 	if err != nil {
 		if err == repository.ErrNotFound {
-			h.sendError(w, http.StatusNotFound, "Category not found")
+			h.sendError(w, r, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found")
+			return
+		}
+		if err == repository.ErrNameExists {
+			h.sendError(w, r, http.StatusConflict, ErrCodeDuplicateName, "Category name already exists")
+			return
+		}
+		if err == repository.ErrParentNotFound {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeCategoryNotFound, "Parent category not found")
+			return
+		}
+		if err == repository.ErrParentCycle {
+			h.sendError(w, r, http.StatusUnprocessableEntity, ErrCodeValidation, "Parent would create a cycle")
 			return
 		}
-		h.sendError(w, http.StatusInternalServerError, "Failed to update category")
+		h.sendServerError(w, r, err, "Failed to update category")
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Category updated successfully", updated)
+	h.sendSuccess(w, r, http.StatusOK, "Category updated successfully", updated)
 }
 
-// Delete removes a category
+// Delete removes a category. Its products are left without a category, or
+// with ?reassign_to= moved to that category first in the same transaction.
 func (h *CategoryHandler) Delete(w http.ResponseWriter, r *http.Request, id int) {
-	if err := h.repo.Delete(r.Context(), id); err != nil {
+	var err error
+	if reassignParam := r.URL.Query().Get("reassign_to"); reassignParam != "" {
+		toID, parseErr := models.ParseID(reassignParam)
+		if parseErr != nil || toID <= 0 {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid reassign_to parameter")
+			return
+		}
+		if toID == id {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Cannot reassign products to the category being deleted")
+			return
+		}
+		err = h.repo.DeleteReassigning(r.Context(), id, toID)
+	} else {
+		err = h.repo.Delete(r.Context(), id)
+	}
+
+	if err != nil {
 		if err == repository.ErrNotFound {
-			h.sendError(w, http.StatusNotFound, "Category not found")
+			h.sendError(w, r, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found")
 			return
 		}
-		h.sendError(w, http.StatusInternalServerError, "Failed to delete category")
+		if err == repository.ErrReassignTargetNotFound {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeCategoryNotFound, "Reassign target category not found")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to delete category")
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Category deleted successfully", nil)
+	h.sendSuccess(w, r, http.StatusOK, "Category deleted successfully", nil)
 }
 
-func (h *CategoryHandler) sendSuccess(w http.ResponseWriter, status int, message string, data interface{}) {
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(Response{
-		Success: true,
-		Message: message,
-		Data:    data,
-	})
+// DeleteMany removes the categories listed in ?ids= and reports the outcome
+// per id. Categories that still have products are left in place unless
+// ?force=true, which detaches their products first.
+func (h *CategoryHandler) DeleteMany(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	idsParam := query.Get("ids")
+	if idsParam == "" {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "ids parameter is required")
+		return
+	}
+	ids, err := parseIDList(idsParam, maxBulkIDs)
+	if err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid ids parameter (comma-separated positive IDs, max 100)")
+		return
+	}
+
+	force := false
+	if forceParam := query.Get("force"); forceParam != "" {
+		force, err = strconv.ParseBool(forceParam)
+		if err != nil {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid force parameter (true or false)")
+			return
+		}
+	}
+
+	results, err := h.repo.DeleteMany(r.Context(), ids, force)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to delete categories")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Categories processed", results)
 }
 
-func (h *CategoryHandler) sendError(w http.ResponseWriter, status int, message string) {
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(Response{
-		Success: false,
-		Message: message,
+// UpdateDescriptions sets the descriptions of several categories at once.
+// Unknown ids are skipped and reported; the rest are updated together.
+func (h *CategoryHandler) UpdateDescriptions(w http.ResponseWriter, r *http.Request) {
+	var updates []models.CategoryDescriptionInput
+	if err := decodeJSON(r, &updates); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
+		return
+	}
+
+	if err := validateDescriptionUpdates(updates); err != nil {
+		h.sendValidationError(w, r, err)
+		return
+	}
+
+	updated, skipped, err := h.repo.UpdateDescriptions(r.Context(), updates)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to update categories")
+		return
+	}
+
+	skippedIDs := make([]models.ID, 0, len(skipped))
+	for _, id := range skipped {
+		skippedIDs = append(skippedIDs, models.ID(id))
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Categories updated successfully", map[string]any{
+		"updated": updated,
+		"skipped": skippedIDs,
 	})
 }
 
-func (h *CategoryHandler) methodNotAllowed(w http.ResponseWriter) {
-	h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+// validateDescriptionUpdates trims and checks a description batch. It returns
+// a *validationErrors listing every invalid entry, by index as in
+// [2].description, or nil.
+func validateDescriptionUpdates(updates []models.CategoryDescriptionInput) error {
+	verr := &validationErrors{}
+	if len(updates) == 0 {
+		verr.add("", "Descriptions are required")
+		return verr
+	}
+	if len(updates) > maxBulkIDs {
+		verr.add("", fmt.Sprintf("Too many categories (max %d)", maxBulkIDs))
+		return verr
+	}
+
+	seen := make(map[models.ID]bool, len(updates))
+	for i := range updates {
+		u := &updates[i]
+		switch {
+		case u.ID <= 0:
+			verr.add(fmt.Sprintf("[%d].id", i), "ID must be a positive integer")
+		case seen[u.ID]:
+			verr.add(fmt.Sprintf("[%d].id", i), "Duplicate category ID")
+		}
+		seen[u.ID] = true
+
+		u.Description = strings.TrimSpace(u.Description)
+		if descriptionTooLong(u.Description) {
+			verr.add(fmt.Sprintf("[%d].description", i), fmt.Sprintf("Description too long (max %d characters)", maxDescriptionLength))
+		}
+	}
+	return verr.orNil()
+}
+
+// GetProducts returns every product in a category
+func (h *CategoryHandler) GetProducts(w http.ResponseWriter, r *http.Request, id int) {
+	if _, err := h.repo.GetByID(r.Context(), id); err != nil {
+		if err == repository.ErrNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to retrieve category")
+		return
+	}
+
+	products, err := h.productRepo.GetByCategory(r.Context(), id)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve products")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Products retrieved successfully", products)
+}
+
+// CreateProduct adds a product to a category. The category check and the
+// insert share one transaction, so a failed insert leaves nothing behind. The
+// category comes from the path; any category_id in the body is ignored.
+func (h *CategoryHandler) CreateProduct(w http.ResponseWriter, r *http.Request, id int) {
+	var input models.ProductInput
+	if err := decodeBody(r, &input, func(form url.Values) error {
+		return productInputFromForm(form, &input)
+	}); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
+		return
+	}
+
+	if err := validateProductInput(&input); err != nil {
+		h.sendValidationError(w, r, err)
+		return
+	}
+
+	product := input.ToProduct()
+	product.CreatedBy = requestUser(r)
+
+	created, err := h.productRepo.CreateInCategory(r.Context(), id, product)
+	if err != nil {
+		if err == repository.ErrProductCategoryNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found")
+			return
+		}
+		if err == repository.ErrProductNameExists {
+			h.sendError(w, r, http.StatusConflict, ErrCodeDuplicateName, "Product name already exists")
+			return
+		}
+		if err == repository.ErrProductSKUExists {
+			h.sendError(w, r, http.StatusConflict, ErrCodeDuplicateSKU, "SKU already exists")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to create product")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusCreated, "Product created successfully", created)
+}
+
+// GetLowStock returns products in a category that are at or below the restock threshold
+func (h *CategoryHandler) GetLowStock(w http.ResponseWriter, r *http.Request, id int) {
+	threshold := config.GetLowStockThreshold()
+	if thresholdStr := r.URL.Query().Get("threshold"); thresholdStr != "" {
+		parsed, err := strconv.Atoi(thresholdStr)
+		if err != nil || parsed < 0 {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid threshold parameter")
+			return
+		}
+		threshold = parsed
+	}
+
+	if _, err := h.repo.GetByID(r.Context(), id); err != nil {
+		if err == repository.ErrNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to retrieve category")
+		return
+	}
+
+	products, err := h.productRepo.GetLowStockByCategory(r.Context(), id, threshold)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve products")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Low stock products retrieved successfully", products)
+}
+
+// GetCheapest returns the lowest-priced product in a category
+func (h *CategoryHandler) GetCheapest(w http.ResponseWriter, r *http.Request, id int) {
+	if _, err := h.repo.GetByID(r.Context(), id); err != nil {
+		if err == repository.ErrNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to retrieve category")
+		return
+	}
+
+	product, err := h.productRepo.GetCheapestByCategory(r.Context(), id)
+	if err != nil {
+		if err == repository.ErrProductNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeProductNotFound, "No products in category")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to retrieve product")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Cheapest product retrieved successfully", product)
+}
+
+// SetProductsActive activates or deactivates every product in a category
+func (h *CategoryHandler) SetProductsActive(w http.ResponseWriter, r *http.Request, id int, active bool) {
+	if _, err := h.repo.GetByID(r.Context(), id); err != nil {
+		if err == repository.ErrNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to retrieve category")
+		return
+	}
+
+	updated, err := h.productRepo.SetActiveByCategory(r.Context(), id, active)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to update products")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Products updated successfully", map[string]any{"updated": updated})
+}
+
+func (h *CategoryHandler) sendSuccess(w http.ResponseWriter, r *http.Request, status int, message string, data interface{}) {
+	writeSuccess(w, r, status, message, data, nil)
+}
+
+func (h *CategoryHandler) sendError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeError(w, r, status, code, message)
+}
+
+func (h *CategoryHandler) sendValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	writeValidationError(w, r, err)
+}
+
+func (h *CategoryHandler) sendServerError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	writeServerError(w, r, err, message)
+}
+
+func (h *CategoryHandler) methodNotAllowed(w http.ResponseWriter, r *http.Request, allow string) {
+	writeMethodNotAllowed(w, r, allow)
 }
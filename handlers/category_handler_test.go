@@ -4,9 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/KAnggara75/BelajarGolang/models"
 	"github.com/KAnggara75/BelajarGolang/repository"
@@ -14,14 +21,20 @@ import (
 
 // mockCategoryRepository is a mock implementation of CategoryRepository for testing
 type mockCategoryRepository struct {
+	mu         sync.Mutex
 	categories map[int]models.Category
 	nextID     int
+	// productCounts stands in for the products table in DeleteMany
+	productCounts map[int]int
+	// products, when set, is the product store ReassignProducts moves products in
+	products *mockProductRepository
 }
 
 func newMockCategoryRepository() *mockCategoryRepository {
 	return &mockCategoryRepository{
-		categories: make(map[int]models.Category),
-		nextID:     1,
+		categories:    make(map[int]models.Category),
+		nextID:        1,
+		productCounts: make(map[int]int),
 	}
 }
 
@@ -33,6 +46,30 @@ func (m *mockCategoryRepository) GetAll(ctx context.Context) ([]models.Category,
 	return result, nil
 }
 
+func (m *mockCategoryRepository) GetAllWithCounts(ctx context.Context) ([]models.CategoryWithCount, error) {
+	ids := slices.Sorted(maps.Keys(m.categories))
+	result := make([]models.CategoryWithCount, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, models.CategoryWithCount{Category: m.categories[id], ProductCount: m.productCount(id)})
+	}
+	return result, nil
+}
+
+// productCount counts the products of a category in products when set,
+// otherwise in productCounts
+func (m *mockCategoryRepository) productCount(id int) int {
+	if m.products == nil {
+		return m.productCounts[id]
+	}
+	count := 0
+	for _, p := range m.products.products {
+		if int(p.CategoryID) == id {
+			count++
+		}
+	}
+	return count
+}
+
 func (m *mockCategoryRepository) GetByID(ctx context.Context, id int) (models.Category, error) {
 	cat, exists := m.categories[id]
 	if !exists {
@@ -41,17 +78,31 @@ func (m *mockCategoryRepository) GetByID(ctx context.Context, id int) (models.Ca
 	return cat, nil
 }
 
+func (m *mockCategoryRepository) Count(ctx context.Context) (int, error) {
+	return len(m.categories), nil
+}
+
 func (m *mockCategoryRepository) Create(ctx context.Context, cat models.Category) (models.Category, error) {
-	// Check if name already exists
+	// Hold the lock across check and insert, mirroring the database unique constraint
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check if name already exists, ignoring case like the database index
 	for _, existing := range m.categories {
-		if existing.Name == cat.Name {
+		if strings.EqualFold(existing.Name, cat.Name) {
 			return models.Category{}, repository.ErrNameExists
 		}
 	}
 
-	cat.ID = m.nextID
+	if cat.ParentID != nil {
+		if _, exists := m.categories[int(*cat.ParentID)]; !exists {
+			return models.Category{}, repository.ErrParentNotFound
+		}
+	}
+
+	cat.ID = models.ID(m.nextID)
 	m.nextID++
-	m.categories[cat.ID] = cat
+	m.categories[int(cat.ID)] = cat
 	return cat, nil
 }
 
@@ -60,7 +111,17 @@ func (m *mockCategoryRepository) Update(ctx context.Context, id int, cat models.
 		return models.Category{}, repository.ErrNotFound
 	}
 
-	cat.ID = id
+	// Walk up from the new parent; reaching id would close a loop
+	seen := make(map[models.ID]bool)
+	for parent := cat.ParentID; parent != nil && !seen[*parent]; parent = m.categories[int(*parent)].ParentID {
+		if int(*parent) == id {
+			return models.Category{}, repository.ErrParentCycle
+		}
+		seen[*parent] = true
+	}
+
+	cat.ID = models.ID(id)
+	cat.CreatedBy = m.categories[id].CreatedBy
 	m.categories[id] = cat
 	return cat, nil
 }
@@ -74,6 +135,76 @@ func (m *mockCategoryRepository) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
+func (m *mockCategoryRepository) DeleteReassigning(ctx context.Context, id, toID int) error {
+	if err := m.ReassignProducts(ctx, id, toID); err != nil {
+		return err
+	}
+	return m.Delete(ctx, id)
+}
+
+func (m *mockCategoryRepository) ReassignProducts(ctx context.Context, fromID, toID int) error {
+	if fromID == toID {
+		return repository.ErrReassignSameCategory
+	}
+	if _, exists := m.categories[toID]; !exists {
+		return repository.ErrReassignTargetNotFound
+	}
+	if m.products == nil {
+		return nil
+	}
+	for id, p := range m.products.products {
+		if int(p.CategoryID) == fromID {
+			moved := p
+			moved.CategoryID = models.ID(toID)
+			moved.Version++
+			moved.UpdatedAt = time.Now().UTC()
+			m.products.recordChanges(p, moved)
+			m.products.products[id] = moved
+		}
+	}
+	return nil
+}
+
+func (m *mockCategoryRepository) UpdateDescriptions(ctx context.Context, updates []models.CategoryDescriptionInput) (int, []int, error) {
+	updated, missing := 0, []int{}
+	for _, u := range updates {
+		cat, exists := m.categories[int(u.ID)]
+		if !exists {
+			missing = append(missing, int(u.ID))
+			continue
+		}
+		cat.Description = u.Description
+		m.categories[int(u.ID)] = cat
+		updated++
+	}
+	return updated, missing, nil
+}
+
+func (m *mockCategoryRepository) DeleteMany(ctx context.Context, ids []int, force bool) ([]models.CategoryDeleteResult, error) {
+	results := make([]models.CategoryDeleteResult, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		result := models.CategoryDeleteResult{ID: models.ID(id), ProductCount: m.productCounts[id]}
+		switch _, exists := m.categories[id]; {
+		case !exists:
+			result.Status = models.CategoryNotFound
+		case result.ProductCount > 0 && !force:
+			result.Status = models.CategoryBlocked
+		default:
+			result.Status = models.CategoryDeleted
+			delete(m.categories, id)
+			delete(m.productCounts, id)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // SeedData adds sample data for testing
 func (m *mockCategoryRepository) SeedData() {
 	initialData := []models.Category{
@@ -92,14 +223,24 @@ func (m *mockCategoryRepository) SeedData() {
 // setupTestHandler creates a fresh handler with an empty mock repository for testing
 func setupTestHandler() *CategoryHandler {
 	repo := newMockCategoryRepository()
-	return NewCategoryHandler(repo)
+	return NewCategoryHandler(repo, newMockProductRepository(), "/categories")
 }
 
 // setupTestHandlerWithData creates a handler with seeded data
 func setupTestHandlerWithData() *CategoryHandler {
 	repo := newMockCategoryRepository()
 	repo.SeedData()
-	return NewCategoryHandler(repo)
+	return NewCategoryHandler(repo, newMockProductRepository(), "/categories")
+}
+
+// setupTestHandlerWithProducts creates a handler with seeded categories and products
+func setupTestHandlerWithProducts() *CategoryHandler {
+	repo := newMockCategoryRepository()
+	repo.SeedData()
+	productRepo := newMockProductRepository()
+	productRepo.SeedData()
+	repo.products = productRepo
+	return NewCategoryHandler(repo, productRepo, "/categories")
 }
 
 // TestGetAllCategories_Empty tests GET /categories with empty repo
@@ -167,6 +308,70 @@ func TestGetAllCategories_WithData(t *testing.T) {
 	if len(data) != 5 {
 		t.Errorf("Expected 5 categories, got %d", len(data))
 	}
+
+	// Every category must carry the id clients pass back as category_id
+	seen := make(map[float64]bool)
+	for _, item := range data {
+		id, ok := item.(map[string]any)["id"].(float64)
+		if !ok || id <= 0 {
+			t.Errorf("Expected a positive numeric id, got %v", item)
+			continue
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(data) {
+		t.Errorf("Expected %d distinct ids, got %d", len(data), len(seen))
+	}
+}
+
+// TestGetAllCategories_WithCounts tests GET /categories?with_counts=true
+// reports how many products each category has
+func TestGetAllCategories_WithCounts(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+	products := handler.productRepo.(*mockProductRepository)
+	products.Create(context.Background(), models.Product{Name: "Novel", Price: pricePtr(9.99), CategoryID: 3})
+
+	req := httptest.NewRequest(http.MethodGet, "/categories?with_counts=true", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response struct {
+		Data []models.CategoryWithCount `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := map[models.ID]int{1: 5, 2: 0, 3: 1, 4: 0, 5: 0}
+	if len(response.Data) != len(want) {
+		t.Fatalf("Expected %d categories, got %d", len(want), len(response.Data))
+	}
+	for _, cat := range response.Data {
+		if cat.ProductCount != want[cat.ID] {
+			t.Errorf("Expected category %d to have %d products, got %d", cat.ID, want[cat.ID], cat.ProductCount)
+		}
+	}
+
+	// The default list stays lean
+	for _, url := range []string{"/categories", "/categories?with_counts=false"} {
+		req = httptest.NewRequest(http.MethodGet, url, nil)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if strings.Contains(rec.Body.String(), "product_count") {
+			t.Errorf("%s: expected no product_count, got %s", url, rec.Body.String())
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/categories?with_counts=maybe", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid with_counts, got %d", http.StatusBadRequest, rec.Code)
+	}
 }
 
 // TestGetCategoryByID_Success tests GET /categories/{id} with valid ID
@@ -201,6 +406,10 @@ func TestGetCategoryByID_Success(t *testing.T) {
 		t.Fatalf("Expected data to be an object, got %T", response.Data)
 	}
 
+	if data["id"] != float64(1) {
+		t.Errorf("Expected id 1, got %v", data["id"])
+	}
+
 	if data["name"] != "Electronics" {
 		t.Errorf("Expected name 'Electronics', got '%v'", data["name"])
 	}
@@ -231,6 +440,9 @@ func TestGetCategoryByID_NotFound(t *testing.T) {
 	if response.Message != "Category not found" {
 		t.Errorf("Expected message 'Category not found', got '%s'", response.Message)
 	}
+	if response.Code != ErrCodeCategoryNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeCategoryNotFound, response.Code)
+	}
 }
 
 // TestGetCategoryByID_InvalidID tests GET /categories/{id} with invalid ID
@@ -258,6 +470,48 @@ func TestGetCategoryByID_InvalidID(t *testing.T) {
 	if response.Message != "Invalid category ID" {
 		t.Errorf("Expected message 'Invalid category ID', got '%s'", response.Message)
 	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
+	}
+}
+
+// TestCategoryPaths_Slashes tests that a trailing slash is ignored and an
+// empty path segment is rejected
+func TestCategoryPaths_Slashes(t *testing.T) {
+	tests := []struct {
+		path    string
+		status  int
+		message string
+	}{
+		{"/categories/", http.StatusOK, "Categories retrieved successfully"},
+		{"/categories/tree/", http.StatusOK, "Category tree retrieved successfully"},
+		{"/categories/1/", http.StatusOK, "Category retrieved successfully"},
+		{"/categories//1", http.StatusBadRequest, "Invalid path: empty segment"},
+		{"/categories/1//products", http.StatusBadRequest, "Invalid path: empty segment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			handler := setupTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, response.Message)
+			}
+		})
+	}
 }
 
 // TestCreateCategory_Success tests POST /categories with valid data
@@ -324,8 +578,8 @@ func TestCreateCategory_EmptyName(t *testing.T) {
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
 	}
 
 	var response Response
@@ -337,42 +591,148 @@ func TestCreateCategory_EmptyName(t *testing.T) {
 		t.Error("Expected success to be false")
 	}
 
-	if response.Message != "Name is required" {
-		t.Errorf("Expected message 'Name is required', got '%s'", response.Message)
+	if errorMessage(response) != "Name is required" {
+		t.Errorf("Expected message 'Name is required', got '%s'", errorMessage(response))
+	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
 	}
 }
 
-// TestCreateCategory_DuplicateName tests POST /categories with duplicate name
-func TestCreateCategory_DuplicateName(t *testing.T) {
-	handler := setupTestHandlerWithData()
-
-	category := models.Category{
-		Name:        "Electronics", // Already exists in seed data
-		Description: "Duplicate",
-	}
+// TestCreateCategory_ValidationErrors tests that every invalid field is
+// reported at once, in field order
+func TestCreateCategory_ValidationErrors(t *testing.T) {
+	handler := setupTestHandler()
 
-	body, _ := json.Marshal(category)
-	req := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBuffer(body))
+	body := fmt.Sprintf(`{"name":"","description":%q,"parent_id":-1}`, strings.Repeat("a", maxDescriptionLength+1))
+	req := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusConflict {
-		t.Errorf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
 	}
 
-	var response Response
+	var response struct {
+		Message string `json:"message"`
+		Data    struct {
+			Errors []fieldError `json:"errors"`
+		} `json:"data"`
+	}
 	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
+	if response.Message != "Validation failed" {
+		t.Errorf("Expected message Validation failed, got %q", response.Message)
+	}
+	want := []fieldError{
+		{Field: "name", Message: "Name is required"},
+		{Field: "description", Message: "Description too long (max 2000 characters)"},
+		{Field: "parent_id", Message: "Invalid parent_id"},
+	}
+	if !slices.Equal(response.Data.Errors, want) {
+		t.Errorf("Expected errors %v, got %v", want, response.Data.Errors)
+	}
+}
 
-	if response.Success {
-		t.Error("Expected success to be false")
+// TestCreateCategory_DuplicateName tests POST /categories with a duplicate
+// name, which is matched case-insensitively
+func TestCreateCategory_DuplicateName(t *testing.T) {
+	for _, name := range []string{"Electronics", "electronics", "ELECTRONICS"} {
+		t.Run(name, func(t *testing.T) {
+			handler := setupTestHandlerWithData()
+
+			category := models.Category{
+				Name:        name, // Electronics already exists in seed data
+				Description: "Duplicate",
+			}
+
+			body, _ := json.Marshal(category)
+			req := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusConflict {
+				t.Errorf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if response.Success {
+				t.Error("Expected success to be false")
+			}
+
+			if response.Message != "Category name already exists" {
+				t.Errorf("Expected message 'Category name already exists', got '%s'", response.Message)
+			}
+			if response.Code != ErrCodeDuplicateName {
+				t.Errorf("Expected code %s, got %q", ErrCodeDuplicateName, response.Code)
+			}
+		})
 	}
+}
+
+// TestCategoryNameTrimming tests that names and descriptions are trimmed and
+// whitespace-only names are rejected on create and update
+func TestCategoryNameTrimming(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		body        string
+		status      int
+		wantName    string
+		wantDesc    string
+		wantMessage string
+	}{
+		{"create blank", http.MethodPost, "/categories", `{"name":"   "}`, http.StatusUnprocessableEntity, "", "", "Name is required"},
+		{"create padded", http.MethodPost, "/categories", `{"name":"  Garden  ","description":" Outdoor "}`, http.StatusCreated, "Garden", "Outdoor", ""},
+		{"update blank", http.MethodPut, "/categories/1", `{"name":"\t \n"}`, http.StatusUnprocessableEntity, "", "", "Name is required"},
+		{"update padded", http.MethodPut, "/categories/1", `{"name":"  Gadgets "}`, http.StatusOK, "Gadgets", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockCategoryRepository()
+			repo.SeedData()
+			handler := NewCategoryHandler(repo, newMockProductRepository(), "/categories")
+
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if tt.wantMessage != "" {
+				if errorMessage(response) != tt.wantMessage {
+					t.Errorf("Expected message %q, got %q", tt.wantMessage, errorMessage(response))
+				}
+				return
+			}
 
-	if response.Message != "Category name already exists" {
-		t.Errorf("Expected message 'Category name already exists', got '%s'", response.Message)
+			data := response.Data.(map[string]any)
+			stored := repo.categories[int(data["id"].(float64))]
+			if stored.Name != tt.wantName || stored.Description != tt.wantDesc {
+				t.Errorf("Expected stored name %q and description %q, got %q and %q",
+					tt.wantName, tt.wantDesc, stored.Name, stored.Description)
+			}
+		})
 	}
 }
 
@@ -402,6 +762,9 @@ func TestCreateCategory_InvalidJSON(t *testing.T) {
 	if response.Message != "Invalid request body" {
 		t.Errorf("Expected message 'Invalid request body', got '%s'", response.Message)
 	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
+	}
 }
 
 // TestUpdateCategory_Success tests PUT /categories/{id} with valid data
@@ -442,6 +805,10 @@ func TestUpdateCategory_Success(t *testing.T) {
 		t.Fatalf("Expected data to be an object, got %T", response.Data)
 	}
 
+	if data["id"] != float64(1) {
+		t.Errorf("Expected id 1, got %v", data["id"])
+	}
+
 	if data["name"] != "Updated Electronics" {
 		t.Errorf("Expected name 'Updated Electronics', got '%v'", data["name"])
 	}
@@ -479,6 +846,9 @@ func TestUpdateCategory_NotFound(t *testing.T) {
 	if response.Message != "Category not found" {
 		t.Errorf("Expected message 'Category not found', got '%s'", response.Message)
 	}
+	if response.Code != ErrCodeCategoryNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeCategoryNotFound, response.Code)
+	}
 }
 
 // TestUpdateCategory_EmptyName tests PUT /categories/{id} with empty name
@@ -497,8 +867,8 @@ func TestUpdateCategory_EmptyName(t *testing.T) {
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
 	}
 
 	var response Response
@@ -510,8 +880,11 @@ func TestUpdateCategory_EmptyName(t *testing.T) {
 		t.Error("Expected success to be false")
 	}
 
-	if response.Message != "Name is required" {
-		t.Errorf("Expected message 'Name is required', got '%s'", response.Message)
+	if errorMessage(response) != "Name is required" {
+		t.Errorf("Expected message 'Name is required', got '%s'", errorMessage(response))
+	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
 	}
 }
 
@@ -539,6 +912,67 @@ func TestUpdateCategory_InvalidJSON(t *testing.T) {
 	}
 }
 
+// TestUpdateCategory_SelfParent tests PUT /categories/{id} naming the category as its own parent
+func TestUpdateCategory_SelfParent(t *testing.T) {
+	handler := setupTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodPut, "/categories/1", bytes.NewBufferString(`{"name":"Electronics","parent_id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Message != "Invalid parent_id" {
+		t.Errorf("Expected message 'Invalid parent_id', got '%s'", response.Message)
+	}
+}
+
+// TestUpdateCategory_ParentCycle tests PUT /categories/{id} naming a
+// descendant as the parent, directly or two levels down
+func TestUpdateCategory_ParentCycle(t *testing.T) {
+	handler := setupTestHandlerWithData()
+
+	put := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Clothing under Electronics, then Books under Clothing
+	if rec := put("/categories/2", `{"name":"Clothing","parent_id":1}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec := put("/categories/3", `{"name":"Books","parent_id":2}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	for _, body := range []string{`{"name":"Electronics","parent_id":2}`, `{"name":"Electronics","parent_id":3}`} {
+		rec := put("/categories/1", body)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: expected status %d, got %d", body, http.StatusUnprocessableEntity, rec.Code)
+		}
+
+		var response Response
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Message != "Parent would create a cycle" || response.Code != ErrCodeValidation {
+			t.Errorf("%s: expected %s 'Parent would create a cycle', got %s '%s'", body, ErrCodeValidation, response.Code, response.Message)
+		}
+	}
+}
+
 // TestDeleteCategory_Success tests DELETE /categories/{id} with valid ID
 func TestDeleteCategory_Success(t *testing.T) {
 	handler := setupTestHandlerWithData()
@@ -600,56 +1034,132 @@ func TestDeleteCategory_NotFound(t *testing.T) {
 	if response.Message != "Category not found" {
 		t.Errorf("Expected message 'Category not found', got '%s'", response.Message)
 	}
+	if response.Code != ErrCodeCategoryNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeCategoryNotFound, response.Code)
+	}
 }
 
-// TestMethodNotAllowed_Collection tests unsupported methods on /categories
-func TestMethodNotAllowed_Collection(t *testing.T) {
-	handler := setupTestHandler()
+// TestDeleteCategory_Reassign tests DELETE /categories/{id}?reassign_to= moves
+// the products before deleting the category
+func TestDeleteCategory_Reassign(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+	products := handler.productRepo.(*mockProductRepository)
 
-	unsupportedMethods := []string{http.MethodPut, http.MethodDelete, http.MethodPatch}
+	req := httptest.NewRequest(http.MethodDelete, "/categories/1?reassign_to=2", nil)
+	rec := httptest.NewRecorder()
 
-	for _, method := range unsupportedMethods {
-		t.Run(method, func(t *testing.T) {
-			req := httptest.NewRequest(method, "/categories", nil)
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	for id, p := range products.products {
+		if p.CategoryID != 2 {
+			t.Errorf("Expected product %d moved to category 2, got %d", id, p.CategoryID)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/categories/1", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected deleted category to return %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+// TestDeleteCategory_ReassignRejected tests DELETE /categories/{id}?reassign_to=
+// with an unusable target, leaving the category and its products in place
+func TestDeleteCategory_ReassignRejected(t *testing.T) {
+	tests := []struct {
+		url     string
+		status  int
+		code    string
+		message string
+	}{
+		{"/categories/1?reassign_to=99", http.StatusBadRequest, ErrCodeCategoryNotFound, "Reassign target category not found"},
+		{"/categories/1?reassign_to=1", http.StatusBadRequest, ErrCodeValidation, "Cannot reassign products to the category being deleted"},
+		{"/categories/1?reassign_to=abc", http.StatusBadRequest, ErrCodeValidation, "Invalid reassign_to parameter"},
+		{"/categories/1?reassign_to=0", http.StatusBadRequest, ErrCodeValidation, "Invalid reassign_to parameter"},
+		{"/categories/99?reassign_to=2", http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			handler := setupTestHandlerWithProducts()
+			products := handler.productRepo.(*mockProductRepository)
+
+			req := httptest.NewRequest(http.MethodDelete, tt.url, nil)
 			rec := httptest.NewRecorder()
 
 			handler.ServeHTTP(rec, req)
 
-			if rec.Code != http.StatusMethodNotAllowed {
-				t.Errorf("Expected status %d for method %s, got %d", http.StatusMethodNotAllowed, method, rec.Code)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
 			}
 
 			var response Response
 			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
 				t.Fatalf("Failed to decode response: %v", err)
 			}
-
-			if response.Success {
-				t.Error("Expected success to be false")
+			if response.Code != tt.code || response.Message != tt.message {
+				t.Errorf("Expected %s %q, got %s %q", tt.code, tt.message, response.Code, response.Message)
 			}
 
-			if response.Message != "Method not allowed" {
-				t.Errorf("Expected message 'Method not allowed', got '%s'", response.Message)
+			if _, err := handler.repo.GetByID(context.Background(), 1); err != nil {
+				t.Errorf("Expected category 1 to remain, got %v", err)
+			}
+			for id, p := range products.products {
+				if p.CategoryID != 1 {
+					t.Errorf("Expected product %d to stay in category 1, got %d", id, p.CategoryID)
+				}
 			}
 		})
 	}
 }
 
-// TestMethodNotAllowed_Resource tests unsupported methods on /categories/{id}
-func TestMethodNotAllowed_Resource(t *testing.T) {
-	handler := setupTestHandlerWithData()
-
-	unsupportedMethods := []string{http.MethodPost, http.MethodPatch}
-
-	for _, method := range unsupportedMethods {
-		t.Run(method, func(t *testing.T) {
-			req := httptest.NewRequest(method, "/categories/1", nil)
+// TestDeleteCategories_Bulk tests DELETE /categories?ids= with a mix of empty,
+// non-empty and missing categories
+func TestDeleteCategories_Bulk(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		statuses  map[float64]string
+		remaining []int
+	}{
+		{
+			name:      "blocks categories with products",
+			url:       "/categories?ids=1,2,999",
+			statuses:  map[float64]string{1: "blocked", 2: "deleted", 999: "not_found"},
+			remaining: []int{1},
+		},
+		{
+			name:      "force deletes categories with products",
+			url:       "/categories?ids=1,2&force=true",
+			statuses:  map[float64]string{1: "deleted", 2: "deleted"},
+			remaining: nil,
+		},
+		{
+			name:      "duplicate ids reported once",
+			url:       "/categories?ids=2,2",
+			statuses:  map[float64]string{2: "deleted"},
+			remaining: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockCategoryRepository()
+			repo.SeedData()
+			repo.productCounts[1] = 3
+			handler := NewCategoryHandler(repo, newMockProductRepository(), "/categories")
+
+			req := httptest.NewRequest(http.MethodDelete, tt.url, nil)
 			rec := httptest.NewRecorder()
 
 			handler.ServeHTTP(rec, req)
 
-			if rec.Code != http.StatusMethodNotAllowed {
-				t.Errorf("Expected status %d for method %s, got %d", http.StatusMethodNotAllowed, method, rec.Code)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
 			}
 
 			var response Response
@@ -657,40 +1167,335 @@ func TestMethodNotAllowed_Resource(t *testing.T) {
 				t.Fatalf("Failed to decode response: %v", err)
 			}
 
-			if response.Success {
-				t.Error("Expected success to be false")
+			results, ok := response.Data.([]any)
+			if !ok || len(results) != len(tt.statuses) {
+				t.Fatalf("Expected %d results, got %v", len(tt.statuses), response.Data)
+			}
+			for _, item := range results {
+				result := item.(map[string]any)
+				id := result["id"].(float64)
+				if result["status"] != tt.statuses[id] {
+					t.Errorf("Expected category %v to be %s, got %v", id, tt.statuses[id], result["status"])
+				}
+			}
+
+			for _, id := range []int{1, 2} {
+				_, exists := repo.categories[id]
+				if want := slices.Contains(tt.remaining, id); exists != want {
+					t.Errorf("Expected category %d present=%v, got %v", id, want, exists)
+				}
 			}
 		})
 	}
 }
 
-// TestContentType tests that response has correct Content-Type header
-func TestContentType(t *testing.T) {
-	handler := setupTestHandler()
+// TestDeleteCategories_BulkInvalid tests DELETE /categories parameter validation
+func TestDeleteCategories_BulkInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"missing ids", "/categories"},
+		{"empty element", "/categories?ids=1,,2"},
+		{"non-numeric id", "/categories?ids=1,abc"},
+		{"non-positive id", "/categories?ids=0"},
+		{"invalid force", "/categories?ids=1&force=maybe"},
+	}
 
-	req := httptest.NewRequest(http.MethodGet, "/categories", nil)
-	rec := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupTestHandlerWithData()
 
-	handler.ServeHTTP(rec, req)
+			req := httptest.NewRequest(http.MethodDelete, tt.url, nil)
+			rec := httptest.NewRecorder()
 
-	contentType := rec.Header().Get("Content-Type")
-	if contentType != "application/json" {
-		t.Errorf("Expected Content-Type 'application/json', got '%s'", contentType)
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
 	}
 }
 
-// TestCRUDFlow tests a complete CRUD flow
-func TestCRUDFlow(t *testing.T) {
-	handler := setupTestHandler()
+// TestUpdateCategoryDescriptions tests PATCH /categories/descriptions updates
+// known categories and reports unknown ids
+func TestUpdateCategoryDescriptions(t *testing.T) {
+	repo := newMockCategoryRepository()
+	repo.SeedData()
+	handler := NewCategoryHandler(repo, newMockProductRepository(), "/categories")
 
-	// 1. Create a category
-	createBody, _ := json.Marshal(models.Category{
-		Name:        "Test Category",
-		Description: "Test Description",
-	})
-	createReq := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBuffer(createBody))
-	createReq.Header.Set("Content-Type", "application/json")
-	createRec := httptest.NewRecorder()
+	body := `[{"id":1,"description":"  Phones and laptops "},{"id":3,"description":""},{"id":999,"description":"Ghost"}]`
+	req := httptest.NewRequest(http.MethodPatch, "/categories/descriptions", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	if data["updated"] != float64(2) {
+		t.Errorf("Expected 2 categories updated, got %v", data["updated"])
+	}
+	skipped, ok := data["skipped"].([]any)
+	if !ok || len(skipped) != 1 || skipped[0] != float64(999) {
+		t.Errorf("Expected id 999 to be skipped, got %v", data["skipped"])
+	}
+
+	if got := repo.categories[1].Description; got != "Phones and laptops" {
+		t.Errorf("Expected trimmed description, got %q", got)
+	}
+	if got := repo.categories[3].Description; got != "" {
+		t.Errorf("Expected description to be cleared, got %q", got)
+	}
+}
+
+// TestUpdateCategoryDescriptions_Invalid tests that an invalid entry rejects
+// the whole batch with 422 listing every invalid entry, and that a body that
+// cannot be decoded is a 400
+func TestUpdateCategoryDescriptions_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		errors []fieldError
+	}{
+		{"empty list", `[]`, http.StatusUnprocessableEntity, []fieldError{{"", "Descriptions are required"}}},
+		{"not a list", `{"id":1,"description":"x"}`, http.StatusBadRequest, nil},
+		{"non-positive id", `[{"id":0,"description":"x"}]`, http.StatusUnprocessableEntity, []fieldError{{"[0].id", "ID must be a positive integer"}}},
+		{"duplicate id", `[{"id":1,"description":"x"},{"id":1,"description":"y"}]`, http.StatusUnprocessableEntity, []fieldError{{"[1].id", "Duplicate category ID"}}},
+		{"description too long", `[{"id":1,"description":"ok"},{"id":2,"description":"` + strings.Repeat("x", maxDescriptionLength+1) + `"}]`, http.StatusUnprocessableEntity,
+			[]fieldError{{"[1].description", "Description too long (max 2000 characters)"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockCategoryRepository()
+			repo.SeedData()
+			handler := NewCategoryHandler(repo, newMockProductRepository(), "/categories")
+			before := repo.categories[1].Description
+
+			req := httptest.NewRequest(http.MethodPatch, "/categories/descriptions", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got := responseFieldErrors(t, response); !slices.Equal(got, tt.errors) {
+				t.Errorf("Expected errors %v, got %v", tt.errors, got)
+			}
+			if repo.categories[1].Description != before {
+				t.Error("Expected no category to change on a rejected batch")
+			}
+		})
+	}
+}
+
+// TestCreateCategory_Form tests POST /categories with a form-encoded body
+func TestCreateCategory_Form(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		status  int
+		message string
+	}{
+		{"valid", url.Values{"name": {" Garden "}, "description": {"Plants and tools"}}, http.StatusCreated, "Category created successfully"},
+		{"missing name", url.Values{"description": {"Plants and tools"}}, http.StatusUnprocessableEntity, "Name is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupTestHandler()
+
+			req := httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if errorMessage(response) != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, errorMessage(response))
+			}
+			if tt.status == http.StatusCreated {
+				data := response.Data.(map[string]any)
+				if data["name"] != "Garden" || data["description"] != "Plants and tools" {
+					t.Errorf("Unexpected category: %v", data)
+				}
+			}
+		})
+	}
+}
+
+// TestCreateCategory_DescriptionTooLong tests that create enforces the description cap
+func TestCreateCategory_DescriptionTooLong(t *testing.T) {
+	handler := setupTestHandler()
+
+	body, _ := json.Marshal(models.Category{Name: "Garden", Description: strings.Repeat("é", maxDescriptionLength+1)})
+	req := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+}
+
+// TestCategoryOptions tests that OPTIONS answers 204 with the Allow header
+// for the collection and for a single category
+func TestCategoryOptions(t *testing.T) {
+	handler := setupTestHandler()
+
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{"/categories", "GET, POST, DELETE"},
+		{"/categories/1", "GET, PUT, DELETE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Expected Allow %q, got %q", tt.allow, got)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("Expected an empty body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestMethodNotAllowed_Collection tests unsupported methods on /categories
+func TestMethodNotAllowed_Collection(t *testing.T) {
+	handler := setupTestHandler()
+
+	unsupportedMethods := []string{http.MethodPut, http.MethodPatch}
+
+	for _, method := range unsupportedMethods {
+		t.Run(method, func(t *testing.T) {
+			req := httptest.NewRequest(method, "/categories", nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status %d for method %s, got %d", http.StatusMethodNotAllowed, method, rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != "GET, POST, DELETE" {
+				t.Errorf("Expected Allow 'GET, POST, DELETE', got '%s'", got)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if response.Success {
+				t.Error("Expected success to be false")
+			}
+
+			if response.Message != "Method not allowed" {
+				t.Errorf("Expected message 'Method not allowed', got '%s'", response.Message)
+			}
+			if response.Code != ErrCodeMethodNotAllowed {
+				t.Errorf("Expected code %s, got %q", ErrCodeMethodNotAllowed, response.Code)
+			}
+		})
+	}
+}
+
+// TestMethodNotAllowed_Resource tests unsupported methods on /categories/{id}
+func TestMethodNotAllowed_Resource(t *testing.T) {
+	handler := setupTestHandlerWithData()
+
+	unsupportedMethods := []string{http.MethodPost, http.MethodPatch}
+
+	for _, method := range unsupportedMethods {
+		t.Run(method, func(t *testing.T) {
+			req := httptest.NewRequest(method, "/categories/1", nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status %d for method %s, got %d", http.StatusMethodNotAllowed, method, rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != "GET, PUT, DELETE" {
+				t.Errorf("Expected Allow 'GET, PUT, DELETE', got '%s'", got)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if response.Success {
+				t.Error("Expected success to be false")
+			}
+		})
+	}
+}
+
+// TestContentType tests that response has correct Content-Type header
+func TestContentType(t *testing.T) {
+	handler := setupTestHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	contentType := rec.Header().Get("Content-Type")
+	if contentType != "application/json" {
+		t.Errorf("Expected Content-Type 'application/json', got '%s'", contentType)
+	}
+}
+
+// TestCRUDFlow tests a complete CRUD flow
+func TestCRUDFlow(t *testing.T) {
+	handler := setupTestHandler()
+
+	// 1. Create a category
+	createBody, _ := json.Marshal(models.Category{
+		Name:        "Test Category",
+		Description: "Test Description",
+	})
+	createReq := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBuffer(createBody))
+	createReq.Header.Set("Content-Type", "application/json")
+	createRec := httptest.NewRecorder()
 
 	handler.ServeHTTP(createRec, createReq)
 
@@ -698,8 +1503,19 @@ func TestCRUDFlow(t *testing.T) {
 		t.Fatalf("Create failed: expected status %d, got %d", http.StatusCreated, createRec.Code)
 	}
 
+	var createResponse Response
+	if err := json.NewDecoder(createRec.Body).Decode(&createResponse); err != nil {
+		t.Fatalf("Failed to decode create response: %v", err)
+	}
+
+	id, ok := createResponse.Data.(map[string]any)["id"].(float64)
+	if !ok || id <= 0 {
+		t.Fatalf("Create response missing id: %v", createResponse.Data)
+	}
+	categoryURL := fmt.Sprintf("/categories/%d", int(id))
+
 	// 2. Get the created category
-	getReq := httptest.NewRequest(http.MethodGet, "/categories/1", nil)
+	getReq := httptest.NewRequest(http.MethodGet, categoryURL, nil)
 	getRec := httptest.NewRecorder()
 
 	handler.ServeHTTP(getRec, getReq)
@@ -713,7 +1529,7 @@ func TestCRUDFlow(t *testing.T) {
 		Name:        "Updated Category",
 		Description: "Updated Description",
 	})
-	updateReq := httptest.NewRequest(http.MethodPut, "/categories/1", bytes.NewBuffer(updateBody))
+	updateReq := httptest.NewRequest(http.MethodPut, categoryURL, bytes.NewBuffer(updateBody))
 	updateReq.Header.Set("Content-Type", "application/json")
 	updateRec := httptest.NewRecorder()
 
@@ -724,7 +1540,7 @@ func TestCRUDFlow(t *testing.T) {
 	}
 
 	// 4. Verify the update
-	verifyReq := httptest.NewRequest(http.MethodGet, "/categories/1", nil)
+	verifyReq := httptest.NewRequest(http.MethodGet, categoryURL, nil)
 	verifyRec := httptest.NewRecorder()
 
 	handler.ServeHTTP(verifyRec, verifyReq)
@@ -739,8 +1555,12 @@ func TestCRUDFlow(t *testing.T) {
 		t.Errorf("Update not persisted: expected 'Updated Category', got '%v'", data["name"])
 	}
 
+	if data["id"] != id {
+		t.Errorf("Expected id %v after update, got %v", id, data["id"])
+	}
+
 	// 5. Delete the category
-	deleteReq := httptest.NewRequest(http.MethodDelete, "/categories/1", nil)
+	deleteReq := httptest.NewRequest(http.MethodDelete, categoryURL, nil)
 	deleteRec := httptest.NewRecorder()
 
 	handler.ServeHTTP(deleteRec, deleteReq)
@@ -750,7 +1570,7 @@ func TestCRUDFlow(t *testing.T) {
 	}
 
 	// 6. Verify deletion
-	finalReq := httptest.NewRequest(http.MethodGet, "/categories/1", nil)
+	finalReq := httptest.NewRequest(http.MethodGet, categoryURL, nil)
 	finalRec := httptest.NewRecorder()
 
 	handler.ServeHTTP(finalRec, finalReq)
@@ -759,3 +1579,584 @@ func TestCRUDFlow(t *testing.T) {
 		t.Errorf("Delete not persisted: expected status %d, got %d", http.StatusNotFound, finalRec.Code)
 	}
 }
+
+// TestGetLowStock_Success tests GET /categories/{id}/low-stock with a threshold
+func TestGetLowStock_Success(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/1/low-stock?threshold=40", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data, ok := response.Data.([]any)
+	if !ok {
+		t.Fatalf("Expected data to be an array, got %T", response.Data)
+	}
+	// MacBook Pro M3 (25) and iPad Air (40)
+	if len(data) != 2 {
+		t.Errorf("Expected 2 low stock products, got %d", len(data))
+	}
+}
+
+// TestGetCategoryProducts tests GET /categories/{id}/products for a category
+// with products, an empty category and a missing one
+func TestGetCategoryProducts(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		count  int
+	}{
+		{"with products", "/categories/1/products", http.StatusOK, 5},
+		{"empty category", "/categories/2/products", http.StatusOK, 0},
+		{"missing category", "/categories/999/products", http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupTestHandlerWithProducts()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if tt.status != http.StatusOK {
+				if response.Success || response.Message != "Category not found" {
+					t.Errorf("Expected a Category not found error, got %+v", response)
+				}
+				return
+			}
+
+			data, ok := response.Data.([]any)
+			if !ok {
+				t.Fatalf("Expected data to be an array, got %T", response.Data)
+			}
+			if len(data) != tt.count {
+				t.Errorf("Expected %d products, got %d", tt.count, len(data))
+			}
+			for _, item := range data {
+				if item.(map[string]any)["category_id"] != float64(1) {
+					t.Errorf("Expected only products from category 1, got %v", item)
+				}
+			}
+		})
+	}
+}
+
+// TestCreateCategoryProduct tests POST /categories/{id}/products
+func TestCreateCategoryProduct(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		body    string
+		status  int
+		code    string
+		message string
+	}{
+		{"success", "/categories/2/products", `{"name":"Denim Jacket","price":79.5,"stock":4}`, http.StatusCreated, "", "Product created successfully"},
+		{"path wins over body", "/categories/2/products", `{"name":"Denim Jacket","price":79.5,"category_id":3}`, http.StatusCreated, "", "Product created successfully"},
+		{"missing category", "/categories/999/products", `{"name":"Denim Jacket","price":79.5}`, http.StatusNotFound, ErrCodeCategoryNotFound, "Category not found"},
+		{"duplicate name", "/categories/2/products", `{"name":"iphone 15 pro","price":10}`, http.StatusConflict, ErrCodeDuplicateName, "Product name already exists"},
+		{"invalid input", "/categories/2/products", `{"name":"  ","price":10}`, http.StatusUnprocessableEntity, ErrCodeValidation, "Name is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockCategoryRepository()
+			repo.SeedData()
+			productRepo := newMockProductRepository()
+			productRepo.SeedData()
+			handler := NewCategoryHandler(repo, productRepo, "/categories")
+
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.code || errorMessage(response) != tt.message {
+				t.Errorf("Expected %q %q, got %q %q", tt.code, tt.message, response.Code, errorMessage(response))
+			}
+
+			if tt.status != http.StatusCreated {
+				// A rejected create leaves the catalog unchanged
+				if len(productRepo.products) != 5 {
+					t.Errorf("Expected 5 products, got %d", len(productRepo.products))
+				}
+				return
+			}
+
+			data := response.Data.(map[string]any)
+			if data["category_id"] != float64(2) {
+				t.Errorf("Expected category_id 2, got %v", data["category_id"])
+			}
+			category, ok := data["category"].(map[string]any)
+			if !ok || category["name"] != "Clothing" {
+				t.Errorf("Expected the Clothing category attached, got %v", data["category"])
+			}
+		})
+	}
+}
+
+// TestCountCategories tests GET /categories/count
+func TestCountCategories(t *testing.T) {
+	handler := setupTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/count", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if count := response.Data.(map[string]any)["count"]; count != float64(5) {
+		t.Errorf("Expected count 5, got %v", count)
+	}
+}
+
+// TestGetLowStock_AllStocked tests GET /categories/{id}/low-stock returns an empty array
+func TestGetLowStock_AllStocked(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/2/low-stock", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data, ok := response.Data.([]any)
+	if !ok {
+		t.Fatalf("Expected data to be an array, got %T", response.Data)
+	}
+	if len(data) != 0 {
+		t.Errorf("Expected 0 low stock products, got %d", len(data))
+	}
+}
+
+// TestGetLowStock_CategoryNotFound tests GET /categories/{id}/low-stock for a missing category
+func TestGetLowStock_CategoryNotFound(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/999/low-stock", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+// TestGetLowStock_InvalidThreshold tests GET /categories/{id}/low-stock with a bad threshold
+func TestGetLowStock_InvalidThreshold(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/1/low-stock?threshold=abc", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// TestCreateCategory_ConcurrentDuplicate tests that concurrent creates with the same name yield exactly one success
+func TestCreateCategory_ConcurrentDuplicate(t *testing.T) {
+	handler := setupTestHandler()
+
+	const workers = 20
+	var wg sync.WaitGroup
+	codes := make(chan int, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := []byte(`{"name":"Electronics"}`)
+			req := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			codes <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created, conflicts := 0, 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		default:
+			t.Errorf("Unexpected status %d", code)
+		}
+	}
+
+	if created != 1 {
+		t.Errorf("Expected exactly 1 successful create, got %d", created)
+	}
+	if conflicts != workers-1 {
+		t.Errorf("Expected %d conflicts, got %d", workers-1, conflicts)
+	}
+}
+
+// TestGetCategoryTree tests GET /categories/tree returns nested categories
+func TestGetCategoryTree(t *testing.T) {
+	handler := setupTestHandler()
+
+	for _, body := range []string{
+		`{"name":"Electronics"}`,
+		`{"name":"Phones","parent_id":1}`,
+		`{"name":"Books"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Setup create failed: expected status %d, got %d", http.StatusCreated, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/tree", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	roots, ok := response.Data.([]any)
+	if !ok {
+		t.Fatalf("Expected data to be an array, got %T", response.Data)
+	}
+	if len(roots) != 2 {
+		t.Fatalf("Expected 2 root categories, got %d", len(roots))
+	}
+
+	for _, r := range roots {
+		root := r.(map[string]any)
+		children := root["children"].([]any)
+		if root["name"] == "Electronics" && len(children) != 1 {
+			t.Errorf("Expected Electronics to have 1 child, got %d", len(children))
+		}
+	}
+}
+
+// TestCreateCategory_ParentNotFound tests POST /categories with an unknown parent
+func TestCreateCategory_ParentNotFound(t *testing.T) {
+	handler := setupTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBufferString(`{"name":"Phones","parent_id":42}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// TestDeactivateCategoryProducts tests POST /categories/{id}/deactivate-products and its activate counterpart
+func TestDeactivateCategoryProducts(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+	productRepo := handler.productRepo.(*mockProductRepository)
+
+	for _, tt := range []struct {
+		path   string
+		active bool
+	}{
+		{"/categories/1/deactivate-products", false},
+		{"/categories/1/activate-products", true},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			data := response.Data.(map[string]any)
+			if data["updated"] != float64(5) {
+				t.Errorf("Expected 5 updated, got %v", data["updated"])
+			}
+			for _, p := range productRepo.products {
+				if p.Active != tt.active {
+					t.Errorf("Expected product %d active=%v, got %v", p.ID, tt.active, p.Active)
+				}
+			}
+		})
+	}
+}
+
+// TestDeactivateCategoryProducts_NotFound tests POST /categories/{id}/deactivate-products for a missing category
+func TestDeactivateCategoryProducts_NotFound(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	req := httptest.NewRequest(http.MethodPost, "/categories/999/deactivate-products", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+// TestCreateCategory_CreatedBy tests that created_by comes from X-User and cannot be set in the body
+func TestCreateCategory_CreatedBy(t *testing.T) {
+	handler := setupTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/categories", bytes.NewBufferString(`{"name":"Books","created_by":"mallory"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	if data["created_by"] != "alice" {
+		t.Errorf("Expected created_by 'alice', got '%v'", data["created_by"])
+	}
+}
+
+// TestGetCategoryByID_Include tests GET /categories/{id}?include= with each combination of sections
+func TestGetCategoryByID_Include(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		want    []string
+		absent  []string
+	}{
+		{"breadcrumb only", "breadcrumb", []string{"breadcrumb"}, []string{"product_count", "products"}},
+		{"count only", "count", []string{"product_count"}, []string{"breadcrumb", "products"}},
+		{"all sections", "breadcrumb, count,products", []string{"breadcrumb", "product_count", "products"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupTestHandlerWithProducts()
+
+			req := httptest.NewRequest(http.MethodGet, "/categories/1?include="+url.QueryEscape(tt.include), nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			data := response.Data.(map[string]any)
+			if data["id"] != float64(1) || data["name"] != "Electronics" {
+				t.Errorf("Expected category 1 Electronics, got %v", data)
+			}
+			for _, key := range tt.want {
+				if _, ok := data[key]; !ok {
+					t.Errorf("Expected %q in response", key)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := data[key]; ok {
+					t.Errorf("Expected %q to be omitted", key)
+				}
+			}
+
+			if count, ok := data["product_count"]; ok && count != float64(5) {
+				t.Errorf("Expected product_count 5, got %v", count)
+			}
+			if products, ok := data["products"].([]any); ok && len(products) != 5 {
+				t.Errorf("Expected 5 products, got %d", len(products))
+			}
+			if breadcrumb, ok := data["breadcrumb"].([]any); ok && len(breadcrumb) != 1 {
+				t.Errorf("Expected breadcrumb of 1 category, got %d", len(breadcrumb))
+			}
+		})
+	}
+}
+
+// TestGetCategoryByID_IncludeEmptyProducts tests that an empty product list is still rendered
+func TestGetCategoryByID_IncludeEmptyProducts(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/2?include=products,count", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	if products, ok := data["products"].([]any); !ok || len(products) != 0 {
+		t.Errorf("Expected an empty products array, got %v", data["products"])
+	}
+	if data["product_count"] != float64(0) {
+		t.Errorf("Expected product_count 0, got %v", data["product_count"])
+	}
+}
+
+// TestGetCategoryByID_InvalidInclude tests that unknown include tokens are rejected
+func TestGetCategoryByID_InvalidInclude(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	for _, include := range []string{"children", "count,", "count,bogus"} {
+		req := httptest.NewRequest(http.MethodGet, "/categories/1?include="+url.QueryEscape(include), nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("include=%q: expected status %d, got %d", include, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+// TestGetCategoryByID_IncludeNotFound tests that includes on a missing category return 404
+func TestGetCategoryByID_IncludeNotFound(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/999?include=count", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+// TestGetCheapest_Success tests GET /categories/{id}/cheapest returns the lowest-priced product with its category
+func TestGetCheapest_Success(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	req := httptest.NewRequest(http.MethodGet, "/categories/1/cheapest", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	if data["name"] != "AirPods Pro" {
+		t.Errorf("Expected cheapest product 'AirPods Pro', got '%v'", data["name"])
+	}
+	if data["category"] == nil {
+		t.Error("Expected category to be included")
+	}
+}
+
+// TestGetCheapest_NotFound tests GET /categories/{id}/cheapest for a missing category and an empty one
+func TestGetCheapest_NotFound(t *testing.T) {
+	handler := setupTestHandlerWithProducts()
+
+	tests := []struct {
+		path    string
+		message string
+	}{
+		{"/categories/999/cheapest", "Category not found"},
+		{"/categories/2/cheapest", "No products in category"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", tt.path, http.StatusNotFound, rec.Code)
+		}
+
+		var response Response
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Message != tt.message {
+			t.Errorf("%s: expected message '%s', got '%s'", tt.path, tt.message, response.Message)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+)
+
+// maxCategoryDepth caps tree nesting so corrupt parent links cannot recurse unbounded
+const maxCategoryDepth = 32
+
+// buildCategoryTree nests a flat category list under their parents, preserving
+// input order among siblings. Categories whose parent is missing, or that are
+// only reachable through a cycle, are logged and attached at the root.
+func buildCategoryTree(categories []models.Category) []*models.CategoryNode {
+	nodes := make(map[models.ID]*models.CategoryNode, len(categories))
+	for _, cat := range categories {
+		nodes[cat.ID] = &models.CategoryNode{ID: cat.ID, Name: cat.Name, Children: []*models.CategoryNode{}}
+	}
+
+	children := make(map[models.ID][]*models.CategoryNode)
+	roots := []*models.CategoryNode{}
+	for _, cat := range categories {
+		node := nodes[cat.ID]
+		switch {
+		case cat.ParentID == nil:
+			roots = append(roots, node)
+		case nodes[*cat.ParentID] == nil:
+			log.Printf("WARN: category %d has missing parent %d, attaching to root", cat.ID, *cat.ParentID)
+			roots = append(roots, node)
+		default:
+			children[*cat.ParentID] = append(children[*cat.ParentID], node)
+		}
+	}
+
+	visited := make(map[models.ID]bool, len(categories))
+	var attach func(node *models.CategoryNode, depth int)
+	attach = func(node *models.CategoryNode, depth int) {
+		visited[node.ID] = true
+		if depth >= maxCategoryDepth {
+			if len(children[node.ID]) > 0 {
+				log.Printf("WARN: category tree exceeds max depth %d at category %d, truncating", maxCategoryDepth, node.ID)
+			}
+			return
+		}
+		for _, child := range children[node.ID] {
+			if visited[child.ID] {
+				continue
+			}
+			node.Children = append(node.Children, child)
+			attach(child, depth+1)
+		}
+	}
+
+	for _, root := range roots {
+		attach(root, 1)
+	}
+
+	// Anything still unvisited is part of a parent cycle with no root
+	for _, cat := range categories {
+		if !visited[cat.ID] {
+			log.Printf("WARN: category %d is part of a parent cycle, attaching to root", cat.ID)
+			node := nodes[cat.ID]
+			roots = append(roots, node)
+			attach(node, 1)
+		}
+	}
+
+	return roots
+}
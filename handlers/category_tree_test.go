@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+)
+
+func idPtr(v models.ID) *models.ID {
+	return &v
+}
+
+// TestBuildCategoryTree_Nested tests nesting of children under their parents
+func TestBuildCategoryTree_Nested(t *testing.T) {
+	tree := buildCategoryTree([]models.Category{
+		{ID: 1, Name: "Electronics"},
+		{ID: 2, Name: "Phones", ParentID: idPtr(1)},
+		{ID: 3, Name: "Smartphones", ParentID: idPtr(2)},
+		{ID: 4, Name: "Books"},
+	})
+
+	if len(tree) != 2 {
+		t.Fatalf("Expected 2 roots, got %d", len(tree))
+	}
+	if tree[0].ID != 1 || tree[1].ID != 4 {
+		t.Errorf("Expected roots [1 4], got [%d %d]", tree[0].ID, tree[1].ID)
+	}
+	if len(tree[0].Children) != 1 || tree[0].Children[0].ID != 2 {
+		t.Fatalf("Expected Electronics to have child 2, got %v", tree[0].Children)
+	}
+	if len(tree[0].Children[0].Children) != 1 || tree[0].Children[0].Children[0].ID != 3 {
+		t.Errorf("Expected Phones to have child 3, got %v", tree[0].Children[0].Children)
+	}
+	if tree[1].Children == nil || len(tree[1].Children) != 0 {
+		t.Errorf("Expected Books to have an empty children array, got %v", tree[1].Children)
+	}
+}
+
+// TestBuildCategoryTree_Orphan tests that categories with a missing parent are attached to the root
+func TestBuildCategoryTree_Orphan(t *testing.T) {
+	tree := buildCategoryTree([]models.Category{
+		{ID: 1, Name: "Electronics"},
+		{ID: 2, Name: "Orphan", ParentID: idPtr(99)},
+	})
+
+	if len(tree) != 2 {
+		t.Fatalf("Expected 2 roots, got %d", len(tree))
+	}
+	if tree[1].ID != 2 {
+		t.Errorf("Expected orphan at root, got %d", tree[1].ID)
+	}
+}
+
+// TestBuildCategoryTree_Cycle tests that a parent cycle does not hang or drop categories
+func TestBuildCategoryTree_Cycle(t *testing.T) {
+	tree := buildCategoryTree([]models.Category{
+		{ID: 1, Name: "A", ParentID: idPtr(2)},
+		{ID: 2, Name: "B", ParentID: idPtr(1)},
+	})
+
+	if len(tree) != 1 {
+		t.Fatalf("Expected 1 root, got %d", len(tree))
+	}
+	if len(tree[0].Children) != 1 {
+		t.Errorf("Expected the cycle to be broken into one child, got %d", len(tree[0].Children))
+	}
+}
+
+// TestBuildCategoryTree_MaxDepth tests that nesting is capped
+func TestBuildCategoryTree_MaxDepth(t *testing.T) {
+	categories := []models.Category{{ID: 1, Name: "Level 1"}}
+	for i := 2; i <= maxCategoryDepth+5; i++ {
+		categories = append(categories, models.Category{ID: models.ID(i), Name: "Level", ParentID: idPtr(models.ID(i - 1))})
+	}
+
+	tree := buildCategoryTree(categories)
+
+	depth := 0
+	for node := tree[0]; node != nil; depth++ {
+		if len(node.Children) == 0 {
+			node = nil
+		} else {
+			node = node.Children[0]
+		}
+	}
+	if depth != maxCategoryDepth {
+		t.Errorf("Expected depth %d, got %d", maxCategoryDepth, depth)
+	}
+}
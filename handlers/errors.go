@@ -0,0 +1,18 @@
+package handlers
+
+// Machine-readable error codes sent in the code field of error responses.
+// Clients should switch on these rather than on the English message, which
+// may change.
+const (
+	ErrCodeValidation       = "VALIDATION_ERROR"
+	ErrCodeNotFound         = "NOT_FOUND"
+	ErrCodeProductNotFound  = "PRODUCT_NOT_FOUND"
+	ErrCodeCategoryNotFound = "CATEGORY_NOT_FOUND"
+	ErrCodeDuplicateName    = "DUPLICATE_NAME"
+	ErrCodeDuplicateSKU     = "DUPLICATE_SKU"
+	ErrCodeVersionRequired  = "VERSION_REQUIRED"
+	ErrCodeVersionConflict  = "VERSION_CONFLICT"
+	ErrCodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	ErrCodeInternal         = "INTERNAL_ERROR"
+	ErrCodeTimeout          = "SERVICE_TIMEOUT"
+)
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// healthTimeout bounds the database ping so a hung connection fails the probe
+const healthTimeout = 2 * time.Second
+
+// Pinger is the part of the database connection the health check needs;
+// *pgxpool.Pool satisfies it
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthHandler serves /health for liveness and readiness probes
+type HealthHandler struct {
+	db Pinger
+}
+
+func NewHealthHandler(db Pinger) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+// ServeHTTP reports ok when the database answers a ping within healthTimeout
+// and unavailable with 503 otherwise. The body is never wrapped in the
+// response envelope so probes can rely on its shape.
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	status, body := http.StatusOK, healthStatus{Status: "ok"}
+	if err := h.db.Ping(ctx); err != nil {
+		status, body = http.StatusServiceUnavailable, healthStatus{Status: "unavailable"}
+	}
+
+	w.WriteHeader(status)
+	encodeJSON(w, body)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakePinger reports err from Ping and records whether a deadline was set
+type fakePinger struct {
+	err         error
+	hadDeadline bool
+}
+
+func (p *fakePinger) Ping(ctx context.Context) error {
+	_, p.hadDeadline = ctx.Deadline()
+	return p.err
+}
+
+// TestHealth tests GET /health for a reachable and an unreachable database
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{"database up", nil, http.StatusOK, "ok"},
+		{"database down", errors.New("connection refused"), http.StatusServiceUnavailable, "unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakePinger{err: tt.err}
+			handler := NewHealthHandler(db)
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected Content-Type application/json, got %q", ct)
+			}
+			if !db.hadDeadline {
+				t.Error("Expected the ping to run with a timeout")
+			}
+
+			var body map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(body) != 1 || body["status"] != tt.body {
+				t.Errorf("Expected {\"status\":%q}, got %v", tt.body, body)
+			}
+		})
+	}
+}
+
+// TestHealth_MethodNotAllowed tests that /health only answers GET and HEAD
+func TestHealth_MethodNotAllowed(t *testing.T) {
+	handler := NewHealthHandler(&fakePinger{})
+
+	req := httptest.NewRequest(http.MethodPost, "/health", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
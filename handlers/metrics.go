@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/KAnggara75/BelajarGolang/repository"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CatalogGauges reports how many products and categories exist. The counts
+// are refreshed on an interval rather than per scrape so Prometheus never
+// waits on the database.
+type CatalogGauges struct {
+	productRepo  repository.ProductRepository
+	categoryRepo repository.CategoryRepository
+	products     prometheus.Gauge
+	categories   prometheus.Gauge
+}
+
+// NewCatalogGauges creates the catalog gauges and registers them with reg
+func NewCatalogGauges(reg prometheus.Registerer, productRepo repository.ProductRepository, categoryRepo repository.CategoryRepository) *CatalogGauges {
+	g := &CatalogGauges{
+		productRepo:  productRepo,
+		categoryRepo: categoryRepo,
+		products: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "catalog_products",
+			Help: "Number of products, refreshed periodically.",
+		}),
+		categories: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "catalog_categories",
+			Help: "Number of categories, refreshed periodically.",
+		}),
+	}
+	reg.MustRegister(g.products, g.categories)
+	return g
+}
+
+// Refresh recounts products and categories. A failed count leaves its gauge
+// at the previous value.
+func (g *CatalogGauges) Refresh(ctx context.Context) {
+	if n, err := g.productRepo.Count(ctx, repository.ProductFilter{}); err != nil {
+		slog.Warn("failed to count products for metrics", "error", err)
+	} else {
+		g.products.Set(float64(n))
+	}
+
+	if n, err := g.categoryRepo.Count(ctx); err != nil {
+		slog.Warn("failed to count categories for metrics", "error", err)
+	} else {
+		g.categories.Set(float64(n))
+	}
+}
+
+// Run refreshes the gauges immediately and then every interval until ctx is
+// done
+func (g *CatalogGauges) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		g.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
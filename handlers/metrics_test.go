@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KAnggara75/BelajarGolang/middleware"
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/KAnggara75/BelajarGolang/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestCatalogGauges_Refresh tests that the gauges report the repository counts
+func TestCatalogGauges_Refresh(t *testing.T) {
+	productRepo := newMockProductRepository()
+	productRepo.SeedData()
+	categoryRepo := newMockCategoryRepository()
+	categoryRepo.SeedData()
+
+	gauges := NewCatalogGauges(prometheus.NewRegistry(), productRepo, categoryRepo)
+	gauges.Refresh(context.Background())
+
+	products, _ := productRepo.Count(context.Background(), repository.ProductFilter{})
+	categories, _ := categoryRepo.Count(context.Background())
+
+	if got := testutil.ToFloat64(gauges.products); got != float64(products) {
+		t.Errorf("Expected %d products, got %v", products, got)
+	}
+	if got := testutil.ToFloat64(gauges.categories); got != float64(categories) {
+		t.Errorf("Expected %d categories, got %v", categories, got)
+	}
+}
+
+// TestRequestMetrics_RouteLabels tests that product requests are labelled by
+// route, so opaque ids, malformed ids and unknown sub-resources do not each
+// get their own series, and a missing product counts under its route
+func TestRequestMetrics_RouteLabels(t *testing.T) {
+	models.Configure(models.Settings{OpaqueIDs: true, PriceScale: 2})
+	defer models.Configure(models.DefaultSettings)
+
+	reg := prometheus.NewRegistry()
+	handler := middleware.Timing(setupProductTestHandlerWithData(), time.Hour, middleware.NewRequestMetrics(reg))
+
+	encoded, _ := json.Marshal(models.ID(1))
+	opaque := strings.Trim(string(encoded), `"`)
+	encoded, _ = json.Marshal(models.ID(999))
+	missing := strings.Trim(string(encoded), `"`)
+
+	requests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/products/" + opaque, http.StatusOK},
+		{http.MethodGet, "/products/not-an-id", http.StatusBadRequest},
+		{http.MethodGet, "/products/another-bad-id", http.StatusBadRequest},
+		{http.MethodDelete, "/products/" + opaque + "/history", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/products/garbage/history", http.StatusBadRequest},
+		{http.MethodGet, "/products/garbage/anything", http.StatusBadRequest},
+		{http.MethodGet, "/products/" + opaque + "/anything", http.StatusNotFound},
+		{http.MethodGet, "/products/" + opaque + "/something-else", http.StatusNotFound},
+		{http.MethodGet, "/products/" + missing, http.StatusNotFound},
+		{http.MethodGet, "/products/count", http.StatusOK},
+	}
+	for _, req := range requests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(req.method, req.path, nil))
+		if rec.Code != req.status {
+			t.Fatalf("%s %s: expected status %d, got %d", req.method, req.path, req.status, rec.Code)
+		}
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var paths []string
+	for _, family := range families {
+		if family.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "path" && !slices.Contains(paths, label.GetValue()) {
+					paths = append(paths, label.GetValue())
+				}
+			}
+		}
+	}
+	slices.Sort(paths)
+
+	want := []string{"/products/count", "/products/{id}", "/products/{id}/*", "/products/{id}/history"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("Expected path labels %v, got %v", want, paths)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var (
+	errInvalidPage  = errors.New("invalid page parameter")
+	errInvalidLimit = errors.New("invalid limit parameter")
+)
+
+// PaginationMeta describes the current page of a paginated listing
+type PaginationMeta struct {
+	Page       int             `json:"page"`
+	Limit      int             `json:"limit"`
+	Total      int             `json:"total"`
+	TotalPages int             `json:"total_pages"`
+	Links      PaginationLinks `json:"links"`
+}
+
+// PaginationLinks holds navigation URLs; prev is omitted on the first page
+// and next/last on the final page
+type PaginationLinks struct {
+	First string `json:"first"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// isPaginated reports whether the request asked for a paginated listing
+func isPaginated(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("page") || query.Has("limit")
+}
+
+// parsePagination reads page and limit from the query string, applying defaults
+func parsePagination(r *http.Request) (page, limit int, err error) {
+	page, limit = 1, defaultPageLimit
+	query := r.URL.Query()
+
+	if pageStr := query.Get("page"); pageStr != "" {
+		page, err = strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			return 0, 0, errInvalidPage
+		}
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, errInvalidLimit
+		}
+	}
+
+	return page, limit, nil
+}
+
+// newPaginationMeta builds the page metadata and navigation links from the request URL
+func newPaginationMeta(r *http.Request, page, limit, total int) PaginationMeta {
+	totalPages := (total + limit - 1) / limit
+	if totalPages < 1 {
+		totalPages = 1
+	}
+
+	link := func(p int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(p))
+		query.Set("limit", strconv.Itoa(limit))
+		u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		return u.String()
+	}
+
+	links := PaginationLinks{First: link(1)}
+	if page > 1 {
+		links.Prev = link(min(page-1, totalPages))
+	}
+	if page < totalPages {
+		links.Next = link(page + 1)
+		links.Last = link(totalPages)
+	}
+
+	return PaginationMeta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: totalPages,
+		Links:      links,
+	}
+}
@@ -1,63 +1,177 @@
 package handlers
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/KAnggara75/BelajarGolang/config"
 	"github.com/KAnggara75/BelajarGolang/models"
 	"github.com/KAnggara75/BelajarGolang/repository"
 )
 
+const (
+	// maxBulkIDs caps the number of ids accepted by bulk endpoints
+	maxBulkIDs = 100
+	// maxFilterCategories caps the number of categories in a category_id filter
+	maxFilterCategories = 20
+
+	defaultRecentLimit = 10
+	maxRecentLimit     = 50
+
+	// maxSuggestions caps the names returned by /products/suggest
+	maxSuggestions = 10
+)
+
+// Methods served on the product collection and on a single product, as
+// reported in the Allow header
+const (
+	productCollectionMethods = "GET, POST"
+	productResourceMethods   = "GET, PUT, DELETE"
+)
+
 type ProductHandler struct {
-	repo repository.ProductRepository
+	repo     repository.ProductRepository
+	basePath string
 }
 
-func NewProductHandler(repo repository.ProductRepository) *ProductHandler {
-	return &ProductHandler{repo: repo}
+// NewProductHandler serves the product routes mounted at basePath, such as
+// "/v1/products"
+func NewProductHandler(repo repository.ProductRepository, basePath string) *ProductHandler {
+	return &ProductHandler{repo: repo, basePath: basePath}
 }
 
 func (h *ProductHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	path := strings.TrimPrefix(r.URL.Path, "/products")
-	path = strings.TrimPrefix(path, "/")
-
-	// Check for query parameter to filter by category
-	if path == "" && r.Method == http.MethodGet {
-		categoryIDStr := r.URL.Query().Get("category_id")
-		if categoryIDStr != "" {
-			categoryID, err := strconv.Atoi(categoryIDStr)
-			if err != nil {
-				h.sendError(w, http.StatusBadRequest, "Invalid category_id parameter")
-				return
-			}
-			h.GetByCategory(w, r, categoryID)
-			return
-		}
+	// A trailing slash is ignored, so "/products/" is the collection
+	path, ok := resourcePath(r, h.basePath)
+	if !ok {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid path: empty segment")
+		return
 	}
+	setRoute(r, h.basePath, path)
 
 	if path == "" {
 		// Handle collection routes: GET /products, POST /products
 		switch r.Method {
 		case http.MethodGet:
+			// Filters and pagination go through List; a bare request lists everything
+			if r.URL.RawQuery != "" {
+				h.List(w, r)
+				return
+			}
 			h.GetAll(w, r)
 		case http.MethodPost:
 			h.Create(w, r)
+		case http.MethodOptions:
+			writeOptions(w, productCollectionMethods)
 		default:
-			h.methodNotAllowed(w)
+			h.methodNotAllowed(w, r, productCollectionMethods)
 		}
 		return
 	}
 
-	// Handle single resource routes: GET/PUT/DELETE /products/{id}
-	id, err := strconv.Atoi(path)
+	// Handle named routes before parsing the path as an ID
+	switch path {
+	case "set-active":
+		if r.Method != http.MethodPost {
+			h.methodNotAllowed(w, r, "POST")
+			return
+		}
+		h.SetActive(w, r)
+		return
+	case "recent":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetRecent(w, r)
+		return
+	case "categories":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetUsedCategories(w, r)
+		return
+	case "compare":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.Compare(w, r)
+		return
+	case "search":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.Search(w, r)
+		return
+	case "suggest":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.Suggest(w, r)
+		return
+	case "count":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.Count(w, r)
+		return
+	case "reorder-suggestions":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetReorderSuggestions(w, r)
+		return
+	case "export":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.Export(w, r)
+		return
+	case "import":
+		if r.Method != http.MethodPost {
+			h.methodNotAllowed(w, r, "POST")
+			return
+		}
+		h.Import(w, r)
+		return
+	}
+
+	// Split off an optional sub-resource: /products/{id}/{sub}
+	idPart, sub, _ := strings.Cut(path, "/")
+	setRoute(r, h.basePath, idRoute(""))
+
+	id, err := models.ParseID(idPart)
 	if err != nil {
-		h.sendError(w, http.StatusBadRequest, "Invalid product ID")
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid product ID")
+		return
+	}
+
+	if sub != "" {
+		setRoute(r, h.basePath, idRoute(sub))
+		h.serveSubResource(w, r, id, sub)
 		return
 	}
 
+	// Handle single resource routes: GET/PUT/DELETE /products/{id}
 	switch r.Method {
 	case http.MethodGet:
 		h.GetByID(w, r, id)
@@ -65,157 +179,905 @@ func (h *ProductHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.Update(w, r, id)
 	case http.MethodDelete:
 		h.Delete(w, r, id)
+	case http.MethodOptions:
+		writeOptions(w, productResourceMethods)
 	default:
-		h.methodNotAllowed(w)
+		h.methodNotAllowed(w, r, productResourceMethods)
 	}
 }
 
-// GetAll returns all products
+// serveSubResource handles routes nested under a single product
+func (h *ProductHandler) serveSubResource(w http.ResponseWriter, r *http.Request, id int, sub string) {
+	switch sub {
+	case "move":
+		if r.Method != http.MethodPost {
+			h.methodNotAllowed(w, r, "POST")
+			return
+		}
+		h.Move(w, r, id)
+	case "rank":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetRank(w, r, id)
+	case "history":
+		if r.Method != http.MethodGet {
+			h.methodNotAllowed(w, r, "GET")
+			return
+		}
+		h.GetHistory(w, r, id)
+	default:
+		// Unknown sub-resources share one route so the label stays bounded
+		setRoute(r, h.basePath, idRoute("*"))
+		h.sendError(w, r, http.StatusNotFound, ErrCodeNotFound, "Not found")
+	}
+}
+
+// GetAll returns all products. Categories are not attached; listings only
+// join them when asked with ?expand=category, which goes through List.
 func (h *ProductHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	products, err := h.repo.GetAll(r.Context())
 	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, "Failed to retrieve products")
+		h.sendServerError(w, r, err, "Failed to retrieve products")
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Products retrieved successfully", products)
+	h.sendSuccess(w, r, http.StatusOK, "Products retrieved successfully", products)
 }
 
-// GetByCategory returns products filtered by category
-func (h *ProductHandler) GetByCategory(w http.ResponseWriter, r *http.Request, categoryID int) {
-	products, err := h.repo.GetByCategory(r.Context(), categoryID)
+// exportHeader is the header row of GET /products/export
+var exportHeader = []string{"id", "name", "price", "stock", "category_id", "category_name"}
+
+// Export streams every product as CSV for download. Rows are written as they
+// are read, so a failure after the first row can only cut the file short.
+func (h *ProductHandler) Export(w http.ResponseWriter, r *http.Request) {
+	cw := csv.NewWriter(w)
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+		return cw.Write(exportHeader)
+	}
+
+	err := h.repo.StreamAll(r.Context(), func(p models.Product) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return cw.Write(exportRow(p))
+	})
+	if err == nil && !started {
+		err = start()
+	}
 	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, "Failed to retrieve products")
+		if !started {
+			h.sendServerError(w, r, err, "Failed to export products")
+			return
+		}
+		log.Printf("ERROR: product export interrupted: %v", err)
+	}
+	cw.Flush()
+}
+
+// exportRow renders a product as a CSV row matching exportHeader. IDs and
+// prices are formatted as in JSON; a missing price or category is left blank.
+func exportRow(p models.Product) []string {
+	row := []string{csvValue(p.ID), p.Name, "", strconv.Itoa(p.Stock), "", ""}
+	if p.Price != nil {
+		row[2] = csvValue(*p.Price)
+	}
+	if p.CategoryID > 0 {
+		row[4] = csvValue(p.CategoryID)
+	}
+	if p.Category != nil {
+		row[5] = p.Category.Name
+	}
+	return row
+}
+
+// csvValue renders v the way it appears in JSON responses, without the quotes
+// an opaque id would carry
+func csvValue(v json.Marshaler) string {
+	b, _ := v.MarshalJSON()
+	return strings.Trim(string(b), `"`)
+}
+
+// Import creates products from an uploaded CSV in the format Export writes.
+// Rows are validated and created independently in one transaction; the
+// response counts them and lists each failed row by line. A file that cannot
+// be parsed as CSV is rejected as a whole.
+func (h *ProductHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "text/csv" {
+		h.sendError(w, r, http.StatusUnsupportedMediaType, ErrCodeValidation, "Content-Type must be text/csv")
+		return
+	}
+
+	rows, msg := readImportCSV(r.Body)
+	if msg != "" {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, msg)
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Products retrieved successfully", products)
+
+	result := models.ProductImportResult{Errors: []models.ProductImportError{}}
+	fail := func(line int, message string) {
+		result.Errors = append(result.Errors, models.ProductImportError{Line: line, Error: message})
+	}
+
+	var products []models.Product
+	var lines []int
+	for _, row := range rows {
+		var input models.ProductInput
+		if err := productInputFromForm(row.fields, &input); err != nil {
+			fail(row.line, decodeErrorMessage(err))
+			continue
+		}
+		if err := validateProductInput(&input); err != nil {
+			fail(row.line, err.Error())
+			continue
+		}
+		product := input.ToProduct()
+		product.CreatedBy = requestUser(r)
+		products = append(products, product)
+		lines = append(lines, row.line)
+	}
+
+	if len(products) > 0 {
+		errs, err := h.repo.CreateMany(r.Context(), products)
+		if err != nil {
+			h.sendServerError(w, r, err, "Failed to import products")
+			return
+		}
+		for i, err := range errs {
+			if err != nil {
+				fail(lines[i], importErrorMessage(err))
+				continue
+			}
+			result.Created++
+		}
+	}
+
+	slices.SortFunc(result.Errors, func(a, b models.ProductImportError) int { return a.Line - b.Line })
+	result.Failed = len(result.Errors)
+	h.sendSuccess(w, r, http.StatusOK, "Products imported", result)
+}
+
+// importColumns are the CSV columns Import understands: those of
+// exportHeader, of which id and category_name are ignored, plus description
+var importColumns = append(slices.Clone(exportHeader), "description")
+
+// importRow is a CSV data row keyed by column name
+type importRow struct {
+	line   int
+	fields url.Values
+}
+
+// readImportCSV parses an import file. The header row names the columns, in
+// any order; name is required. It returns a client-facing message, or "" when
+// the file is well formed.
+func readImportCSV(body io.Reader) ([]importRow, string) {
+	reader := csv.NewReader(body)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, "CSV file is empty"
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("Malformed CSV: %v", err)
+	}
+	for i, column := range header {
+		// Spreadsheet exports often start with a byte order mark
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\uFEFF")))
+		if !slices.Contains(importColumns, column) {
+			return nil, fmt.Sprintf("Unknown CSV column %q", column)
+		}
+		header[i] = column
+	}
+	if !slices.Contains(header, "name") {
+		return nil, "CSV header must include a name column"
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Sprintf("Malformed CSV: %v", err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Sprintf("At most %d products can be imported at once", maxImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		fields := make(url.Values, len(header))
+		for i, column := range header {
+			fields.Set(column, record[i])
+		}
+		rows = append(rows, importRow{line: line, fields: fields})
+	}
+
+	if len(rows) == 0 {
+		return nil, "Nothing to import"
+	}
+	return rows, ""
+}
+
+// importErrorMessage maps a CreateMany row error to a client-facing message
+func importErrorMessage(err error) string {
+	switch err {
+	case repository.ErrProductNameExists:
+		return "Product name already exists"
+	case repository.ErrProductSKUExists:
+		return "SKU already exists"
+	case repository.ErrProductCategoryNotFound:
+		return "Category not found"
+	}
+	return "Failed to create product"
+}
+
+// SearchMeta reports whether an unpaginated search hit the result cap
+type SearchMeta struct {
+	Limit     int  `json:"limit"`
+	Truncated bool `json:"truncated"`
 }
 
-// GetByID returns a single product
+// parseCategoryFilter applies a ?category_id= value to filter: a
+// comma-separated list of category IDs, or "none" for products without a
+// category. An empty value leaves filter unchanged.
+func parseCategoryFilter(param string, filter *repository.ProductFilter) error {
+	switch param {
+	case "":
+		return nil
+	case "none":
+		filter.Uncategorized = true
+		return nil
+	}
+	categoryIDs, err := parseIDList(param, maxFilterCategories)
+	if err != nil {
+		return err
+	}
+	filter.CategoryIDs = categoryIDs
+	return nil
+}
+
+// List returns products matching the query filters. When page or limit is
+// given the result is paginated and carries pagination metadata; otherwise
+// a search is capped at SEARCH_MAX_RESULTS and carries SearchMeta.
+// Each product's category is attached only with ?expand=category.
+// ?sort=value orders by price * stock, descending unless ?order=asc, and adds
+// each product's total_value. ?created_after= and ?created_before= bound the
+// creation time inclusively; a bare date means midnight UTC.
+func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
+	var filter repository.ProductFilter
+	query := r.URL.Query()
+
+	if err := parseCategoryFilter(query.Get("category_id"), &filter); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid category_id parameter")
+		return
+	}
+
+	// An empty search matches everything, like a bare GET /products
+	filter.Search = strings.TrimSpace(query.Get("search"))
+
+	var err error
+	if filter.ExpandCategory, err = parseExpandCategory(query.Get("expand")); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid expand parameter (category)")
+		return
+	}
+	if filter.MinPrice, err = parsePriceParam(query.Get("min_price")); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid min_price parameter (must be a non-negative number)")
+		return
+	}
+	if filter.MaxPrice, err = parsePriceParam(query.Get("max_price")); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid max_price parameter (must be a non-negative number)")
+		return
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "min_price cannot be greater than max_price")
+		return
+	}
+
+	if filter.CreatedAfter, err = parseDateParam(query.Get("created_after")); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid created_after parameter (RFC 3339 or YYYY-MM-DD)")
+		return
+	}
+	if filter.CreatedBefore, err = parseDateParam(query.Get("created_before")); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid created_before parameter (RFC 3339 or YYYY-MM-DD)")
+		return
+	}
+	if filter.CreatedAfter != nil && filter.CreatedBefore != nil && filter.CreatedAfter.After(*filter.CreatedBefore) {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "created_after cannot be later than created_before")
+		return
+	}
+
+	if status := query.Get("stock_status"); status != "" {
+		if !slices.Contains(repository.StockStatuses, status) {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid stock_status parameter (out, low or in)")
+			return
+		}
+		filter.StockStatus = status
+		filter.LowStockThreshold = config.GetLowStockThreshold()
+	}
+
+	if sortBy := query.Get("sort"); sortBy != "" {
+		if !slices.Contains(repository.ProductSortFields, sortBy) {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid sort parameter (id, name, price, stock or value)")
+			return
+		}
+		filter.SortBy = sortBy
+	}
+	// Value sorts surface the most valuable stock first unless asked otherwise
+	switch query.Get("order") {
+	case "":
+		filter.SortDesc = filter.SortBy == "value"
+	case "asc":
+	case "desc":
+		filter.SortDesc = true
+	default:
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid order parameter (asc or desc)")
+		return
+	}
+
+	paginated := isPaginated(r)
+	page, limit, err := parsePagination(r)
+	if err != nil {
+		switch err {
+		case errInvalidPage:
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid page parameter")
+		default:
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid limit parameter (1-100)")
+		}
+		return
+	}
+	if paginated {
+		filter.Limit = limit
+		filter.Offset = (page - 1) * limit
+	}
+
+	// Fetch one row past the search cap to tell whether results were cut off
+	searchCap := 0
+	if filter.Search != "" && !paginated {
+		searchCap = config.GetSearchMaxResults()
+		filter.Limit = searchCap + 1
+	}
+
+	products, err := h.repo.List(r.Context(), filter)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve products")
+		return
+	}
+	if filter.SortBy == "value" {
+		for i := range products {
+			products[i].TotalValue = products[i].Value()
+		}
+	}
+
+	if searchCap > 0 {
+		truncated := len(products) > searchCap
+		if truncated {
+			products = products[:searchCap]
+		}
+		h.sendSuccessWithMeta(w, r, http.StatusOK, "Products retrieved successfully", products,
+			SearchMeta{Limit: searchCap, Truncated: truncated})
+		return
+	}
+
+	if !paginated {
+		h.sendSuccess(w, r, http.StatusOK, "Products retrieved successfully", products)
+		return
+	}
+
+	total, err := h.repo.Count(r.Context(), filter)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve products")
+		return
+	}
+	h.sendSuccessWithMeta(w, r, http.StatusOK, "Products retrieved successfully", products,
+		newPaginationMeta(r, page, limit, total))
+}
+
+// Compare returns a field-by-field comparison of the two products in ?ids=
+func (h *ProductHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	idsParam := r.URL.Query().Get("ids")
+	ids, err := parseIDList(idsParam, 2)
+	if idsParam == "" || err != nil || len(ids) != 2 {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "ids must list exactly two product IDs")
+		return
+	}
+
+	var products [2]models.Product
+	for i, id := range ids {
+		products[i], err = h.repo.GetByID(r.Context(), id)
+		if err != nil {
+			if err == repository.ErrProductNotFound {
+				missing := strings.TrimSpace(strings.Split(idsParam, ",")[i])
+				h.sendError(w, r, http.StatusNotFound, ErrCodeProductNotFound, fmt.Sprintf("Product not found: %s", missing))
+				return
+			}
+			h.sendServerError(w, r, err, "Failed to retrieve product")
+			return
+		}
+	}
+
+	h.sendSuccess(w, r, http.StatusOK, "Products compared successfully", compareProducts(products[0], products[1]))
+}
+
+// compareProducts pairs up the client-editable fields of two products
+func compareProducts(a, b models.Product) models.ProductComparison {
+	fields := []struct {
+		name   string
+		values [2]any
+	}{
+		{"name", [2]any{a.Name, b.Name}},
+		{"description", [2]any{a.Description, b.Description}},
+		{"sku", [2]any{a.SKU, b.SKU}},
+		{"price", [2]any{a.Price, b.Price}},
+		{"stock", [2]any{a.Stock, b.Stock}},
+		{"active", [2]any{a.Active, b.Active}},
+		{"category_id", [2]any{a.CategoryID, b.CategoryID}},
+		{"reorder_point", [2]any{a.ReorderPoint, b.ReorderPoint}},
+		{"reorder_qty", [2]any{a.ReorderQty, b.ReorderQty}},
+	}
+
+	comparison := models.ProductComparison{
+		IDs:     [2]models.ID{a.ID, b.ID},
+		Fields:  make(map[string][2]any, len(fields)),
+		Differs: []string{},
+	}
+	for _, f := range fields {
+		comparison.Fields[f.name] = f.values
+		// DeepEqual compares prices by value, not by pointer
+		same := reflect.DeepEqual(f.values[0], f.values[1])
+		if f.name == "price" {
+			// and a decimal by amount, not by how many zeros it carries
+			same = models.PricesEqual(a.Price, b.Price)
+		}
+		if !same {
+			comparison.Differs = append(comparison.Differs, f.name)
+		}
+	}
+	return comparison
+}
+
+// Count returns the number of products, optionally only those in the
+// categories listed in ?category_id=, or without one for ?category_id=none
+func (h *ProductHandler) Count(w http.ResponseWriter, r *http.Request) {
+	var filter repository.ProductFilter
+	if err := parseCategoryFilter(r.URL.Query().Get("category_id"), &filter); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid category_id parameter")
+		return
+	}
+
+	count, err := h.repo.Count(r.Context(), filter)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to count products")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Products counted successfully", map[string]any{"count": count})
+}
+
+// Search returns one page of products whose name contains ?q=, always
+// paginated with the total number of matches in meta
+func (h *ProductHandler) Search(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "q parameter is required")
+		return
+	}
+
+	expand, err := parseExpandCategory(r.URL.Query().Get("expand"))
+	if err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid expand parameter (category)")
+		return
+	}
+
+	page, limit, err := parsePagination(r)
+	if err != nil {
+		switch err {
+		case errInvalidPage:
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid page parameter")
+		default:
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid limit parameter (1-100)")
+		}
+		return
+	}
+
+	filter := repository.ProductFilter{Search: q, Limit: limit, Offset: (page - 1) * limit, ExpandCategory: expand}
+
+	products, err := h.repo.List(r.Context(), filter)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to search products")
+		return
+	}
+
+	total, err := h.repo.Count(r.Context(), filter)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to search products")
+		return
+	}
+	h.sendSuccessWithMeta(w, r, http.StatusOK, "Products retrieved successfully", products,
+		newPaginationMeta(r, page, limit, total))
+}
+
+// Suggest returns up to maxSuggestions product names starting with ?q=, for
+// search box autocomplete. Only names are returned, as a flat array.
+func (h *ProductHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "q parameter is required")
+		return
+	}
+
+	names, err := h.repo.SuggestNames(r.Context(), q, maxSuggestions)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to suggest products")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Suggestions retrieved successfully", names)
+}
+
+// GetRecent returns the most recently added products across the catalog
+func (h *ProductHandler) GetRecent(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRecentLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxRecentLimit {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid limit parameter (1-50)")
+			return
+		}
+		limit = parsed
+	}
+
+	products, err := h.repo.GetRecent(r.Context(), limit)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve products")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Recent products retrieved successfully", products)
+}
+
+// GetReorderSuggestions returns products that have fallen to their reorder
+// point, most urgent first, each carrying its suggested reorder_qty
+func (h *ProductHandler) GetReorderSuggestions(w http.ResponseWriter, r *http.Request) {
+	products, err := h.repo.GetReorderSuggestions(r.Context())
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve reorder suggestions")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Reorder suggestions retrieved successfully", products)
+}
+
+// GetUsedCategories returns only the categories that currently have products
+func (h *ProductHandler) GetUsedCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.repo.GetUsedCategories(r.Context())
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to retrieve categories")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Categories retrieved successfully", categories)
+}
+
+// productWithPath is a product response that also carries its category lineage
+type productWithPath struct {
+	models.Product
+	CategoryPath []models.Category `json:"category_path"`
+}
+
+// GetByID returns a single product. With ?include=category_path the full
+// category lineage (root to leaf) is returned alongside it.
 func (h *ProductHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	includePath := false
+	if include := r.URL.Query().Get("include"); include != "" {
+		if include != "category_path" {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid include parameter")
+			return
+		}
+		includePath = true
+	}
+
 	product, err := h.repo.GetByID(r.Context(), id)
 	if err != nil {
 		if err == repository.ErrProductNotFound {
-			h.sendError(w, http.StatusNotFound, "Product not found")
+			h.sendError(w, r, http.StatusNotFound, ErrCodeProductNotFound, "Product not found")
 			return
 		}
-		h.sendError(w, http.StatusInternalServerError, "Failed to retrieve product")
+		h.sendServerError(w, r, err, "Failed to retrieve product")
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Product retrieved successfully", product)
-}
 
-// Create adds a new product
-func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
-	var input models.ProductInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.sendError(w, http.StatusBadRequest, "Invalid request body")
+	var data any = product
+	if includePath {
+		path := []models.Category{}
+		if product.CategoryID > 0 {
+			path, err = h.repo.GetCategoryPath(r.Context(), int(product.CategoryID))
+			if err != nil {
+				h.sendServerError(w, r, err, "Failed to retrieve category path")
+				return
+			}
+		}
+		data = productWithPath{product, path}
+	}
+
+	// Polling clients send back the ETag and get an empty 304 until the
+	// product changes. The tag leads with the version so it can be sent
+	// unchanged as If-Match on a later PUT.
+	etag := versionedETag(product.Version, data)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	if input.Name == "" {
-		h.sendError(w, http.StatusBadRequest, "Name is required")
+	h.sendSuccess(w, r, http.StatusOK, "Product retrieved successfully", data)
+}
+
+// Create adds a new product. A request carrying an Idempotency-Key already
+// used within the last day returns the product that key created, marked with
+// Idempotent-Replayed: true, instead of creating another; the body of the
+// retry is not compared with the original.
+func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(key) > repository.MaxIdempotencyKeyLength {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation,
+			fmt.Sprintf("Idempotency-Key too long (max %d characters)", repository.MaxIdempotencyKeyLength))
 		return
 	}
 
-	if input.Price < 0 {
-		h.sendError(w, http.StatusBadRequest, "Price cannot be negative")
+	var input models.ProductInput
+	if err := decodeBody(r, &input, func(form url.Values) error {
+		return productInputFromForm(form, &input)
+	}); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
 		return
 	}
 
-	if input.Stock < 0 {
-		h.sendError(w, http.StatusBadRequest, "Stock cannot be negative")
+	if err := validateProductInput(&input); err != nil {
+		h.sendValidationError(w, r, err)
 		return
 	}
 
 	product := input.ToProduct()
+	product.CreatedBy = requestUser(r)
 
-	created, err := h.repo.Create(r.Context(), product)
+	var created models.Product
+	var replayed bool
+	var err error
+	if key == "" {
+		created, err = h.repo.Create(r.Context(), product)
+	} else {
+		created, replayed, err = h.repo.CreateIdempotent(r.Context(), key, product)
+	}
 	if err != nil {
 		if err == repository.ErrProductNameExists {
-			h.sendError(w, http.StatusConflict, "Product name already exists")
+			h.sendError(w, r, http.StatusConflict, ErrCodeDuplicateName, "Product name already exists")
+			return
+		}
+		if err == repository.ErrProductSKUExists {
+			h.sendError(w, r, http.StatusConflict, ErrCodeDuplicateSKU, "SKU already exists")
 			return
 		}
 		if err == repository.ErrProductCategoryNotFound {
-			h.sendError(w, http.StatusBadRequest, "Category not found")
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeCategoryNotFound, "Category not found")
 			return
 		}
-		h.sendError(w, http.StatusInternalServerError, "Failed to create product")
+		h.sendServerError(w, r, err, "Failed to create product")
 		return
 	}
-	h.sendSuccess(w, http.StatusCreated, "Product created successfully", created)
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	h.sendSuccess(w, r, http.StatusCreated, "Product created successfully", created)
 }
 
-// Update updates an existing product
+// Update replaces an existing product. The client names the version it read,
+// via If-Match (the GET ETag or a bare version) or the version field, and gets
+// 409 if the product changed since. If-Match: * accepts any current version.
 func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request, id int) {
 	var input models.ProductInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.sendError(w, http.StatusBadRequest, "Invalid request body")
+	if err := decodeJSON(r, &input); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
 		return
 	}
 
-	if input.Name == "" {
-		h.sendError(w, http.StatusBadRequest, "Name is required")
+	if err := validateProductInput(&input); err != nil {
+		h.sendValidationError(w, r, err)
 		return
 	}
 
-	if input.Price < 0 {
-		h.sendError(w, http.StatusBadRequest, "Price cannot be negative")
+	// Updates are conditional so concurrent writers cannot silently
+	// overwrite each other
+	version, ok, err := requestVersion(r, input.Version)
+	if err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid version (expected a product version, ETag or *)")
 		return
 	}
-
-	if input.Stock < 0 {
-		h.sendError(w, http.StatusBadRequest, "Stock cannot be negative")
+	if !ok {
+		h.sendError(w, r, http.StatusPreconditionRequired, ErrCodeVersionRequired, "Version required: send If-Match or a version field")
 		return
 	}
 
 	product := input.ToProduct()
+	product.Version = version
 
 	updated, err := h.repo.Update(r.Context(), id, product)
 	if err != nil {
 		if err == repository.ErrProductNotFound {
-			h.sendError(w, http.StatusNotFound, "Product not found")
+			h.sendError(w, r, http.StatusNotFound, ErrCodeProductNotFound, "Product not found")
+			return
+		}
+		if err == repository.ErrVersionConflict {
+			h.sendError(w, r, http.StatusConflict, ErrCodeVersionConflict, "Product was modified by another request")
+			return
+		}
+		if err == repository.ErrProductNameExists {
+			h.sendError(w, r, http.StatusConflict, ErrCodeDuplicateName, "Product name already exists")
+			return
+		}
+		if err == repository.ErrProductSKUExists {
+			h.sendError(w, r, http.StatusConflict, ErrCodeDuplicateSKU, "SKU already exists")
+			return
+		}
+		if err == repository.ErrProductCategoryNotFound {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeCategoryNotFound, "Category not found")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to update product")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Product updated successfully", updated)
+}
+
+// Move reassigns a product to another category without touching its other fields
+func (h *ProductHandler) Move(w http.ResponseWriter, r *http.Request, id int) {
+	var input models.MoveInput
+	if err := decodeJSON(r, &input); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
+		return
+	}
+
+	if input.CategoryID <= 0 {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "category_id must be a positive integer")
+		return
+	}
+
+	moved, err := h.repo.MoveToCategory(r.Context(), id, int(input.CategoryID))
+	if err != nil {
+		if err == repository.ErrProductNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeProductNotFound, "Product not found")
 			return
 		}
 		if err == repository.ErrProductCategoryNotFound {
-			h.sendError(w, http.StatusBadRequest, "Category not found")
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeCategoryNotFound, "Category not found")
 			return
 		}
-		h.sendError(w, http.StatusInternalServerError, "Failed to update product")
+		h.sendServerError(w, r, err, "Failed to move product")
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Product updated successfully", updated)
+	h.sendSuccess(w, r, http.StatusOK, "Product moved successfully", moved)
+}
+
+// GetRank returns a product's rank within its category by price (the
+// default) or stock, lowest first
+func (h *ProductHandler) GetRank(w http.ResponseWriter, r *http.Request, id int) {
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "price"
+	}
+	if !slices.Contains(repository.ProductRankFields, by) {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid by parameter (price or stock)")
+		return
+	}
+
+	rank, err := h.repo.GetRank(r.Context(), id, by)
+	if err != nil {
+		if err == repository.ErrProductNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeProductNotFound, "Product not found")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to rank product")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Product rank retrieved successfully", rank)
+}
+
+// GetHistory returns the timeline of recorded changes to a product, oldest first
+func (h *ProductHandler) GetHistory(w http.ResponseWriter, r *http.Request, id int) {
+	history, err := h.repo.GetHistory(r.Context(), id)
+	if err != nil {
+		if err == repository.ErrProductNotFound {
+			h.sendError(w, r, http.StatusNotFound, ErrCodeProductNotFound, "Product not found")
+			return
+		}
+		h.sendServerError(w, r, err, "Failed to retrieve product history")
+		return
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Product history retrieved successfully", history)
 }
 
 // Delete removes a product
 func (h *ProductHandler) Delete(w http.ResponseWriter, r *http.Request, id int) {
 	if err := h.repo.Delete(r.Context(), id); err != nil {
 		if err == repository.ErrProductNotFound {
-			h.sendError(w, http.StatusNotFound, "Product not found")
+			h.sendError(w, r, http.StatusNotFound, ErrCodeProductNotFound, "Product not found")
 			return
 		}
-		h.sendError(w, http.StatusInternalServerError, "Failed to delete product")
+		h.sendServerError(w, r, err, "Failed to delete product")
 		return
 	}
-	h.sendSuccess(w, http.StatusOK, "Product deleted successfully", nil)
+	h.sendSuccess(w, r, http.StatusOK, "Product deleted successfully", nil)
 }
 
-func (h *ProductHandler) sendSuccess(w http.ResponseWriter, status int, message string, data interface{}) {
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(Response{
-		Success: true,
-		Message: message,
-		Data:    data,
+// SetActive toggles the active flag on multiple products
+func (h *ProductHandler) SetActive(w http.ResponseWriter, r *http.Request) {
+	var input models.SetActiveInput
+	if err := decodeJSON(r, &input); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, decodeErrorMessage(err))
+		return
+	}
+
+	if len(input.IDs) == 0 {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "IDs are required")
+		return
+	}
+
+	if len(input.IDs) > maxBulkIDs {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Too many IDs (max 100)")
+		return
+	}
+
+	ids := make([]int, 0, len(input.IDs))
+	for _, id := range input.IDs {
+		if id <= 0 {
+			h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "IDs must be positive integers")
+			return
+		}
+		ids = append(ids, int(id))
+	}
+
+	if input.Active == nil {
+		h.sendError(w, r, http.StatusBadRequest, ErrCodeValidation, "Active is required")
+		return
+	}
+
+	updated, skipped, err := h.repo.SetActive(r.Context(), ids, *input.Active)
+	if err != nil {
+		h.sendServerError(w, r, err, "Failed to update products")
+		return
+	}
+
+	skippedIDs := make([]models.ID, 0, len(skipped))
+	for _, id := range skipped {
+		skippedIDs = append(skippedIDs, models.ID(id))
+	}
+	h.sendSuccess(w, r, http.StatusOK, "Products updated successfully", map[string]any{
+		"updated": updated,
+		"skipped": skippedIDs,
 	})
 }
 
-func (h *ProductHandler) sendError(w http.ResponseWriter, status int, message string) {
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(Response{
-		Success: false,
-		Message: message,
-	})
+func (h *ProductHandler) sendSuccess(w http.ResponseWriter, r *http.Request, status int, message string, data interface{}) {
+	writeSuccess(w, r, status, message, data, nil)
+}
+
+func (h *ProductHandler) sendSuccessWithMeta(w http.ResponseWriter, r *http.Request, status int, message string, data, meta any) {
+	writeSuccess(w, r, status, message, data, meta)
+}
+
+func (h *ProductHandler) sendError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeError(w, r, status, code, message)
+}
+
+func (h *ProductHandler) sendValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	writeValidationError(w, r, err)
+}
+
+func (h *ProductHandler) sendServerError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	writeServerError(w, r, err, message)
 }
 
-func (h *ProductHandler) methodNotAllowed(w http.ResponseWriter) {
-	h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+func (h *ProductHandler) methodNotAllowed(w http.ResponseWriter, r *http.Request, allow string) {
+	writeMethodNotAllowed(w, r, allow)
 }
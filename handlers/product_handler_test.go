@@ -2,21 +2,72 @@ package handlers
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/KAnggara75/BelajarGolang/middleware"
 	"github.com/KAnggara75/BelajarGolang/models"
 	"github.com/KAnggara75/BelajarGolang/repository"
+	"github.com/spf13/viper"
 )
 
+func pricePtr(v float64) *models.Price {
+	p := models.NewPrice(v)
+	return &p
+}
+
 // mockProductRepository is a mock implementation of ProductRepository for testing
 type mockProductRepository struct {
 	products   map[int]models.Product
 	categories map[int]models.Category
 	nextID     int
+	// changes stands in for the price, stock and category history tables,
+	// keyed by product id
+	changes map[int][]models.ProductHistoryEntry
+	// idempotencyKeys stands in for product_idempotency_keys; keys never expire
+	idempotencyKeys map[string]int
+}
+
+// recordChanges appends the history entries an update from old to updated
+// writes, as the repository does
+func (m *mockProductRepository) recordChanges(old, updated models.Product) {
+	if m.changes == nil {
+		m.changes = make(map[int][]models.ProductHistoryEntry)
+	}
+	id := int(updated.ID)
+	if !models.PricesEqual(old.Price, updated.Price) {
+		m.changes[id] = append(m.changes[id], models.ProductHistoryEntry{
+			At: updated.UpdatedAt, Event: models.ProductPriceChanged, OldPrice: old.Price, NewPrice: updated.Price,
+		})
+	}
+	if old.Stock != updated.Stock {
+		m.changes[id] = append(m.changes[id], models.ProductHistoryEntry{
+			At: updated.UpdatedAt, Event: models.ProductStockChanged, OldStock: &old.Stock, NewStock: &updated.Stock,
+		})
+	}
+	if old.CategoryID != updated.CategoryID {
+		entry := models.ProductHistoryEntry{At: updated.UpdatedAt, Event: models.ProductCategoryChanged}
+		if old.CategoryID > 0 {
+			entry.OldCategoryID = &old.CategoryID
+		}
+		if updated.CategoryID > 0 {
+			entry.NewCategoryID = &updated.CategoryID
+		}
+		m.changes[id] = append(m.changes[id], entry)
+	}
 }
 
 func newMockProductRepository() *mockProductRepository {
@@ -30,25 +81,125 @@ func newMockProductRepository() *mockProductRepository {
 func (m *mockProductRepository) GetAll(ctx context.Context) ([]models.Product, error) {
 	result := make([]models.Product, 0, len(m.products))
 	for _, p := range m.products {
-		// Attach category if exists
-		if p.CategoryID > 0 {
-			if cat, ok := m.categories[p.CategoryID]; ok {
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// filtered returns the products matching the filter ordered by ID, ignoring pagination
+func (m *mockProductRepository) filtered(filter repository.ProductFilter) []models.Product {
+	result := make([]models.Product, 0, len(m.products))
+	for _, p := range m.products {
+		if len(filter.CategoryIDs) > 0 && !slices.Contains(filter.CategoryIDs, int(p.CategoryID)) {
+			continue
+		}
+		if filter.Uncategorized && p.CategoryID != 0 {
+			continue
+		}
+		if filter.Search != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(filter.Search)) {
+			continue
+		}
+		if filter.MinPrice != nil && (p.Price == nil || p.Price.InexactFloat64() < *filter.MinPrice) {
+			continue
+		}
+		if filter.MaxPrice != nil && (p.Price == nil || p.Price.InexactFloat64() > *filter.MaxPrice) {
+			continue
+		}
+		if filter.CreatedAfter != nil && p.CreatedAt.Before(*filter.CreatedAfter) {
+			continue
+		}
+		if filter.CreatedBefore != nil && p.CreatedAt.After(*filter.CreatedBefore) {
+			continue
+		}
+		switch {
+		case filter.StockStatus == repository.StockOut && p.Stock != 0,
+			filter.StockStatus == repository.StockLow && (p.Stock <= 0 || p.Stock > filter.LowStockThreshold),
+			filter.StockStatus == repository.StockIn && p.Stock <= filter.LowStockThreshold:
+			continue
+		}
+		if filter.ExpandCategory && p.CategoryID > 0 {
+			if cat, ok := m.categories[int(p.CategoryID)]; ok {
 				p.Category = &cat
 			}
 		}
 		result = append(result, p)
 	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if filter.SortBy != "" && filter.SortBy != "id" {
+		sort.SliceStable(result, func(i, j int) bool {
+			return lessProduct(result[i], result[j], filter.SortBy, filter.SortDesc)
+		})
+	} else if filter.SortDesc {
+		slices.Reverse(result)
+	}
+	return result
+}
+
+// lessProduct orders two products by field like the repository's ORDER BY,
+// with missing prices last in either direction
+func lessProduct(a, b models.Product, field string, desc bool) bool {
+	var cmp int
+	switch field {
+	case "name":
+		cmp = strings.Compare(a.Name, b.Name)
+	case "stock":
+		cmp = a.Stock - b.Stock
+	case "price", "value":
+		x, y := a.Price, b.Price
+		if field == "value" {
+			x, y = a.Value(), b.Value()
+		}
+		if x == nil || y == nil {
+			return x != nil && y == nil
+		}
+		cmp = x.Cmp(y.Decimal)
+	}
+	if desc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func (m *mockProductRepository) List(ctx context.Context, filter repository.ProductFilter) ([]models.Product, error) {
+	result := m.filtered(filter)
+	if filter.Limit > 0 {
+		start := min(filter.Offset, len(result))
+		end := min(start+filter.Limit, len(result))
+		result = result[start:end]
+	}
 	return result, nil
 }
 
+func (m *mockProductRepository) Count(ctx context.Context, filter repository.ProductFilter) (int, error) {
+	return len(m.filtered(filter)), nil
+}
+
+func (m *mockProductRepository) StreamAll(ctx context.Context, fn func(models.Product) error) error {
+	ids := slices.Sorted(maps.Keys(m.products))
+	for _, id := range ids {
+		p := m.products[id]
+		if cat, ok := m.categories[int(p.CategoryID)]; ok {
+			p.Category = &cat
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *mockProductRepository) GetByID(ctx context.Context, id int) (models.Product, error) {
+	// Like a real query, give up once the context is done
+	if err := ctx.Err(); err != nil {
+		return models.Product{}, err
+	}
 	p, exists := m.products[id]
 	if !exists {
 		return models.Product{}, repository.ErrProductNotFound
 	}
 	// Attach category if exists
 	if p.CategoryID > 0 {
-		if cat, ok := m.categories[p.CategoryID]; ok {
+		if cat, ok := m.categories[int(p.CategoryID)]; ok {
 			p.Category = &cat
 		}
 	}
@@ -58,8 +209,8 @@ func (m *mockProductRepository) GetByID(ctx context.Context, id int) (models.Pro
 func (m *mockProductRepository) GetByCategory(ctx context.Context, categoryID int) ([]models.Product, error) {
 	result := make([]models.Product, 0)
 	for _, p := range m.products {
-		if p.CategoryID == categoryID {
-			if cat, ok := m.categories[p.CategoryID]; ok {
+		if int(p.CategoryID) == categoryID {
+			if cat, ok := m.categories[int(p.CategoryID)]; ok {
 				p.Category = &cat
 			}
 			result = append(result, p)
@@ -68,49 +219,302 @@ func (m *mockProductRepository) GetByCategory(ctx context.Context, categoryID in
 	return result, nil
 }
 
+func (m *mockProductRepository) GetLowStockByCategory(ctx context.Context, categoryID, threshold int) ([]models.Product, error) {
+	result := make([]models.Product, 0)
+	for _, p := range m.products {
+		if int(p.CategoryID) == categoryID && p.Stock <= threshold {
+			if cat, ok := m.categories[int(p.CategoryID)]; ok {
+				p.Category = &cat
+			}
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockProductRepository) GetCheapestByCategory(ctx context.Context, categoryID int) (models.Product, error) {
+	var cheapest *models.Product
+	for _, p := range m.filtered(repository.ProductFilter{CategoryIDs: []int{categoryID}}) {
+		if p.Price == nil {
+			continue
+		}
+		if cheapest == nil || p.Price.LessThan(cheapest.Price.Decimal) {
+			cheapest = &p
+		}
+	}
+	if cheapest == nil {
+		return models.Product{}, repository.ErrProductNotFound
+	}
+	if cat, ok := m.categories[categoryID]; ok {
+		cheapest.Category = &cat
+	}
+	return *cheapest, nil
+}
+
+func (m *mockProductRepository) GetRank(ctx context.Context, id int, by string) (models.ProductRank, error) {
+	product, ok := m.products[id]
+	if !ok {
+		return models.ProductRank{}, repository.ErrProductNotFound
+	}
+
+	// value mirrors ORDER BY with NULL prices sorting last
+	value := func(p models.Product) float64 {
+		if by == "stock" {
+			return float64(p.Stock)
+		}
+		if p.Price == nil {
+			return math.Inf(1)
+		}
+		return p.Price.InexactFloat64()
+	}
+
+	rank := models.ProductRank{Rank: 1}
+	for _, p := range m.products {
+		if p.CategoryID != product.CategoryID {
+			continue
+		}
+		rank.Total++
+		if value(p) < value(product) {
+			rank.Rank++
+		}
+	}
+	return rank, nil
+}
+
+func (m *mockProductRepository) GetAnomalies(ctx context.Context) (models.ProductAnomalies, error) {
+	anomalies := models.ProductAnomalies{
+		NonPositivePrice: []models.Product{},
+		ActiveOutOfStock: []models.Product{},
+		BlankName:        []models.Product{},
+	}
+	for _, p := range m.filtered(repository.ProductFilter{}) {
+		if p.Price != nil && !p.Price.IsPositive() {
+			anomalies.NonPositivePrice = append(anomalies.NonPositivePrice, p)
+		}
+		if p.Stock == 0 && p.Active {
+			anomalies.ActiveOutOfStock = append(anomalies.ActiveOutOfStock, p)
+		}
+		if strings.TrimSpace(p.Name) == "" {
+			anomalies.BlankName = append(anomalies.BlankName, p)
+		}
+	}
+	return anomalies, nil
+}
+
+func (m *mockProductRepository) GetRecent(ctx context.Context, limit int) ([]models.Product, error) {
+	// IDs are assigned in insertion order, so they stand in for created_at here
+	result := m.filtered(repository.ProductFilter{ExpandCategory: true})
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (m *mockProductRepository) GetHistory(ctx context.Context, id int) ([]models.ProductHistoryEntry, error) {
+	p, exists := m.products[id]
+	if !exists {
+		return nil, repository.ErrProductNotFound
+	}
+	history := []models.ProductHistoryEntry{{At: p.CreatedAt, Event: models.ProductCreated, By: p.CreatedBy}}
+	if p.CategoryRemovedAt != nil {
+		history = append(history, models.ProductHistoryEntry{At: *p.CategoryRemovedAt, Event: models.ProductCategoryRemoved})
+	}
+	history = append(history, m.changes[id]...)
+	slices.SortStableFunc(history, func(a, b models.ProductHistoryEntry) int { return a.At.Compare(b.At) })
+	return history, nil
+}
+
+func (m *mockProductRepository) GetReorderSuggestions(ctx context.Context) ([]models.Product, error) {
+	// urgency mirrors the repository ordering: stock as a fraction of the reorder point
+	urgency := func(p models.Product) float64 {
+		if p.ReorderPoint == 0 {
+			return 0
+		}
+		return float64(p.Stock) / float64(p.ReorderPoint)
+	}
+
+	result := []models.Product{}
+	for _, p := range m.filtered(repository.ProductFilter{}) {
+		if p.Stock <= p.ReorderPoint && p.ReorderQty > 0 {
+			result = append(result, p)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return urgency(result[i]) < urgency(result[j]) })
+	return result, nil
+}
+
+func (m *mockProductRepository) GetUsedCategories(ctx context.Context) ([]models.CategorySummary, error) {
+	result := []models.CategorySummary{}
+	for id, cat := range m.categories {
+		for _, p := range m.products {
+			if int(p.CategoryID) == id {
+				result = append(result, models.CategorySummary{ID: cat.ID, Name: cat.Name})
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
 func (m *mockProductRepository) CategoryExists(ctx context.Context, categoryID int) (bool, error) {
 	_, exists := m.categories[categoryID]
 	return exists, nil
 }
 
+func (m *mockProductRepository) GetCategoryPath(ctx context.Context, categoryID int) ([]models.Category, error) {
+	path := []models.Category{}
+	for id := categoryID; len(path) < 32; {
+		cat, ok := m.categories[id]
+		if !ok {
+			break
+		}
+		path = append([]models.Category{cat}, path...)
+		if cat.ParentID == nil {
+			break
+		}
+		id = int(*cat.ParentID)
+	}
+	return path, nil
+}
+
 func (m *mockProductRepository) Create(ctx context.Context, p models.Product) (models.Product, error) {
 	// Check if name already exists
 	for _, existing := range m.products {
-		if existing.Name == p.Name {
+		if strings.EqualFold(existing.Name, p.Name) {
 			return models.Product{}, repository.ErrProductNameExists
 		}
+		if p.SKU != "" && existing.SKU == p.SKU {
+			return models.Product{}, repository.ErrProductSKUExists
+		}
 	}
 
 	// Check if category exists (if specified)
 	if p.CategoryID > 0 {
-		if _, exists := m.categories[p.CategoryID]; !exists {
+		if _, exists := m.categories[int(p.CategoryID)]; !exists {
 			return models.Product{}, repository.ErrProductCategoryNotFound
 		}
 	}
 
-	p.ID = m.nextID
+	p.ID = models.ID(m.nextID)
+	p.Active = true
+	p.Version = 1
+	p.CreatedAt = time.Now().UTC()
+	p.UpdatedAt = p.CreatedAt
 	m.nextID++
-	m.products[p.ID] = p
+	m.products[int(p.ID)] = p
 	return p, nil
 }
 
+func (m *mockProductRepository) CreateInCategory(ctx context.Context, categoryID int, p models.Product) (models.Product, error) {
+	cat, exists := m.categories[categoryID]
+	if !exists {
+		return models.Product{}, repository.ErrProductCategoryNotFound
+	}
+
+	p.CategoryID = models.ID(categoryID)
+	created, err := m.Create(ctx, p)
+	if err != nil {
+		return models.Product{}, err
+	}
+	created.Category = &cat
+	return created, nil
+}
+
+func (m *mockProductRepository) CreateMany(ctx context.Context, products []models.Product) ([]error, error) {
+	results := make([]error, len(products))
+	for i, p := range products {
+		_, results[i] = m.Create(ctx, p)
+	}
+	return results, nil
+}
+
+func (m *mockProductRepository) SuggestNames(ctx context.Context, prefix string, limit int) ([]string, error) {
+	names := []string{}
+	for _, p := range m.products {
+		if strings.HasPrefix(strings.ToLower(p.Name), strings.ToLower(prefix)) {
+			names = append(names, p.Name)
+		}
+	}
+	slices.Sort(names)
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	return names, nil
+}
+
+func (m *mockProductRepository) CreateIdempotent(ctx context.Context, key string, p models.Product) (models.Product, bool, error) {
+	if id, ok := m.idempotencyKeys[key]; ok {
+		product, err := m.GetByID(ctx, id)
+		return product, true, err
+	}
+	created, err := m.Create(ctx, p)
+	if err != nil {
+		return models.Product{}, false, err
+	}
+	if m.idempotencyKeys == nil {
+		m.idempotencyKeys = make(map[string]int)
+	}
+	m.idempotencyKeys[key] = int(created.ID)
+	return created, false, nil
+}
+
 func (m *mockProductRepository) Update(ctx context.Context, id int, p models.Product) (models.Product, error) {
 	if _, exists := m.products[id]; !exists {
 		return models.Product{}, repository.ErrProductNotFound
 	}
 
+	for otherID, existing := range m.products {
+		if otherID != id && strings.EqualFold(existing.Name, p.Name) {
+			return models.Product{}, repository.ErrProductNameExists
+		}
+		if otherID != id && p.SKU != "" && existing.SKU == p.SKU {
+			return models.Product{}, repository.ErrProductSKUExists
+		}
+	}
+
 	// Check if category exists (if specified)
 	if p.CategoryID > 0 {
-		if _, exists := m.categories[p.CategoryID]; !exists {
+		if _, exists := m.categories[int(p.CategoryID)]; !exists {
 			return models.Product{}, repository.ErrProductCategoryNotFound
 		}
 	}
 
-	p.ID = id
+	if p.Version != models.AnyVersion && p.Version != m.products[id].Version {
+		return models.Product{}, repository.ErrVersionConflict
+	}
+
+	p.ID = models.ID(id)
+	p.Active = m.products[id].Active
+	p.Version = m.products[id].Version + 1
+	p.CreatedBy = m.products[id].CreatedBy
+	p.CreatedAt = m.products[id].CreatedAt
+	p.UpdatedAt = time.Now().UTC()
+	m.recordChanges(m.products[id], p)
 	m.products[id] = p
 	return p, nil
 }
 
+func (m *mockProductRepository) MoveToCategory(ctx context.Context, id, categoryID int) (models.Product, error) {
+	p, exists := m.products[id]
+	if !exists {
+		return models.Product{}, repository.ErrProductNotFound
+	}
+	if _, exists := m.categories[categoryID]; !exists {
+		return models.Product{}, repository.ErrProductCategoryNotFound
+	}
+
+	moved := p
+	moved.CategoryID = models.ID(categoryID)
+	moved.Version++
+	moved.CategoryRemovedAt = nil
+	moved.UpdatedAt = time.Now().UTC()
+	m.recordChanges(p, moved)
+	m.products[id] = moved
+	return m.GetByID(ctx, id)
+}
+
 func (m *mockProductRepository) Delete(ctx context.Context, id int) error {
 	if _, exists := m.products[id]; !exists {
 		return repository.ErrProductNotFound
@@ -120,6 +524,41 @@ func (m *mockProductRepository) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
+func (m *mockProductRepository) SetActive(ctx context.Context, ids []int, active bool) (int, []int, error) {
+	updated := 0
+	missing := []int{}
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		p, exists := m.products[id]
+		if !exists {
+			missing = append(missing, id)
+			continue
+		}
+		p.Active = active
+		p.Version++
+		m.products[id] = p
+		updated++
+	}
+	return updated, missing, nil
+}
+
+func (m *mockProductRepository) SetActiveByCategory(ctx context.Context, categoryID int, active bool) (int, error) {
+	updated := 0
+	for id, p := range m.products {
+		if int(p.CategoryID) == categoryID {
+			p.Active = active
+			p.Version++
+			m.products[id] = p
+			updated++
+		}
+	}
+	return updated, nil
+}
+
 // SeedCategories adds sample categories for testing
 func (m *mockProductRepository) SeedCategories() {
 	m.categories[1] = models.Category{ID: 1, Name: "Electronics", Description: "Electronic devices"}
@@ -131,11 +570,11 @@ func (m *mockProductRepository) SeedCategories() {
 func (m *mockProductRepository) SeedData() {
 	m.SeedCategories()
 	initialData := []models.Product{
-		{Name: "iPhone 15 Pro", Price: 999.99, Stock: 50, CategoryID: 1},
-		{Name: "MacBook Pro M3", Price: 2499.99, Stock: 25, CategoryID: 1},
-		{Name: "AirPods Pro", Price: 249.99, Stock: 100, CategoryID: 1},
-		{Name: "iPad Air", Price: 599.99, Stock: 40, CategoryID: 1},
-		{Name: "Apple Watch Series 9", Price: 399.99, Stock: 60, CategoryID: 1},
+		{Name: "iPhone 15 Pro", Price: pricePtr(999.99), Stock: 50, CategoryID: 1},
+		{Name: "MacBook Pro M3", Price: pricePtr(2499.99), Stock: 25, CategoryID: 1},
+		{Name: "AirPods Pro", Price: pricePtr(249.99), Stock: 100, CategoryID: 1},
+		{Name: "iPad Air", Price: pricePtr(599.99), Stock: 40, CategoryID: 1},
+		{Name: "Apple Watch Series 9", Price: pricePtr(399.99), Stock: 60, CategoryID: 1},
 	}
 
 	for _, p := range initialData {
@@ -147,14 +586,14 @@ func (m *mockProductRepository) SeedData() {
 func setupProductTestHandler() *ProductHandler {
 	repo := newMockProductRepository()
 	repo.SeedCategories() // Always seed categories
-	return NewProductHandler(repo)
+	return NewProductHandler(repo, "/products")
 }
 
 // setupProductTestHandlerWithData creates a handler with seeded data
 func setupProductTestHandlerWithData() *ProductHandler {
 	repo := newMockProductRepository()
 	repo.SeedData()
-	return NewProductHandler(repo)
+	return NewProductHandler(repo, "/products")
 }
 
 // TestGetAllProducts_Empty tests GET /products with empty repo
@@ -193,42 +632,51 @@ func TestGetAllProducts_Empty(t *testing.T) {
 	}
 }
 
-// TestGetAllProducts_WithData tests GET /products with seeded data
-func TestGetAllProducts_WithData(t *testing.T) {
-	handler := setupProductTestHandlerWithData()
+// TestGetAllProducts_Gzip tests that a large listing behind the gzip
+// middleware decompresses to the full products array
+func TestGetAllProducts_Gzip(t *testing.T) {
+	repo := newMockProductRepository()
+	repo.SeedCategories()
+	for i := range 200 {
+		repo.Create(context.Background(), models.Product{Name: fmt.Sprintf("Product %03d", i), Price: pricePtr(1), Stock: i})
+	}
+	handler := middleware.Gzip(NewProductHandler(repo, "/products"), 1024)
 
-	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req := httptest.NewRequest(http.MethodGet, "/products?sort=name", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", got)
 	}
 
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
 	var response Response
-	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+	if err := json.NewDecoder(gz).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
-
-	if !response.Success {
-		t.Error("Expected success to be true")
-	}
-
-	data, ok := response.Data.([]any)
-	if !ok {
-		t.Fatalf("Expected data to be an array, got %T", response.Data)
+	products, ok := response.Data.([]any)
+	if !ok || len(products) != 200 {
+		t.Fatalf("Expected 200 products, got %v", len(products))
 	}
-	if len(data) != 5 {
-		t.Errorf("Expected 5 products, got %d", len(data))
+	if name := products[0].(map[string]any)["name"]; name != "Product 000" {
+		t.Errorf("Expected Product 000 first, got %v", name)
 	}
 }
 
-// TestGetProductsByCategory tests GET /products?category_id=1
-func TestGetProductsByCategory(t *testing.T) {
+// TestGetAllProducts_WithData tests GET /products with seeded data
+func TestGetAllProducts_WithData(t *testing.T) {
 	handler := setupProductTestHandlerWithData()
 
-	req := httptest.NewRequest(http.MethodGet, "/products?category_id=1", nil)
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
@@ -251,153 +699,360 @@ func TestGetProductsByCategory(t *testing.T) {
 		t.Fatalf("Expected data to be an array, got %T", response.Data)
 	}
 	if len(data) != 5 {
-		t.Errorf("Expected 5 products in category 1, got %d", len(data))
+		t.Errorf("Expected 5 products, got %d", len(data))
 	}
 }
 
-// TestGetProductsByCategory_InvalidCategoryID tests GET /products with invalid category_id
-func TestGetProductsByCategory_InvalidCategoryID(t *testing.T) {
-	handler := setupProductTestHandlerWithData()
+// TestExportProducts tests GET /products/export
+func TestExportProducts(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler *ProductHandler
+		rows    int
+	}{
+		{"with data", setupProductTestHandlerWithData(), 5},
+		{"empty", setupProductTestHandler(), 0},
+	}
 
-	req := httptest.NewRequest(http.MethodGet, "/products?category_id=abc", nil)
-	rec := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products/export", nil)
+			rec := httptest.NewRecorder()
 
-	handler.ServeHTTP(rec, req)
+			tt.handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
-	}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+				t.Errorf("Expected a CSV content type, got %q", got)
+			}
+			if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="products.csv"` {
+				t.Errorf("Expected an attachment disposition, got %q", got)
+			}
 
-	var response Response
-	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
-		t.Fatalf("Failed to decode response: %v", err)
+			records, err := csv.NewReader(rec.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("Failed to parse CSV: %v", err)
+			}
+			if len(records) != tt.rows+1 {
+				t.Fatalf("Expected a header and %d rows, got %d records", tt.rows, len(records))
+			}
+			if want := []string{"id", "name", "price", "stock", "category_id", "category_name"}; !slices.Equal(records[0], want) {
+				t.Errorf("Expected header %v, got %v", want, records[0])
+			}
+			if tt.rows == 0 {
+				return
+			}
+			if want := []string{"1", "iPhone 15 Pro", "999.99", "50", "1", "Electronics"}; !slices.Equal(records[1], want) {
+				t.Errorf("Expected first row %v, got %v", want, records[1])
+			}
+		})
 	}
+}
 
-	if response.Success {
-		t.Error("Expected success to be false")
+// TestImportProducts tests POST /products/import
+func TestImportProducts(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		created int
+		errors  []models.ProductImportError
+	}{
+		{
+			name: "clean",
+			body: "id,name,price,stock,category_id,category_name\n" +
+				",Denim Jacket,79.50,4,2,Clothing\n" +
+				",Go Programming,39.99,12,3,Books\n",
+			created: 2,
+			errors:  []models.ProductImportError{},
+		},
+		{
+			name: "bad rows in the middle",
+			body: "name,price,stock,category_id\n" +
+				"Denim Jacket,79.50,4,2\n" +
+				"iPhone 15 Pro,10,1,1\n" +
+				"Atlas,12,1,99\n" +
+				"Mug,cheap,1,\n" +
+				"Go Programming,39.99,12,3\n",
+			created: 2,
+			errors: []models.ProductImportError{
+				{Line: 3, Error: "Product name already exists"},
+				{Line: 4, Error: "Category not found"},
+				{Line: 5, Error: "Invalid price: must be a number"},
+			},
+		},
 	}
 
-	if response.Message != "Invalid category_id parameter" {
-		t.Errorf("Expected message 'Invalid category_id parameter', got '%s'", response.Message)
-	}
-}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockProductRepository()
+			repo.SeedCategories()
+			_, _ = repo.Create(context.Background(), models.Product{Name: "iPhone 15 Pro", Price: pricePtr(999.99), CategoryID: 1})
+			handler := NewProductHandler(repo, "/products")
 
-// TestGetProductByID_Success tests GET /products/{id} with valid ID
-func TestGetProductByID_Success(t *testing.T) {
-	handler := setupProductTestHandlerWithData()
+			req := httptest.NewRequest(http.MethodPost, "/products/import", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "text/csv")
+			rec := httptest.NewRecorder()
 
-	req := httptest.NewRequest(http.MethodGet, "/products/1", nil)
-	rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
 
-	handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
 
-	if rec.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			var response struct {
+				Data models.ProductImportResult `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Data.Created != tt.created || response.Data.Failed != len(tt.errors) {
+				t.Errorf("Expected %d created and %d failed, got %+v", tt.created, len(tt.errors), response.Data)
+			}
+			if !slices.Equal(response.Data.Errors, tt.errors) {
+				t.Errorf("Expected errors %v, got %v", tt.errors, response.Data.Errors)
+			}
+			if len(repo.products) != 1+tt.created {
+				t.Errorf("Expected %d stored products, got %d", 1+tt.created, len(repo.products))
+			}
+		})
 	}
+}
 
-	var response Response
-	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
-		t.Fatalf("Failed to decode response: %v", err)
+// TestImportProducts_Rejected tests uploads rejected as a whole
+func TestImportProducts_Rejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{
+		{"not csv", "application/json", `{"name":"Mug"}`, http.StatusUnsupportedMediaType, "Content-Type must be text/csv"},
+		{"bare quote", "text/csv", "name,price\nMu\"g,1\n", http.StatusBadRequest, `Malformed CSV: parse error on line 2, column 3: bare " in non-quoted-field`},
+		{"field count", "text/csv", "name,price\nMug,1,extra\n", http.StatusBadRequest, "Malformed CSV: record on line 2: wrong number of fields"},
+		{"unknown column", "text/csv", "name,colour\nMug,red\n", http.StatusBadRequest, `Unknown CSV column "colour"`},
+		{"no name column", "text/csv", "price,stock\n1,2\n", http.StatusBadRequest, "CSV header must include a name column"},
+		{"header only", "text/csv", "name,price\n", http.StatusBadRequest, "Nothing to import"},
+		{"empty", "text/csv", "", http.StatusBadRequest, "CSV file is empty"},
 	}
 
-	if !response.Success {
-		t.Error("Expected success to be true")
-	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockProductRepository()
+			handler := NewProductHandler(repo, "/products")
 
-	if response.Message != "Product retrieved successfully" {
-		t.Errorf("Expected message 'Product retrieved successfully', got '%s'", response.Message)
-	}
+			req := httptest.NewRequest(http.MethodPost, "/products/import", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
 
-	// Check product data
-	data, ok := response.Data.(map[string]any)
-	if !ok {
-		t.Fatalf("Expected data to be an object, got %T", response.Data)
-	}
+			handler.ServeHTTP(rec, req)
 
-	if data["name"] != "iPhone 15 Pro" {
-		t.Errorf("Expected name 'iPhone 15 Pro', got '%v'", data["name"])
-	}
-
-	// Check category is included
-	if data["category"] == nil {
-		t.Error("Expected category to be included")
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, response.Message)
+			}
+			if len(repo.products) != 0 {
+				t.Errorf("Expected nothing stored, got %d products", len(repo.products))
+			}
+		})
 	}
 }
 
-// TestGetProductByID_NotFound tests GET /products/{id} with non-existent ID
-func TestGetProductByID_NotFound(t *testing.T) {
-	handler := setupProductTestHandler()
+// TestImportProducts_ExportRoundTrip tests that an export can be imported
+// into an empty catalog
+func TestImportProducts_ExportRoundTrip(t *testing.T) {
+	exportRec := httptest.NewRecorder()
+	setupProductTestHandlerWithData().ServeHTTP(exportRec, httptest.NewRequest(http.MethodGet, "/products/export", nil))
 
-	req := httptest.NewRequest(http.MethodGet, "/products/999", nil)
+	repo := newMockProductRepository()
+	repo.SeedCategories()
+	handler := NewProductHandler(repo, "/products")
+
+	req := httptest.NewRequest(http.MethodPost, "/products/import", exportRec.Body)
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusNotFound {
-		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
 	}
+	if len(repo.products) != 5 {
+		t.Errorf("Expected 5 imported products, got %d", len(repo.products))
+	}
+	if p := repo.products[1]; p.Name != "iPhone 15 Pro" || !models.PricesEqual(p.Price, pricePtr(999.99)) || p.Stock != 50 || p.CategoryID != 1 {
+		t.Errorf("Expected the iPhone imported unchanged, got %+v", p)
+	}
+}
 
-	var response Response
-	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
-		t.Fatalf("Failed to decode response: %v", err)
+// TestProductValidationErrors tests that create and update report every
+// invalid field at once, in field order
+func TestProductValidationErrors(t *testing.T) {
+	body := `{"name":"  ","sku":"bad sku!","price":-1,"stock":-2,"reorder_qty":-3,"version":1}`
+	want := []fieldError{
+		{Field: "name", Message: "Name is required"},
+		{Field: "sku", Message: "SKU must contain only letters, digits and dashes (max 64 characters)"},
+		{Field: "price", Message: "Price cannot be negative"},
+		{Field: "stock", Message: "Stock cannot be negative"},
+		{Field: "reorder_qty", Message: "Reorder quantity cannot be negative"},
 	}
 
-	if response.Success {
-		t.Error("Expected success to be false")
+	tests := []struct {
+		name   string
+		method string
+		target string
+	}{
+		{"create", http.MethodPost, "/products"},
+		{"update", http.MethodPut, "/products/1"},
 	}
 
-	if response.Message != "Product not found" {
-		t.Errorf("Expected message 'Product not found', got '%s'", response.Message)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(tt.method, tt.target, bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+			}
+
+			var response struct {
+				Message string `json:"message"`
+				Code    string `json:"code"`
+				Data    struct {
+					Errors []fieldError `json:"errors"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != "Validation failed" || response.Code != ErrCodeValidation {
+				t.Errorf("Expected %s \"Validation failed\", got %s %q", ErrCodeValidation, response.Code, response.Message)
+			}
+			if !slices.Equal(response.Data.Errors, want) {
+				t.Errorf("Expected errors %v, got %v", want, response.Data.Errors)
+			}
+		})
 	}
 }
 
-// TestGetProductByID_InvalidID tests GET /products/{id} with invalid ID
-func TestGetProductByID_InvalidID(t *testing.T) {
+// TestProductValidationErrors_Bare tests that clients without the envelope
+// get the field errors in the bare error body
+func TestProductValidationErrors_Bare(t *testing.T) {
 	handler := setupProductTestHandler()
 
-	req := httptest.NewRequest(http.MethodGet, "/products/abc", nil)
+	req := httptest.NewRequest(http.MethodPost, "/products?envelope=false", bytes.NewBufferString(`{"name":"","price":-5}`))
+	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
 	}
 
-	var response Response
+	var response bareError
 	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
+	want := []fieldError{
+		{Field: "name", Message: "Name is required"},
+		{Field: "price", Message: "Price cannot be negative"},
+	}
+	if response.Error != "Validation failed" || !slices.Equal(response.Errors, want) {
+		t.Errorf("Expected Validation failed with %v, got %+v", want, response)
+	}
+}
 
-	if response.Success {
-		t.Error("Expected success to be false")
+// TestListProducts_ExpandCategory tests that categories are attached only
+// with ?expand=category
+func TestListProducts_ExpandCategory(t *testing.T) {
+	tests := []struct {
+		url    string
+		expand bool
+	}{
+		{"/products", false},
+		{"/products?category_id=1", false},
+		{"/products?expand=category", true},
+		{"/products?category_id=1&expand=category", true},
+		{"/products/search?q=i&expand=category", true},
+		{"/products/search?q=i", false},
 	}
 
-	if response.Message != "Invalid product ID" {
-		t.Errorf("Expected message 'Invalid product ID', got '%s'", response.Message)
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			data := response.Data.([]any)
+			if len(data) == 0 {
+				t.Fatal("Expected at least one product")
+			}
+			for _, item := range data {
+				product := item.(map[string]any)
+				if product["category_id"] == nil {
+					continue
+				}
+				if _, has := product["category"]; has != tt.expand {
+					t.Errorf("Expected category present=%v, got %v", tt.expand, product["category"])
+				}
+			}
+		})
 	}
 }
 
-// TestCreateProduct_Success tests POST /products with valid data including category
-func TestCreateProduct_Success(t *testing.T) {
-	handler := setupProductTestHandler()
+// TestListProducts_InvalidExpand tests that unknown expand values are rejected
+func TestListProducts_InvalidExpand(t *testing.T) {
+	for _, url := range []string{"/products?expand=owner", "/products?expand=category,", "/products/search?q=i&expand=tags"} {
+		handler := setupProductTestHandlerWithData()
 
-	product := models.ProductInput{
-		Name:       "Test Product",
-		Price:      99.99,
-		Stock:      10,
-		CategoryID: 1, // Electronics
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", url, http.StatusBadRequest, rec.Code)
+		}
 	}
+}
 
-	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
+// TestGetProductsByCategory tests GET /products?category_id=1
+func TestGetProductsByCategory(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products?category_id=1", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusCreated {
-		t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
 	}
 
 	var response Response
@@ -409,41 +1064,89 @@ func TestCreateProduct_Success(t *testing.T) {
 		t.Error("Expected success to be true")
 	}
 
-	if response.Message != "Product created successfully" {
-		t.Errorf("Expected message 'Product created successfully', got '%s'", response.Message)
-	}
-
-	// Check response data
-	data, ok := response.Data.(map[string]any)
+	data, ok := response.Data.([]any)
 	if !ok {
-		t.Fatalf("Expected data to be an object, got %T", response.Data)
+		t.Fatalf("Expected data to be an array, got %T", response.Data)
 	}
-
-	if data["name"] != "Test Product" {
-		t.Errorf("Expected name 'Test Product', got '%v'", data["name"])
+	if len(data) != 5 {
+		t.Errorf("Expected 5 products in category 1, got %d", len(data))
 	}
 }
 
-// TestCreateProduct_InvalidCategory tests POST /products with non-existent category
-func TestCreateProduct_InvalidCategory(t *testing.T) {
-	handler := setupProductTestHandler()
+// TestListProducts_CreatedRange tests GET /products?created_after=&created_before=
+func TestListProducts_CreatedRange(t *testing.T) {
+	repo := newMockProductRepository()
+	for i, created := range []string{"2023-12-31T23:59:59Z", "2024-01-01T00:00:00Z", "2024-01-15T12:00:00Z", "2024-02-01T00:00:00Z", "2024-02-01T00:00:01Z"} {
+		at, _ := time.Parse(time.RFC3339, created)
+		repo.products[i+1] = models.Product{ID: models.ID(i + 1), Name: created, CreatedAt: at}
+	}
+	handler := NewProductHandler(repo, "/products")
+
+	tests := []struct {
+		url     string
+		status  int
+		want    []string
+		message string
+	}{
+		{"/products?created_after=2024-01-01&created_before=2024-02-01", http.StatusOK,
+			[]string{"2024-01-01T00:00:00Z", "2024-01-15T12:00:00Z", "2024-02-01T00:00:00Z"}, ""},
+		{"/products?created_after=2024-01-15T12:00:00Z", http.StatusOK,
+			[]string{"2024-01-15T12:00:00Z", "2024-02-01T00:00:00Z", "2024-02-01T00:00:01Z"}, ""},
+		{"/products?created_before=2024-01-01T07:00:00%2B07:00", http.StatusOK,
+			[]string{"2023-12-31T23:59:59Z", "2024-01-01T00:00:00Z"}, ""},
+		{"/products?created_after=2024-13-01", http.StatusBadRequest, nil, "Invalid created_after parameter (RFC 3339 or YYYY-MM-DD)"},
+		{"/products?created_before=yesterday", http.StatusBadRequest, nil, "Invalid created_before parameter (RFC 3339 or YYYY-MM-DD)"},
+		{"/products?created_after=2024-02-01&created_before=2024-01-01", http.StatusBadRequest, nil, "created_after cannot be later than created_before"},
+	}
 
-	product := models.ProductInput{
-		Name:       "Test Product",
-		Price:      99.99,
-		Stock:      10,
-		CategoryID: 999, // Non-existent category
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if tt.status != http.StatusOK {
+				if response.Message != tt.message {
+					t.Errorf("Expected message %q, got %q", tt.message, response.Message)
+				}
+				return
+			}
+
+			var names []string
+			for _, item := range response.Data.([]any) {
+				names = append(names, item.(map[string]any)["name"].(string))
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, names)
+			}
+		})
 	}
+}
 
-	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
+// TestGetProductsByCategory_None tests GET /products?category_id=none
+// returns only products without a category
+func TestGetProductsByCategory_None(t *testing.T) {
+	repo := newMockProductRepository()
+	repo.SeedData()
+	repo.products[6] = models.Product{ID: 6, Name: "Loose Cable", Price: pricePtr(5), Stock: 3}
+	handler := NewProductHandler(repo, "/products")
+
+	req := httptest.NewRequest(http.MethodGet, "/products?category_id=none", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
 	}
 
 	var response Response
@@ -451,28 +1154,27 @@ func TestCreateProduct_InvalidCategory(t *testing.T) {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if response.Success {
-		t.Error("Expected success to be false")
+	data, ok := response.Data.([]any)
+	if !ok {
+		t.Fatalf("Expected data to be an array, got %T", response.Data)
 	}
-
-	if response.Message != "Category not found" {
-		t.Errorf("Expected message 'Category not found', got '%s'", response.Message)
+	if len(data) != 1 {
+		t.Fatalf("Expected 1 uncategorized product, got %d", len(data))
+	}
+	product := data[0].(map[string]any)
+	if product["id"] != float64(6) {
+		t.Errorf("Expected product 6, got %v", product["id"])
+	}
+	if _, ok := product["category_id"]; ok {
+		t.Errorf("Expected no category_id, got %v", product["category_id"])
 	}
 }
 
-// TestCreateProduct_EmptyName tests POST /products with empty name
-func TestCreateProduct_EmptyName(t *testing.T) {
-	handler := setupProductTestHandler()
-
-	product := models.ProductInput{
-		Name:  "",
-		Price: 99.99,
-		Stock: 10,
-	}
+// TestGetProductsByCategory_InvalidCategoryID tests GET /products with invalid category_id
+func TestGetProductsByCategory_InvalidCategoryID(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
 
-	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
+	req := httptest.NewRequest(http.MethodGet, "/products?category_id=abc", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
@@ -490,30 +1192,25 @@ func TestCreateProduct_EmptyName(t *testing.T) {
 		t.Error("Expected success to be false")
 	}
 
-	if response.Message != "Name is required" {
-		t.Errorf("Expected message 'Name is required', got '%s'", response.Message)
+	if response.Message != "Invalid category_id parameter" {
+		t.Errorf("Expected message 'Invalid category_id parameter', got '%s'", response.Message)
+	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
 	}
 }
 
-// TestCreateProduct_NegativePrice tests POST /products with negative price
-func TestCreateProduct_NegativePrice(t *testing.T) {
-	handler := setupProductTestHandler()
-
-	product := models.ProductInput{
-		Name:  "Test Product",
-		Price: -10.00,
-		Stock: 10,
-	}
+// TestGetProductByID_Success tests GET /products/{id} with valid ID
+func TestGetProductByID_Success(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
 
-	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
+	req := httptest.NewRequest(http.MethodGet, "/products/1", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
 	}
 
 	var response Response
@@ -521,92 +1218,124 @@ func TestCreateProduct_NegativePrice(t *testing.T) {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if response.Success {
-		t.Error("Expected success to be false")
+	if !response.Success {
+		t.Error("Expected success to be true")
 	}
 
-	if response.Message != "Price cannot be negative" {
-		t.Errorf("Expected message 'Price cannot be negative', got '%s'", response.Message)
+	if response.Message != "Product retrieved successfully" {
+		t.Errorf("Expected message 'Product retrieved successfully', got '%s'", response.Message)
 	}
-}
-
-// TestCreateProduct_NegativeStock tests POST /products with negative stock
-func TestCreateProduct_NegativeStock(t *testing.T) {
-	handler := setupProductTestHandler()
 
-	product := models.ProductInput{
-		Name:  "Test Product",
-		Price: 99.99,
-		Stock: -5,
+	// Check product data
+	data, ok := response.Data.(map[string]any)
+	if !ok {
+		t.Fatalf("Expected data to be an object, got %T", response.Data)
 	}
 
-	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
-	rec := httptest.NewRecorder()
-
-	handler.ServeHTTP(rec, req)
-
-	if rec.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	if data["id"] != float64(1) {
+		t.Errorf("Expected id 1, got %v", data["id"])
 	}
 
-	var response Response
-	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
-		t.Fatalf("Failed to decode response: %v", err)
+	if data["name"] != "iPhone 15 Pro" {
+		t.Errorf("Expected name 'iPhone 15 Pro', got '%v'", data["name"])
 	}
 
-	if response.Success {
-		t.Error("Expected success to be false")
+	if data["category_id"] != float64(1) {
+		t.Errorf("Expected category_id 1, got %v", data["category_id"])
 	}
 
-	if response.Message != "Stock cannot be negative" {
-		t.Errorf("Expected message 'Stock cannot be negative', got '%s'", response.Message)
+	// Check category is included
+	if data["category"] == nil {
+		t.Error("Expected category to be included")
 	}
 }
 
-// TestCreateProduct_DuplicateName tests POST /products with duplicate name
-func TestCreateProduct_DuplicateName(t *testing.T) {
+// TestGetProductByID_ETag tests that a repeated GET with If-None-Match gets
+// an empty 304 until the product changes
+func TestGetProductByID_ETag(t *testing.T) {
 	handler := setupProductTestHandlerWithData()
 
-	product := models.ProductInput{
-		Name:       "iPhone 15 Pro", // Already exists in seed data
-		Price:      999.99,
-		Stock:      10,
-		CategoryID: 1,
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/products/1", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
 	}
 
-	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
-	rec := httptest.NewRecorder()
-
-	handler.ServeHTTP(rec, req)
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d and %q", first.Code, etag)
+	}
 
-	if rec.Code != http.StatusConflict {
-		t.Errorf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		rec := get(header)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: expected status %d, got %d", header, http.StatusNotModified, rec.Code)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: expected an empty body, got %q", header, rec.Body.String())
+		}
+		if rec.Header().Get("ETag") != etag || rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("If-None-Match %s: expected ETag and Content-Type headers, got %v", header, rec.Header())
+		}
 	}
 
-	var response Response
-	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
-		t.Fatalf("Failed to decode response: %v", err)
+	if rec := get(`"stale"`); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d for a stale ETag, got %d", http.StatusOK, rec.Code)
 	}
 
-	if response.Success {
+	req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBufferString(`{"name":"iPhone 15 Pro","price":899.99,"stock":50,"version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := get(etag)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d after an update, got %d", http.StatusOK, rec.Code)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Error("Expected a new ETag after an update")
+	}
+}
+
+// TestGetProductByID_NotFound tests GET /products/{id} with non-existent ID
+func TestGetProductByID_NotFound(t *testing.T) {
+	handler := setupProductTestHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/999", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Success {
 		t.Error("Expected success to be false")
 	}
 
-	if response.Message != "Product name already exists" {
-		t.Errorf("Expected message 'Product name already exists', got '%s'", response.Message)
+	if response.Message != "Product not found" {
+		t.Errorf("Expected message 'Product not found', got '%s'", response.Message)
+	}
+	if response.Code != ErrCodeProductNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeProductNotFound, response.Code)
 	}
 }
 
-// TestCreateProduct_InvalidJSON tests POST /products with invalid JSON
-func TestCreateProduct_InvalidJSON(t *testing.T) {
+// TestGetProductByID_InvalidID tests GET /products/{id} with invalid ID
+func TestGetProductByID_InvalidID(t *testing.T) {
 	handler := setupProductTestHandler()
 
-	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString("{invalid json}"))
-	req.Header.Set("Content-Type", "application/json")
+	req := httptest.NewRequest(http.MethodGet, "/products/abc", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
@@ -624,31 +1353,80 @@ func TestCreateProduct_InvalidJSON(t *testing.T) {
 		t.Error("Expected success to be false")
 	}
 
-	if response.Message != "Invalid request body" {
-		t.Errorf("Expected message 'Invalid request body', got '%s'", response.Message)
+	if response.Message != "Invalid product ID" {
+		t.Errorf("Expected message 'Invalid product ID', got '%s'", response.Message)
+	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
 	}
 }
 
-// TestUpdateProduct_Success tests PUT /products/{id} with valid data
-func TestUpdateProduct_Success(t *testing.T) {
-	handler := setupProductTestHandlerWithData()
+// TestProductPaths_Slashes tests that a trailing slash is ignored and an
+// empty path segment is rejected
+func TestProductPaths_Slashes(t *testing.T) {
+	tests := []struct {
+		method  string
+		path    string
+		body    string
+		status  int
+		message string
+	}{
+		{http.MethodGet, "/products/", "", http.StatusOK, "Products retrieved successfully"},
+		{http.MethodPost, "/products/", `{"name":"Slash","price":1,"category_id":1}`, http.StatusCreated, "Product created successfully"},
+		{http.MethodGet, "/products/count/", "", http.StatusOK, "Products counted successfully"},
+		{http.MethodGet, "/products/1/", "", http.StatusOK, "Product retrieved successfully"},
+		{http.MethodGet, "/products//1", "", http.StatusBadRequest, "Invalid path: empty segment"},
+		{http.MethodGet, "/products/1//history", "", http.StatusBadRequest, "Invalid path: empty segment"},
+		{http.MethodGet, "/products//", "", http.StatusBadRequest, "Invalid path: empty segment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, response.Message)
+			}
+		})
+	}
+}
+
+// TestCreateProduct_Success tests POST /products with valid data including category
+func TestCreateProduct_Success(t *testing.T) {
+	handler := setupProductTestHandler()
 
 	product := models.ProductInput{
-		Name:       "Updated iPhone",
-		Price:      1099.99,
-		Stock:      75,
-		CategoryID: 2, // Change to Clothing
+		Name:       "Test Product",
+		Price:      pricePtr(99.99),
+		Stock:      10,
+		CategoryID: 1, // Electronics
 	}
 
 	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBuffer(body))
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
 	}
 
 	var response Response
@@ -660,33 +1438,108 @@ func TestUpdateProduct_Success(t *testing.T) {
 		t.Error("Expected success to be true")
 	}
 
-	if response.Message != "Product updated successfully" {
-		t.Errorf("Expected message 'Product updated successfully', got '%s'", response.Message)
+	if response.Message != "Product created successfully" {
+		t.Errorf("Expected message 'Product created successfully', got '%s'", response.Message)
 	}
 
+	// Check response data
 	data, ok := response.Data.(map[string]any)
 	if !ok {
 		t.Fatalf("Expected data to be an object, got %T", response.Data)
 	}
 
-	if data["name"] != "Updated iPhone" {
-		t.Errorf("Expected name 'Updated iPhone', got '%v'", data["name"])
+	if data["name"] != "Test Product" {
+		t.Errorf("Expected name 'Test Product', got '%v'", data["name"])
+	}
+
+	if data["id"] != float64(1) {
+		t.Errorf("Expected id 1, got %v", data["id"])
+	}
+
+	if data["category_id"] != float64(1) {
+		t.Errorf("Expected category_id 1, got %v", data["category_id"])
+	}
+
+	for _, field := range []string{"created_at", "updated_at"} {
+		value, _ := data[field].(string)
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			t.Errorf("Expected %s as an RFC3339 timestamp, got %v", field, data[field])
+		}
 	}
 }
 
-// TestUpdateProduct_InvalidCategory tests PUT /products/{id} with invalid category
-func TestUpdateProduct_InvalidCategory(t *testing.T) {
-	handler := setupProductTestHandlerWithData()
+// TestCreateProduct_IdempotencyKey tests that retrying POST /products with
+// the same Idempotency-Key returns the first product instead of creating another
+func TestCreateProduct_IdempotencyKey(t *testing.T) {
+	handler := setupProductTestHandler()
+	repo := handler.repo.(*mockProductRepository)
+
+	post := func(key, body string) (*httptest.ResponseRecorder, Response) {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		var response Response
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rec, response
+	}
+
+	first, firstResponse := post("order-42", `{"name":"Phone Case","price":15}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, first.Code)
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("Expected the first create not to be marked as replayed")
+	}
+
+	// The retry spells the name differently, which would otherwise create a duplicate
+	retry, retryResponse := post("order-42", `{"name":"Phone case ","price":15}`)
+	if retry.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, retry.Code)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected the retry to be marked as replayed")
+	}
+	firstID := firstResponse.Data.(map[string]any)["id"]
+	if retryID := retryResponse.Data.(map[string]any)["id"]; retryID != firstID {
+		t.Errorf("Expected the retry to return product %v, got %v", firstID, retryID)
+	}
+	if len(repo.products) != 1 {
+		t.Errorf("Expected 1 product, got %d", len(repo.products))
+	}
+
+	other, _ := post("order-43", `{"name":"Screen Guard","price":9}`)
+	if other.Code != http.StatusCreated || len(repo.products) != 2 {
+		t.Errorf("Expected a new key to create a product, got status %d and %d products", other.Code, len(repo.products))
+	}
+
+	tooLong, response := post(strings.Repeat("k", repository.MaxIdempotencyKeyLength+1), `{"name":"Charger","price":20}`)
+	if tooLong.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a long key, got %d", http.StatusBadRequest, tooLong.Code)
+	}
+	if response.Message != "Idempotency-Key too long (max 255 characters)" {
+		t.Errorf("Expected message about the key length, got %q", response.Message)
+	}
+}
+
+// TestCreateProduct_InvalidCategory tests POST /products with non-existent category
+func TestCreateProduct_InvalidCategory(t *testing.T) {
+	handler := setupProductTestHandler()
 
 	product := models.ProductInput{
-		Name:       "Updated iPhone",
-		Price:      1099.99,
-		Stock:      75,
-		CategoryID: 999, // Non-existent
+		Name:       "Test Product",
+		Price:      pricePtr(99.99),
+		Stock:      10,
+		CategoryID: 999, // Non-existent category
 	}
 
 	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBuffer(body))
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
@@ -708,27 +1561,30 @@ func TestUpdateProduct_InvalidCategory(t *testing.T) {
 	if response.Message != "Category not found" {
 		t.Errorf("Expected message 'Category not found', got '%s'", response.Message)
 	}
+	if response.Code != ErrCodeCategoryNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeCategoryNotFound, response.Code)
+	}
 }
 
-// TestUpdateProduct_NotFound tests PUT /products/{id} with non-existent ID
-func TestUpdateProduct_NotFound(t *testing.T) {
+// TestCreateProduct_EmptyName tests POST /products with empty name
+func TestCreateProduct_EmptyName(t *testing.T) {
 	handler := setupProductTestHandler()
 
 	product := models.ProductInput{
-		Name:  "New Product",
-		Price: 99.99,
+		Name:  "",
+		Price: pricePtr(99.99),
 		Stock: 10,
 	}
 
 	body, _ := json.Marshal(product)
-	req := httptest.NewRequest(http.MethodPut, "/products/999", bytes.NewBuffer(body))
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusNotFound {
-		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
 	}
 
 	var response Response
@@ -740,22 +1596,33 @@ func TestUpdateProduct_NotFound(t *testing.T) {
 		t.Error("Expected success to be false")
 	}
 
-	if response.Message != "Product not found" {
-		t.Errorf("Expected message 'Product not found', got '%s'", response.Message)
+	if errorMessage(response) != "Name is required" {
+		t.Errorf("Expected message 'Name is required', got '%s'", errorMessage(response))
+	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
 	}
 }
 
-// TestDeleteProduct_Success tests DELETE /products/{id} with valid ID
-func TestDeleteProduct_Success(t *testing.T) {
-	handler := setupProductTestHandlerWithData()
+// TestCreateProduct_NegativePrice tests POST /products with negative price
+func TestCreateProduct_NegativePrice(t *testing.T) {
+	handler := setupProductTestHandler()
 
-	req := httptest.NewRequest(http.MethodDelete, "/products/1", nil)
+	product := models.ProductInput{
+		Name:  "Test Product",
+		Price: pricePtr(-10.00),
+		Stock: 10,
+	}
+
+	body, _ := json.Marshal(product)
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
 	}
 
 	var response Response
@@ -763,35 +1630,37 @@ func TestDeleteProduct_Success(t *testing.T) {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if !response.Success {
-		t.Error("Expected success to be true")
+	if response.Success {
+		t.Error("Expected success to be false")
 	}
 
-	if response.Message != "Product deleted successfully" {
-		t.Errorf("Expected message 'Product deleted successfully', got '%s'", response.Message)
+	if errorMessage(response) != "Price cannot be negative" {
+		t.Errorf("Expected message 'Price cannot be negative', got '%s'", errorMessage(response))
 	}
-
-	// Verify deletion - try to get the deleted product
-	req2 := httptest.NewRequest(http.MethodGet, "/products/1", nil)
-	rec2 := httptest.NewRecorder()
-	handler.ServeHTTP(rec2, req2)
-
-	if rec2.Code != http.StatusNotFound {
-		t.Errorf("Expected deleted product to return %d, got %d", http.StatusNotFound, rec2.Code)
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
 	}
 }
 
-// TestDeleteProduct_NotFound tests DELETE /products/{id} with non-existent ID
-func TestDeleteProduct_NotFound(t *testing.T) {
+// TestCreateProduct_NegativeStock tests POST /products with negative stock
+func TestCreateProduct_NegativeStock(t *testing.T) {
 	handler := setupProductTestHandler()
 
-	req := httptest.NewRequest(http.MethodDelete, "/products/999", nil)
+	product := models.ProductInput{
+		Name:  "Test Product",
+		Price: pricePtr(99.99),
+		Stock: -5,
+	}
+
+	body, _ := json.Marshal(product)
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusNotFound {
-		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
 	}
 
 	var response Response
@@ -803,125 +1672,2743 @@ func TestDeleteProduct_NotFound(t *testing.T) {
 		t.Error("Expected success to be false")
 	}
 
-	if response.Message != "Product not found" {
-		t.Errorf("Expected message 'Product not found', got '%s'", response.Message)
+	if errorMessage(response) != "Stock cannot be negative" {
+		t.Errorf("Expected message 'Stock cannot be negative', got '%s'", errorMessage(response))
+	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
 	}
 }
 
-// TestProductMethodNotAllowed_Collection tests unsupported methods on /products
-func TestProductMethodNotAllowed_Collection(t *testing.T) {
-	handler := setupProductTestHandler()
+// TestCreateProduct_PriceScale tests that prices may not carry more decimals than PRICE_SCALE
+func TestCreateProduct_PriceScale(t *testing.T) {
+	tests := []struct {
+		name   string
+		scale  int
+		body   string
+		status int
+		// contains is a fragment the response body must include
+		contains string
+	}{
+		{"default rejects three decimals", 2, `{"name":"Diesel","price":1.459}`, http.StatusUnprocessableEntity, ""},
+		{"default rejects 19.999", 2, `{"name":"Diesel","price":19.999}`, http.StatusUnprocessableEntity, "Price cannot have more than 2 decimal places"},
+		{"default accepts two decimals", 2, `{"name":"Diesel","price":1.45}`, http.StatusCreated, `"price":1.45,`},
+		{"default accepts the largest price", 2, `{"name":"Diesel","price":99999999.99}`, http.StatusCreated, `"price":99999999.99,`},
+		{"scale three accepts three decimals", 3, `{"name":"Diesel","price":1.459}`, http.StatusCreated, `"price":1.459,`},
+		{"scale three pads output", 3, `{"name":"Diesel","price":2}`, http.StatusCreated, `"price":2.000,`},
+		{"scale three renders the maximum", 3, `{"name":"Diesel","price":100000000}`, http.StatusUnprocessableEntity, "Price exceeds maximum (99999999.990)"},
+	}
 
-	unsupportedMethods := []string{http.MethodPut, http.MethodDelete, http.MethodPatch}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models.Configure(models.Settings{PriceScale: tt.scale})
+			defer models.Configure(models.DefaultSettings)
 
-	for _, method := range unsupportedMethods {
-		t.Run(method, func(t *testing.T) {
-			req := httptest.NewRequest(method, "/products", nil)
+			handler := setupProductTestHandler()
+
+			req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 
 			handler.ServeHTTP(rec, req)
 
-			if rec.Code != http.StatusMethodNotAllowed {
-				t.Errorf("Expected status %d for method %s, got %d", http.StatusMethodNotAllowed, method, rec.Code)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.contains != "" && !strings.Contains(rec.Body.String(), tt.contains) {
+				t.Errorf("Expected body to contain %s, got %s", tt.contains, rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestProductMaxPrice tests that create and update reject prices above
+// MAX_PRICE, which the price column capacity caps
+func TestProductMaxPrice(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxPrice any
+		method   string
+		url      string
+		body     string
+		status   int
+		message  string
+	}{
+		{"create over default", nil, http.MethodPost, "/products", `{"name":"Yacht","price":100000000}`, http.StatusUnprocessableEntity, "Price exceeds maximum (99999999.99)"},
+		{"update over default", nil, http.MethodPut, "/products/1", `{"name":"Yacht","price":100000000,"version":1}`, http.StatusUnprocessableEntity, "Price exceeds maximum (99999999.99)"},
+		{"update at default", nil, http.MethodPut, "/products/1", `{"name":"Yacht","price":99999999.99,"version":1}`, http.StatusOK, ""},
+		{"create over configured", 500, http.MethodPost, "/products", `{"name":"Yacht","price":500.01}`, http.StatusUnprocessableEntity, "Price exceeds maximum (500.00)"},
+		{"create over column", 1e15, http.MethodPost, "/products", `{"name":"Yacht","price":1000000000000}`, http.StatusUnprocessableEntity, "Price exceeds maximum (999999999999.99)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("MAX_PRICE", tt.maxPrice)
+			defer viper.Set("MAX_PRICE", nil)
+
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
 			}
 
 			var response Response
 			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
 				t.Fatalf("Failed to decode response: %v", err)
 			}
+			if tt.message != "" && errorMessage(response) != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, errorMessage(response))
+			}
+		})
+	}
+}
 
-			if response.Success {
-				t.Error("Expected success to be false")
+// TestNameLength tests that names over 255 characters are rejected on create
+// and update, counting runes rather than bytes
+func TestNameLength(t *testing.T) {
+	tooLong := strings.Repeat("é", 256)
+	longest := strings.Repeat("é", 255)
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		url     string
+		body    string
+		status  int
+	}{
+		{"create product", setupProductTestHandler(), http.MethodPost, "/products", `{"name":"` + tooLong + `"}`, http.StatusUnprocessableEntity},
+		{"update product", setupProductTestHandlerWithData(), http.MethodPut, "/products/1", `{"name":"` + tooLong + `"}`, http.StatusUnprocessableEntity},
+		{"create category", setupTestHandler(), http.MethodPost, "/categories", `{"name":"` + tooLong + `"}`, http.StatusUnprocessableEntity},
+		{"update category", setupTestHandlerWithData(), http.MethodPut, "/categories/1", `{"name":"` + tooLong + `"}`, http.StatusUnprocessableEntity},
+		{"255 multibyte runes", setupProductTestHandler(), http.MethodPost, "/products", `{"name":"` + longest + `"}`, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			tt.handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status != http.StatusUnprocessableEntity {
+				return
 			}
 
-			if response.Message != "Method not allowed" {
-				t.Errorf("Expected message 'Method not allowed', got '%s'", response.Message)
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if errorMessage(response) != "Name too long (max 255 characters)" {
+				t.Errorf("Unexpected message: %s", errorMessage(response))
+			}
+			if response.Code != ErrCodeValidation {
+				t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
 			}
 		})
 	}
 }
 
-// TestProductCRUDFlow tests a complete CRUD flow for products with category
-func TestProductCRUDFlow(t *testing.T) {
-	handler := setupProductTestHandler()
+// TestCreateProduct_WholeNumberStock tests that integral stock values are
+// accepted and fractional ones rejected rather than truncated
+func TestCreateProduct_WholeNumberStock(t *testing.T) {
+	tests := []struct {
+		stock  string
+		status int
+		want   float64
+	}{
+		{"10", http.StatusCreated, 10},
+		{"10.0", http.StatusCreated, 10},
+		{"10.5", http.StatusBadRequest, 0},
+	}
 
-	// 1. Create a product with category
-	createBody, _ := json.Marshal(models.ProductInput{
-		Name:       "Test Product",
-		Price:      99.99,
-		Stock:      10,
-		CategoryID: 1,
-	})
-	createReq := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(createBody))
-	createReq.Header.Set("Content-Type", "application/json")
-	createRec := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.stock, func(t *testing.T) {
+			handler := NewProductHandler(newMockProductRepository(), "/products")
 
-	handler.ServeHTTP(createRec, createReq)
+			body := `{"name":"Pen","price":1,"stock":` + tt.stock + `}`
+			req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
 
-	if createRec.Code != http.StatusCreated {
-		t.Fatalf("Create failed: expected status %d, got %d", http.StatusCreated, createRec.Code)
-	}
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if tt.status == http.StatusBadRequest {
+				if response.Message != "Stock must be a whole number" {
+					t.Errorf("Expected whole number message, got %q", response.Message)
+				}
+				return
+			}
+			if stock := response.Data.(map[string]any)["stock"]; stock != tt.want {
+				t.Errorf("Expected stock %v, got %v", tt.want, stock)
+			}
+		})
+	}
+}
+
+// TestProductNameExists_IgnoresCase tests that product names differing only
+// in case conflict on create and update
+func TestProductNameExists_IgnoresCase(t *testing.T) {
+	repo := newMockProductRepository()
+	handler := NewProductHandler(repo, "/products")
+
+	requests := []struct {
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/products", `{"name":"Books","price":1}`, http.StatusCreated},
+		{http.MethodPost, "/products", `{"name":"BOOKS","price":1}`, http.StatusConflict},
+		{http.MethodPost, "/products", `{"name":"Pens","price":1}`, http.StatusCreated},
+		{http.MethodPut, "/products/2", `{"name":"books","price":1,"version":1}`, http.StatusConflict},
+		{http.MethodPut, "/products/1", `{"name":"BOOKS","price":1,"version":1}`, http.StatusOK},
+	}
+
+	for _, tt := range requests {
+		req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d, got %d", tt.method, tt.url, tt.body, tt.status, rec.Code)
+		}
+	}
+}
+
+// TestProductNameTrimming tests that product names are trimmed and
+// whitespace-only names are rejected
+func TestProductNameTrimming(t *testing.T) {
+	repo := newMockProductRepository()
+	repo.SeedCategories()
+	handler := NewProductHandler(repo, "/products")
+
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{`{"name":"   "}`, http.StatusUnprocessableEntity},
+		{`{"name":"  Pen  "}`, http.StatusCreated},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.body, tt.status, rec.Code)
+		}
+	}
+
+	if p, ok := repo.products[1]; !ok || p.Name != "Pen" {
+		t.Errorf("Expected the product stored as \"Pen\", got %+v", repo.products)
+	}
+}
+
+// TestProductDescription tests that descriptions are optional, trimmed and
+// capped at maxDescriptionLength characters on create and update
+func TestProductDescription(t *testing.T) {
+	repo := newMockProductRepository()
+	repo.SeedData()
+	handler := NewProductHandler(repo, "/products")
+
+	atLimit := strings.Repeat("é", maxDescriptionLength)
+	tooLong := atLimit + "x"
+	padded := "  Fits in a pocket  "
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		description *string
+		status      int
+		want        string
+	}{
+		{"create without description", http.MethodPost, "/products", nil, http.StatusCreated, ""},
+		{"create with description", http.MethodPost, "/products", &padded, http.StatusCreated, "Fits in a pocket"},
+		{"create at limit", http.MethodPost, "/products", &atLimit, http.StatusCreated, atLimit},
+		{"create too long", http.MethodPost, "/products", &tooLong, http.StatusUnprocessableEntity, ""},
+		{"update at limit", http.MethodPut, "/products/1", &atLimit, http.StatusOK, atLimit},
+		{"update too long", http.MethodPut, "/products/1", &tooLong, http.StatusUnprocessableEntity, ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := map[string]any{"name": fmt.Sprintf("Notebook %d", i), "price": 5, "version": 1}
+			if tt.description != nil {
+				input["description"] = *tt.description
+			}
+			body, _ := json.Marshal(input)
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if tt.status == http.StatusUnprocessableEntity {
+				if want := fmt.Sprintf("Description too long (max %d characters)", maxDescriptionLength); errorMessage(response) != want {
+					t.Errorf("Expected message %q, got %q", want, errorMessage(response))
+				}
+				return
+			}
+			if got := response.Data.(map[string]any)["description"]; got != tt.want {
+				t.Errorf("Expected description %q, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestCreateProduct_Form tests POST /products with a form-encoded body
+func TestCreateProduct_Form(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		status  int
+		message string
+	}{
+		{"valid", url.Values{"name": {"Pen"}, "description": {"Blue ink"}, "price": {"1.25"}, "stock": {"40"}, "category_id": {"1"}}, http.StatusCreated, "Product created successfully"},
+		{"non-numeric price", url.Values{"name": {"Pen"}, "price": {"cheap"}}, http.StatusBadRequest, "Invalid price: must be a number"},
+		{"fractional stock", url.Values{"name": {"Pen"}, "stock": {"1.5"}}, http.StatusBadRequest, "Invalid stock: must be a whole number"},
+		{"invalid category_id", url.Values{"name": {"Pen"}, "category_id": {"books"}}, http.StatusBadRequest, "Invalid category_id: must be a valid ID"},
+		{"negative price", url.Values{"name": {"Pen"}, "price": {"-1"}}, http.StatusUnprocessableEntity, "Price cannot be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockProductRepository()
+			repo.SeedCategories()
+			handler := NewProductHandler(repo, "/products")
+
+			req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if errorMessage(response) != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, errorMessage(response))
+			}
+			if tt.status != http.StatusCreated {
+				if response.Code != ErrCodeValidation {
+					t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
+				}
+				return
+			}
+
+			p := repo.products[1]
+			if p.Name != "Pen" || p.Description != "Blue ink" || !models.PricesEqual(p.Price, pricePtr(1.25)) || p.Stock != 40 || p.CategoryID != 1 {
+				t.Errorf("Unexpected product stored: %+v", p)
+			}
+		})
+	}
+}
+
+// TestProductSKU tests SKU format validation and uniqueness on create and update
+func TestProductSKU(t *testing.T) {
+	repo := newMockProductRepository()
+	repo.SeedCategories()
+	handler := NewProductHandler(repo, "/products")
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int
+		message string
+	}{
+		{"create with sku", http.MethodPost, "/products", `{"name":"Pen","sku":" PEN-001 "}`, http.StatusCreated, ""},
+		{"create without sku", http.MethodPost, "/products", `{"name":"Pencil"}`, http.StatusCreated, ""},
+		{"create another without sku", http.MethodPost, "/products", `{"name":"Eraser"}`, http.StatusCreated, ""},
+		{"create with spaces", http.MethodPost, "/products", `{"name":"Ruler","sku":"RUL 001"}`, http.StatusUnprocessableEntity, "SKU must contain only letters, digits and dashes (max 64 characters)"},
+		{"create with underscore", http.MethodPost, "/products", `{"name":"Ruler","sku":"RUL_001"}`, http.StatusUnprocessableEntity, "SKU must contain only letters, digits and dashes (max 64 characters)"},
+		{"create too long", http.MethodPost, "/products", `{"name":"Ruler","sku":"` + strings.Repeat("A", maxSKULength+1) + `"}`, http.StatusUnprocessableEntity, "SKU must contain only letters, digits and dashes (max 64 characters)"},
+		{"create duplicate", http.MethodPost, "/products", `{"name":"Ruler","sku":"PEN-001"}`, http.StatusConflict, "SKU already exists"},
+		{"update keeps own sku", http.MethodPut, "/products/1", `{"name":"Pen","sku":"PEN-001","version":1}`, http.StatusOK, ""},
+		{"update duplicate", http.MethodPut, "/products/2", `{"name":"Pencil","sku":"PEN-001","version":1}`, http.StatusConflict, "SKU already exists"},
+		{"update invalid", http.MethodPut, "/products/2", `{"name":"Pencil","sku":"PEN/002"}`, http.StatusUnprocessableEntity, "SKU must contain only letters, digits and dashes (max 64 characters)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if tt.message != "" && errorMessage(response) != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, errorMessage(response))
+			}
+			if code := map[int]string{http.StatusUnprocessableEntity: ErrCodeValidation, http.StatusConflict: ErrCodeDuplicateSKU}[tt.status]; response.Code != code {
+				t.Errorf("Expected code %q, got %q", code, response.Code)
+			}
+		})
+	}
+
+	if got := repo.products[1].SKU; got != "PEN-001" {
+		t.Errorf("Expected the SKU stored trimmed as PEN-001, got %q", got)
+	}
+}
+
+// TestCreateProduct_DuplicateName tests POST /products with duplicate name
+func TestCreateProduct_DuplicateName(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	product := models.ProductInput{
+		Name:       "iPhone 15 Pro", // Already exists in seed data
+		Price:      pricePtr(999.99),
+		Stock:      10,
+		CategoryID: 1,
+	}
+
+	body, _ := json.Marshal(product)
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Success {
+		t.Error("Expected success to be false")
+	}
+
+	if response.Message != "Product name already exists" {
+		t.Errorf("Expected message 'Product name already exists', got '%s'", response.Message)
+	}
+	if response.Code != ErrCodeDuplicateName {
+		t.Errorf("Expected code %s, got %q", ErrCodeDuplicateName, response.Code)
+	}
+}
+
+// TestCreateProduct_InvalidJSON tests POST /products with invalid JSON
+func TestCreateProduct_InvalidJSON(t *testing.T) {
+	handler := setupProductTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString("{invalid json}"))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Success {
+		t.Error("Expected success to be false")
+	}
+
+	if response.Message != "Invalid request body" {
+		t.Errorf("Expected message 'Invalid request body', got '%s'", response.Message)
+	}
+	if response.Code != ErrCodeValidation {
+		t.Errorf("Expected code %s, got %q", ErrCodeValidation, response.Code)
+	}
+}
+
+// TestUpdateProduct_Success tests PUT /products/{id} with valid data
+func TestUpdateProduct_Success(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	product := models.ProductInput{
+		Name:       "Updated iPhone",
+		Price:      pricePtr(1099.99),
+		Stock:      75,
+		CategoryID: 2, // Change to Clothing
+	}
+
+	body, _ := json.Marshal(product)
+	req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if !response.Success {
+		t.Error("Expected success to be true")
+	}
+
+	if response.Message != "Product updated successfully" {
+		t.Errorf("Expected message 'Product updated successfully', got '%s'", response.Message)
+	}
+
+	data, ok := response.Data.(map[string]any)
+	if !ok {
+		t.Fatalf("Expected data to be an object, got %T", response.Data)
+	}
+
+	if data["name"] != "Updated iPhone" {
+		t.Errorf("Expected name 'Updated iPhone', got '%v'", data["name"])
+	}
+
+	if data["id"] != float64(1) {
+		t.Errorf("Expected id 1, got %v", data["id"])
+	}
+
+	if data["category_id"] != float64(2) {
+		t.Errorf("Expected category_id 2, got %v", data["category_id"])
+	}
+}
+
+// TestUpdateProduct_InvalidCategory tests PUT /products/{id} with invalid category
+func TestUpdateProduct_InvalidCategory(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	product := models.ProductInput{
+		Name:       "Updated iPhone",
+		Price:      pricePtr(1099.99),
+		Stock:      75,
+		CategoryID: 999, // Non-existent
+	}
+
+	body, _ := json.Marshal(product)
+	req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Success {
+		t.Error("Expected success to be false")
+	}
+
+	if response.Message != "Category not found" {
+		t.Errorf("Expected message 'Category not found', got '%s'", response.Message)
+	}
+	if response.Code != ErrCodeCategoryNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeCategoryNotFound, response.Code)
+	}
+}
+
+// TestUpdateProduct_Version tests optimistic concurrency: the first writer
+// at a version wins, a stale one gets 409, a missing version gets 428, and a
+// malformed version is rejected
+func TestUpdateProduct_Version(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	put := func(ifMatch, body string) (*httptest.ResponseRecorder, Response) {
+		req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		var response Response
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rec, response
+	}
+
+	// Two clients read version 1; the first update wins and bumps it
+	rec, response := put(`"1"`, `{"name":"iPhone 15 Pro","price":949.99}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, response.Message)
+	}
+	if got := response.Data.(map[string]any)["version"]; got != float64(2) {
+		t.Errorf("Expected version 2 after the update, got %v", got)
+	}
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		body    string
+		status  int
+		code    string
+		message string
+	}{
+		{"stale header", `"1"`, `{"name":"iPhone 15 Pro","price":899.99}`, http.StatusConflict, ErrCodeVersionConflict, "Product was modified by another request"},
+		{"stale body", "", `{"name":"iPhone 15 Pro","price":899.99,"version":1}`, http.StatusConflict, ErrCodeVersionConflict, "Product was modified by another request"},
+		{"header wins over body", `"1"`, `{"name":"iPhone 15 Pro","price":899.99,"version":2}`, http.StatusConflict, ErrCodeVersionConflict, "Product was modified by another request"},
+		{"missing", "", `{"name":"iPhone 15 Pro","price":899.99}`, http.StatusPreconditionRequired, ErrCodeVersionRequired, "Version required: send If-Match or a version field"},
+		{"malformed", `"abc"`, `{"name":"iPhone 15 Pro","price":899.99}`, http.StatusBadRequest, ErrCodeValidation, "Invalid version (expected a product version, ETag or *)"},
+		{"negative header", `"-1"`, `{"name":"iPhone 15 Pro","price":899.99}`, http.StatusBadRequest, ErrCodeValidation, "Invalid version (expected a product version, ETag or *)"},
+		{"negative body", "", `{"name":"iPhone 15 Pro","price":899.99,"version":-1}`, http.StatusBadRequest, ErrCodeValidation, "Invalid version (expected a product version, ETag or *)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, response := put(tt.ifMatch, tt.body)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if response.Code != tt.code || response.Message != tt.message {
+				t.Errorf("Expected %s %q, got %s %q", tt.code, tt.message, response.Code, response.Message)
+			}
+		})
+	}
+
+	// The rejected writes left the winning price in place
+	getRec := httptest.NewRecorder()
+	handler.ServeHTTP(getRec, httptest.NewRequest(http.MethodGet, "/products/1", nil))
+	var got Response
+	if err := json.NewDecoder(getRec.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	data := got.Data.(map[string]any)
+	if data["price"] != 949.99 || data["version"] != float64(2) {
+		t.Errorf("Expected price 949.99 at version 2, got %v at %v", data["price"], data["version"])
+	}
+}
+
+// TestUpdateProduct_ETagIfMatch tests that the ETag of a GET is accepted as
+// If-Match on the following PUT and is stale once that PUT applies, and that
+// If-Match: * updates whatever the current version
+func TestUpdateProduct_ETagIfMatch(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	get := httptest.NewRecorder()
+	handler.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/products/1", nil))
+	etag := get.Header().Get("ETag")
+	if get.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d and %q", get.Code, etag)
+	}
+
+	put := func(ifMatch string, price string) int {
+		body := `{"name":"iPhone 15 Pro","price":` + price + `}`
+		req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := put(etag, "949.99"); code != http.StatusOK {
+		t.Fatalf("Expected status %d with the GET ETag, got %d", http.StatusOK, code)
+	}
+	if code := put(etag, "899.99"); code != http.StatusConflict {
+		t.Errorf("Expected status %d with the stale ETag, got %d", http.StatusConflict, code)
+	}
+	if code := put("W/"+etag, "899.99"); code != http.StatusConflict {
+		t.Errorf("Expected status %d with the weak stale ETag, got %d", http.StatusConflict, code)
+	}
+	if code := put("*", "899.99"); code != http.StatusOK {
+		t.Errorf("Expected status %d with If-Match *, got %d", http.StatusOK, code)
+	}
+	if code := put("", "899.99"); code != http.StatusPreconditionRequired {
+		t.Errorf("Expected status %d without a version, got %d", http.StatusPreconditionRequired, code)
+	}
+}
+
+// TestUpdateProduct_NotFound tests PUT /products/{id} with non-existent ID
+func TestUpdateProduct_NotFound(t *testing.T) {
+	handler := setupProductTestHandler()
+
+	product := models.ProductInput{
+		Name:  "New Product",
+		Price: pricePtr(99.99),
+		Stock: 10,
+	}
+
+	body, _ := json.Marshal(product)
+	req := httptest.NewRequest(http.MethodPut, "/products/999", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Success {
+		t.Error("Expected success to be false")
+	}
+
+	if response.Message != "Product not found" {
+		t.Errorf("Expected message 'Product not found', got '%s'", response.Message)
+	}
+	if response.Code != ErrCodeProductNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeProductNotFound, response.Code)
+	}
+}
+
+// TestDeleteProduct_Success tests DELETE /products/{id} with valid ID
+func TestDeleteProduct_Success(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodDelete, "/products/1", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if !response.Success {
+		t.Error("Expected success to be true")
+	}
+
+	if response.Message != "Product deleted successfully" {
+		t.Errorf("Expected message 'Product deleted successfully', got '%s'", response.Message)
+	}
+
+	// Verify deletion - try to get the deleted product
+	req2 := httptest.NewRequest(http.MethodGet, "/products/1", nil)
+	rec2 := httptest.NewRecorder()
+	handler.ServeHTTP(rec2, req2)
+
+	if rec2.Code != http.StatusNotFound {
+		t.Errorf("Expected deleted product to return %d, got %d", http.StatusNotFound, rec2.Code)
+	}
+}
+
+// TestDeleteProduct_NotFound tests DELETE /products/{id} with non-existent ID
+func TestDeleteProduct_NotFound(t *testing.T) {
+	handler := setupProductTestHandler()
+
+	req := httptest.NewRequest(http.MethodDelete, "/products/999", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Success {
+		t.Error("Expected success to be false")
+	}
+
+	if response.Message != "Product not found" {
+		t.Errorf("Expected message 'Product not found', got '%s'", response.Message)
+	}
+	if response.Code != ErrCodeProductNotFound {
+		t.Errorf("Expected code %s, got %q", ErrCodeProductNotFound, response.Code)
+	}
+}
+
+// TestProductOptions tests that OPTIONS answers 204 with the Allow header
+// for the collection and for a single product
+func TestProductOptions(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{"/products", "GET, POST"},
+		{"/products/1", "GET, PUT, DELETE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Expected Allow %q, got %q", tt.allow, got)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("Expected an empty body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestProductMethodNotAllowed_Collection tests unsupported methods on /products
+func TestProductMethodNotAllowed_Collection(t *testing.T) {
+	handler := setupProductTestHandler()
+
+	unsupportedMethods := []string{http.MethodPut, http.MethodDelete, http.MethodPatch}
+
+	for _, method := range unsupportedMethods {
+		t.Run(method, func(t *testing.T) {
+			req := httptest.NewRequest(method, "/products", nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status %d for method %s, got %d", http.StatusMethodNotAllowed, method, rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != "GET, POST" {
+				t.Errorf("Expected Allow 'GET, POST', got '%s'", got)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if response.Success {
+				t.Error("Expected success to be false")
+			}
+
+			if response.Message != "Method not allowed" {
+				t.Errorf("Expected message 'Method not allowed', got '%s'", response.Message)
+			}
+			if response.Code != ErrCodeMethodNotAllowed {
+				t.Errorf("Expected code %s, got %q", ErrCodeMethodNotAllowed, response.Code)
+			}
+		})
+	}
+}
+
+// TestProductMethodNotAllowed_Resource tests that 405s on a single product
+// and on named routes list the allowed methods
+func TestProductMethodNotAllowed_Resource(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodPost, "/products/1", "GET, PUT, DELETE"},
+		{http.MethodPatch, "/products/1", "GET, PUT, DELETE"},
+		{http.MethodGet, "/products/set-active", "POST"},
+		{http.MethodDelete, "/products/1/history", "GET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Expected Allow %q, got %q", tt.allow, got)
+			}
+		})
+	}
+}
+
+// TestProductCRUDFlow tests a complete CRUD flow for products with category
+func TestProductCRUDFlow(t *testing.T) {
+	handler := setupProductTestHandler()
+
+	// 1. Create a product with category
+	createBody, _ := json.Marshal(models.ProductInput{
+		Name:       "Test Product",
+		Price:      pricePtr(99.99),
+		Stock:      10,
+		CategoryID: 1,
+	})
+	createReq := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(createBody))
+	createReq.Header.Set("Content-Type", "application/json")
+	createRec := httptest.NewRecorder()
+
+	handler.ServeHTTP(createRec, createReq)
+
+	if createRec.Code != http.StatusCreated {
+		t.Fatalf("Create failed: expected status %d, got %d", http.StatusCreated, createRec.Code)
+	}
+
+	var createResponse Response
+	if err := json.NewDecoder(createRec.Body).Decode(&createResponse); err != nil {
+		t.Fatalf("Failed to decode create response: %v", err)
+	}
+
+	id, ok := createResponse.Data.(map[string]any)["id"].(float64)
+	if !ok || id <= 0 {
+		t.Fatalf("Create response missing id: %v", createResponse.Data)
+	}
+	productURL := fmt.Sprintf("/products/%d", int(id))
+
+	// 2. Get the created product
+	getReq := httptest.NewRequest(http.MethodGet, productURL, nil)
+	getRec := httptest.NewRecorder()
+
+	handler.ServeHTTP(getRec, getReq)
+
+	if getRec.Code != http.StatusOK {
+		t.Fatalf("Get failed: expected status %d, got %d", http.StatusOK, getRec.Code)
+	}
+
+	// 3. Update the product with new category
+	updateBody, _ := json.Marshal(models.ProductInput{
+		Name:       "Updated Product",
+		Price:      pricePtr(199.99),
+		Stock:      20,
+		CategoryID: 2, // Change category
+	})
+	updateReq := httptest.NewRequest(http.MethodPut, productURL, bytes.NewBuffer(updateBody))
+	updateReq.Header.Set("Content-Type", "application/json")
+	updateReq.Header.Set("If-Match", `"1"`)
+	updateRec := httptest.NewRecorder()
+
+	handler.ServeHTTP(updateRec, updateReq)
+
+	if updateRec.Code != http.StatusOK {
+		t.Fatalf("Update failed: expected status %d, got %d", http.StatusOK, updateRec.Code)
+	}
+
+	// 4. Verify the update
+	verifyReq := httptest.NewRequest(http.MethodGet, productURL, nil)
+	verifyRec := httptest.NewRecorder()
+
+	handler.ServeHTTP(verifyRec, verifyReq)
+
+	var verifyResponse Response
+	if err := json.NewDecoder(verifyRec.Body).Decode(&verifyResponse); err != nil {
+		t.Fatalf("Failed to decode verify response: %v", err)
+	}
+
+	data := verifyResponse.Data.(map[string]any)
+	if data["name"] != "Updated Product" {
+		t.Errorf("Update not persisted: expected 'Updated Product', got '%v'", data["name"])
+	}
+
+	if data["id"] != id {
+		t.Errorf("Expected id %v after update, got %v", id, data["id"])
+	}
+
+	if data["category_id"] != float64(2) {
+		t.Errorf("Expected category_id 2 after update, got %v", data["category_id"])
+	}
+
+	// 5. Delete the product
+	deleteReq := httptest.NewRequest(http.MethodDelete, productURL, nil)
+	deleteRec := httptest.NewRecorder()
+
+	handler.ServeHTTP(deleteRec, deleteReq)
+
+	if deleteRec.Code != http.StatusOK {
+		t.Fatalf("Delete failed: expected status %d, got %d", http.StatusOK, deleteRec.Code)
+	}
+
+	// 6. Verify deletion
+	finalReq := httptest.NewRequest(http.MethodGet, productURL, nil)
+	finalRec := httptest.NewRecorder()
+
+	handler.ServeHTTP(finalRec, finalReq)
+
+	if finalRec.Code != http.StatusNotFound {
+		t.Errorf("Delete not persisted: expected status %d, got %d", http.StatusNotFound, finalRec.Code)
+	}
+}
+
+// TestSetActiveProducts_Success tests POST /products/set-active with known and unknown ids
+func TestSetActiveProducts_Success(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	body := []byte(`{"ids":[1,2,99],"active":false}`)
+	req := httptest.NewRequest(http.MethodPost, "/products/set-active", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data, ok := response.Data.(map[string]any)
+	if !ok {
+		t.Fatalf("Expected data to be an object, got %T", response.Data)
+	}
+	if data["updated"] != float64(2) {
+		t.Errorf("Expected 2 updated, got %v", data["updated"])
+	}
+	skipped, ok := data["skipped"].([]any)
+	if !ok || len(skipped) != 1 || skipped[0] != float64(99) {
+		t.Errorf("Expected skipped [99], got %v", data["skipped"])
+	}
+
+	// Verify the flag was persisted
+	getReq := httptest.NewRequest(http.MethodGet, "/products/1", nil)
+	getRec := httptest.NewRecorder()
+	handler.ServeHTTP(getRec, getReq)
+
+	var getResponse Response
+	if err := json.NewDecoder(getRec.Body).Decode(&getResponse); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	product := getResponse.Data.(map[string]any)
+	if product["active"] != false {
+		t.Errorf("Expected product 1 to be inactive, got %v", product["active"])
+	}
+}
+
+// TestSetActiveProducts_RepeatedIDs tests that an id listed twice is
+// updated once and, when unknown, skipped once
+func TestSetActiveProducts_RepeatedIDs(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	body := []byte(`{"ids":[1,99,1,99],"active":false}`)
+	req := httptest.NewRequest(http.MethodPost, "/products/set-active", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	data := response.Data.(map[string]any)
+	if data["updated"] != float64(1) {
+		t.Errorf("Expected 1 updated, got %v", data["updated"])
+	}
+	skipped, ok := data["skipped"].([]any)
+	if !ok || len(skipped) != 1 || skipped[0] != float64(99) {
+		t.Errorf("Expected skipped [99], got %v", data["skipped"])
+	}
+}
+
+// TestSetActiveProducts_Validation tests POST /products/set-active with invalid input
+func TestSetActiveProducts_Validation(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"empty ids", `{"ids":[],"active":true}`, "IDs are required"},
+		{"invalid id", `{"ids":[1,0],"active":true}`, "IDs must be positive integers"},
+		{"missing active", `{"ids":[1]}`, "Active is required"},
+		{"non-boolean active", `{"ids":[1],"active":"no"}`, "Invalid request body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/products/set-active", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.message {
+				t.Errorf("Expected message '%s', got '%s'", tt.message, response.Message)
+			}
+		})
+	}
+}
+
+// TestGetProductByID_CategoryRemovedAt tests that category_removed_at distinguishes a deleted category
+func TestGetProductByID_CategoryRemovedAt(t *testing.T) {
+	repo := newMockProductRepository()
+	removedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	repo.products[1] = models.Product{ID: 1, Name: "Orphaned", CategoryRemovedAt: &removedAt}
+	repo.products[2] = models.Product{ID: 2, Name: "Never categorized"}
+	handler := NewProductHandler(repo, "/products")
+
+	tests := []struct {
+		path     string
+		expected any
+	}{
+		{"/products/1", "2024-01-02T03:04:05Z"},
+		{"/products/2", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			data := response.Data.(map[string]any)
+			value, present := data["category_removed_at"]
+			if !present {
+				t.Fatal("Expected category_removed_at to be present")
+			}
+			if value != tt.expected {
+				t.Errorf("Expected category_removed_at %v, got %v", tt.expected, value)
+			}
+		})
+	}
+}
+
+// decodePaginationMeta decodes the meta object of a paginated response
+func decodePaginationMeta(t *testing.T, rec *httptest.ResponseRecorder) (Response, map[string]any) {
+	t.Helper()
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	meta, ok := response.Meta.(map[string]any)
+	if !ok {
+		t.Fatalf("Expected meta to be an object, got %T", response.Meta)
+	}
+	return response, meta
+}
+
+// TestListProducts_PaginationLinks tests link presence on the first, middle and last pages
+func TestListProducts_PaginationLinks(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	tests := []struct {
+		name     string
+		url      string
+		count    int
+		expected map[string]string
+	}{
+		{
+			name:  "first page",
+			url:   "/products?page=1&limit=2",
+			count: 2,
+			expected: map[string]string{
+				"first": "/products?limit=2&page=1",
+				"next":  "/products?limit=2&page=2",
+				"last":  "/products?limit=2&page=3",
+			},
+		},
+		{
+			name:  "middle page",
+			url:   "/products?page=2&limit=2",
+			count: 2,
+			expected: map[string]string{
+				"first": "/products?limit=2&page=1",
+				"prev":  "/products?limit=2&page=1",
+				"next":  "/products?limit=2&page=3",
+				"last":  "/products?limit=2&page=3",
+			},
+		},
+		{
+			name:  "last page",
+			url:   "/products?page=3&limit=2",
+			count: 1,
+			expected: map[string]string{
+				"first": "/products?limit=2&page=1",
+				"prev":  "/products?limit=2&page=2",
+			},
+		},
+		{
+			name:  "single page",
+			url:   "/products?limit=10",
+			count: 5,
+			expected: map[string]string{
+				"first": "/products?limit=10&page=1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			response, meta := decodePaginationMeta(t, rec)
+
+			data, ok := response.Data.([]any)
+			if !ok {
+				t.Fatalf("Expected data to be an array, got %T", response.Data)
+			}
+			if len(data) != tt.count {
+				t.Errorf("Expected %d products, got %d", tt.count, len(data))
+			}
+			if meta["total"] != float64(5) {
+				t.Errorf("Expected total 5, got %v", meta["total"])
+			}
+
+			links := meta["links"].(map[string]any)
+			for _, key := range []string{"first", "prev", "next", "last"} {
+				want, wantPresent := tt.expected[key]
+				got, present := links[key]
+				if present != wantPresent {
+					t.Errorf("Expected %s link present=%v, got %v", key, wantPresent, present)
+					continue
+				}
+				if present && got != want {
+					t.Errorf("Expected %s link '%s', got '%v'", key, want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestListProducts_InvalidPagination tests rejection of malformed page and limit values
+func TestListProducts_InvalidPagination(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	for _, url := range []string{"/products?page=0", "/products?page=abc", "/products?limit=0", "/products?limit=101"} {
+		t.Run(url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+// TestCreateProduct_NullPrice tests a product without a price round-trips as null when allowed
+func TestCreateProduct_NullPrice(t *testing.T) {
+	viper.Set("ALLOW_NULL_PRICE", true)
+	defer viper.Set("ALLOW_NULL_PRICE", nil)
+
+	handler := setupProductTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(`{"name":"Mystery Box","stock":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	getReq := httptest.NewRequest(http.MethodGet, "/products/1", nil)
+	getRec := httptest.NewRecorder()
+	handler.ServeHTTP(getRec, getReq)
+
+	var response Response
+	if err := json.NewDecoder(getRec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	price, present := data["price"]
+	if !present {
+		t.Fatal("Expected price key to be present")
+	}
+	if price != nil {
+		t.Errorf("Expected price to be null, got %v", price)
+	}
+}
+
+// TestCreateProduct_MissingPriceDefaultsToZero tests a missing price is stored as 0 when NULL prices are not allowed
+func TestCreateProduct_MissingPriceDefaultsToZero(t *testing.T) {
+	handler := setupProductTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(`{"name":"Freebie","stock":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	if data["price"] != float64(0) {
+		t.Errorf("Expected price 0, got %v", data["price"])
+	}
+}
+
+// TestGetRecentProducts tests GET /products/recent returns the newest products first
+func TestGetRecentProducts(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/recent?limit=2", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data, ok := response.Data.([]any)
+	if !ok {
+		t.Fatalf("Expected data to be an array, got %T", response.Data)
+	}
+	if len(data) != 2 {
+		t.Fatalf("Expected 2 products, got %d", len(data))
+	}
+	first := data[0].(map[string]any)
+	if first["name"] != "Apple Watch Series 9" {
+		t.Errorf("Expected newest product 'Apple Watch Series 9', got '%v'", first["name"])
+	}
+	if first["category"] == nil {
+		t.Error("Expected category to be included")
+	}
+}
+
+// TestGetReorderSuggestions tests GET /products/reorder-suggestions lists
+// products at their reorder point, most urgent first
+func TestGetReorderSuggestions(t *testing.T) {
+	repo := newMockProductRepository()
+	ctx := context.Background()
+	for _, p := range []models.Product{
+		{Name: "Paper", Stock: 8, ReorderPoint: 10, ReorderQty: 50},
+		{Name: "Toner", Stock: 0, ReorderPoint: 0, ReorderQty: 5},
+		{Name: "Staples", Stock: 2, ReorderPoint: 10, ReorderQty: 100},
+		{Name: "Pens", Stock: 30, ReorderPoint: 10, ReorderQty: 20},
+		{Name: "Clips", Stock: 0, ReorderPoint: 5},
+	} {
+		if _, err := repo.Create(ctx, p); err != nil {
+			t.Fatalf("Failed to seed product: %v", err)
+		}
+	}
+	handler := NewProductHandler(repo, "/products")
+
+	req := httptest.NewRequest(http.MethodGet, "/products/reorder-suggestions", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.([]any)
+	var names []string
+	for _, item := range data {
+		names = append(names, item.(map[string]any)["name"].(string))
+	}
+	if want := []string{"Toner", "Staples", "Paper"}; !slices.Equal(names, want) {
+		t.Errorf("Expected suggestions %v, got %v", want, names)
+	}
+	if qty := data[1].(map[string]any)["reorder_qty"]; qty != float64(100) {
+		t.Errorf("Expected Staples reorder_qty 100, got %v", qty)
+	}
+}
+
+// TestCreateProduct_NegativeReorderFields tests that reorder settings must be non-negative on write
+func TestCreateProduct_NegativeReorderFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		message string
+	}{
+		{"create reorder point", http.MethodPost, "/products", `{"name":"Pen","reorder_point":-1}`, "Reorder point cannot be negative"},
+		{"create reorder qty", http.MethodPost, "/products", `{"name":"Pen","reorder_qty":-1}`, "Reorder quantity cannot be negative"},
+		{"update reorder point", http.MethodPut, "/products/1", `{"name":"Pen","reorder_point":-3}`, "Reorder point cannot be negative"},
+		{"update reorder qty", http.MethodPut, "/products/1", `{"name":"Pen","reorder_qty":-3}`, "Reorder quantity cannot be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if errorMessage(response) != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, errorMessage(response))
+			}
+		})
+	}
+}
+
+// TestGetRecentProducts_InvalidLimit tests GET /products/recent with bad limits
+func TestGetRecentProducts_InvalidLimit(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	for _, url := range []string{"/products/recent?limit=abc", "/products/recent?limit=0", "/products/recent?limit=51"} {
+		t.Run(url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+// TestCreateProduct_StrictContentLength tests that a truncated body is rejected when strict checking is on
+func TestCreateProduct_StrictContentLength(t *testing.T) {
+	newTruncatedRequest := func() *http.Request {
+		body := `{"name":"Cable","price":5,"stock":1}`
+		req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		// Simulate a proxy that declared more bytes than it delivered
+		req.ContentLength = int64(len(body) + 20)
+		return req
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		handler := setupProductTestHandler()
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, newTruncatedRequest())
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		viper.Set("STRICT_CONTENT_LENGTH", true)
+		defer viper.Set("STRICT_CONTENT_LENGTH", nil)
+
+		handler := setupProductTestHandler()
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, newTruncatedRequest())
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+
+		var response Response
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Message != "Incomplete request body" {
+			t.Errorf("Expected message 'Incomplete request body', got '%s'", response.Message)
+		}
+	})
+
+	t.Run("enabled with complete body", func(t *testing.T) {
+		viper.Set("STRICT_CONTENT_LENGTH", true)
+		defer viper.Set("STRICT_CONTENT_LENGTH", nil)
+
+		handler := setupProductTestHandler()
+		req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(`{"name":"Cable","price":5,"stock":1}`+"\n"))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+		}
+	})
+}
+
+// TestGetProductByID_IncludeCategoryPath tests GET /products/{id}?include=category_path
+func TestGetProductByID_IncludeCategoryPath(t *testing.T) {
+	repo := newMockProductRepository()
+	parentID, childID := models.ID(1), models.ID(2)
+	repo.categories[1] = models.Category{ID: 1, Name: "Electronics"}
+	repo.categories[2] = models.Category{ID: 2, Name: "Phones", ParentID: &parentID}
+	repo.categories[3] = models.Category{ID: 3, Name: "Smartphones", ParentID: &childID}
+	_, _ = repo.Create(context.Background(), models.Product{Name: "iPhone 15 Pro", Price: pricePtr(999.99), CategoryID: 3})
+	handler := NewProductHandler(repo, "/products")
+
+	req := httptest.NewRequest(http.MethodGet, "/products/1?include=category_path", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	path, ok := data["category_path"].([]any)
+	if !ok {
+		t.Fatalf("Expected category_path to be an array, got %T", data["category_path"])
+	}
+
+	expected := []string{"Electronics", "Phones", "Smartphones"}
+	if len(path) != len(expected) {
+		t.Fatalf("Expected %d categories in path, got %d", len(expected), len(path))
+	}
+	for i, name := range expected {
+		if got := path[i].(map[string]any)["name"]; got != name {
+			t.Errorf("Expected path[%d] '%s', got '%v'", i, name, got)
+		}
+	}
+}
+
+// TestGetProductByID_WithoutInclude tests that category_path is omitted by default
+func TestGetProductByID_WithoutInclude(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/1", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	if _, present := data["category_path"]; present {
+		t.Error("Expected category_path to be omitted without include")
+	}
+}
+
+// TestGetProductByID_InvalidInclude tests GET /products/{id} with an unknown include token
+func TestGetProductByID_InvalidInclude(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/1?include=reviews", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// TestGetProductsByMultipleCategories tests GET /products?category_id=1,2
+func TestGetProductsByMultipleCategories(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+	repo := handler.repo.(*mockProductRepository)
+	_, _ = repo.Create(context.Background(), models.Product{Name: "T-Shirt", Price: pricePtr(19.99), Stock: 10, CategoryID: 2})
+	_, _ = repo.Create(context.Background(), models.Product{Name: "Novel", Price: pricePtr(9.99), Stock: 5, CategoryID: 3})
+
+	req := httptest.NewRequest(http.MethodGet, "/products?category_id=1,2", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data, ok := response.Data.([]any)
+	if !ok {
+		t.Fatalf("Expected data to be an array, got %T", response.Data)
+	}
+	if len(data) != 6 {
+		t.Errorf("Expected 6 products in categories 1 and 2, got %d", len(data))
+	}
+	for _, item := range data {
+		if item.(map[string]any)["name"] == "Novel" {
+			t.Error("Expected products from category 3 to be excluded")
+		}
+	}
+}
+
+// TestGetProductsByMultipleCategories_InvalidElement tests GET /products?category_id= with a bad element
+func TestGetProductsByMultipleCategories_InvalidElement(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	for _, url := range []string{"/products?category_id=1,abc", "/products?category_id=1,,2", "/products?category_id=1,-2"} {
+		t.Run(url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+// TestCreateProduct_CreatedBy tests that created_by is taken from X-User and defaults to "system"
+func TestCreateProduct_CreatedBy(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		expected string
+	}{
+		{"with header", "alice", "alice"},
+		{"without header", "", "system"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandler()
+
+			req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(`{"name":"Cable","price":5,"stock":1}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.user != "" {
+				req.Header.Set("X-User", tt.user)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			data := response.Data.(map[string]any)
+			if data["created_by"] != tt.expected {
+				t.Errorf("Expected created_by '%s', got '%v'", tt.expected, data["created_by"])
+			}
+		})
+	}
+}
+
+// TestGetUsedCategories tests GET /products/categories returns only categories with products
+func TestGetUsedCategories(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+	repo := handler.repo.(*mockProductRepository)
+	_, _ = repo.Create(context.Background(), models.Product{Name: "Novel", Price: pricePtr(9.99), Stock: 5, CategoryID: 3})
+	_, _ = repo.Create(context.Background(), models.Product{Name: "Loose Item", Price: pricePtr(1), Stock: 1})
+
+	req := httptest.NewRequest(http.MethodGet, "/products/categories", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data, ok := response.Data.([]any)
+	if !ok {
+		t.Fatalf("Expected data to be an array, got %T", response.Data)
+	}
+
+	expected := []string{"Books", "Electronics"}
+	if len(data) != len(expected) {
+		t.Fatalf("Expected %d categories, got %d", len(expected), len(data))
+	}
+	for i, name := range expected {
+		if got := data[i].(map[string]any)["name"]; got != name {
+			t.Errorf("Expected category[%d] '%s', got '%v'", i, name, got)
+		}
+	}
+}
+
+// TestCreateProduct_PriceRenderedWithTwoDecimals tests that whole-number prices keep their decimals in JSON
+func TestCreateProduct_PriceRenderedWithTwoDecimals(t *testing.T) {
+	handler := setupProductTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(`{"name":"Console","price":1000,"stock":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"price":1000.00`) {
+		t.Errorf("Expected price rendered as 1000.00, got %s", rec.Body.String())
+	}
+}
+
+// TestSuggestProducts tests GET /products/suggest returns matching names as a flat array
+func TestSuggestProducts(t *testing.T) {
+	tests := []struct {
+		url    string
+		status int
+		want   []string
+	}{
+		{"/products/suggest?q=i", http.StatusOK, []string{"iPad Air", "iPhone 15 Pro"}},
+		{"/products/suggest?q=IPH", http.StatusOK, []string{"iPhone 15 Pro"}},
+		{"/products/suggest?q=zz", http.StatusOK, []string{}},
+		{"/products/suggest?q=%20", http.StatusBadRequest, nil},
+		{"/products/suggest", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data []string `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Data == nil || !slices.Equal(response.Data, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, response.Data)
+			}
+		})
+	}
+}
+
+// TestSuggestProducts_Limit tests that at most maxSuggestions names are returned
+func TestSuggestProducts_Limit(t *testing.T) {
+	handler := setupProductTestHandler()
+	repo := handler.repo.(*mockProductRepository)
+	for i := range maxSuggestions + 5 {
+		repo.Create(context.Background(), models.Product{Name: fmt.Sprintf("Cable %02d", i), Price: pricePtr(1)})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/products/suggest?q=cab", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var response struct {
+		Data []string `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Data) != maxSuggestions || response.Data[0] != "Cable 00" {
+		t.Errorf("Expected the first %d cables, got %q", maxSuggestions, response.Data)
+	}
+}
+
+// TestSearchProducts tests GET /products?search= alone and combined with category_id
+func TestSearchProducts(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		names []string
+	}{
+		{"case-insensitive match", "/products?search=PRO", []string{"iPhone 15 Pro", "MacBook Pro M3", "AirPods Pro", "Pro Hoodie"}},
+		{"no matches", "/products?search=galaxy", []string{}},
+		{"combined with category", "/products?search=pro&category_id=2", []string{"Pro Hoodie"}},
+		{"empty search lists everything", "/products?search=", []string{"iPhone 15 Pro", "MacBook Pro M3", "AirPods Pro", "iPad Air", "Apple Watch Series 9", "Pro Hoodie"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+			repo := handler.repo.(*mockProductRepository)
+			_, _ = repo.Create(context.Background(), models.Product{Name: "Pro Hoodie", Price: pricePtr(49.99), Stock: 10, CategoryID: 2})
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			data, ok := response.Data.([]any)
+			if !ok {
+				t.Fatalf("Expected data to be an array, got %T", response.Data)
+			}
+
+			got := make([]string, 0, len(data))
+			for _, item := range data {
+				got = append(got, item.(map[string]any)["name"].(string))
+			}
+			if !slices.Equal(got, tt.names) {
+				t.Errorf("Expected %v, got %v", tt.names, got)
+			}
+		})
+	}
+}
+
+// TestSearchProducts_MaxResults tests that unpaginated searches are capped and flagged as truncated
+func TestSearchProducts_MaxResults(t *testing.T) {
+	viper.Set("SEARCH_MAX_RESULTS", 2)
+	defer viper.Set("SEARCH_MAX_RESULTS", nil)
+
+	tests := []struct {
+		name      string
+		url       string
+		count     int
+		truncated bool
+	}{
+		{"over the cap", "/products?search=pro", 2, true},
+		{"exactly at the cap", "/products?search=air", 2, false},
+		{"under the cap", "/products?search=watch", 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			data := response.Data.([]any)
+			if len(data) != tt.count {
+				t.Errorf("Expected %d products, got %d", tt.count, len(data))
+			}
+
+			meta, ok := response.Meta.(map[string]any)
+			if !ok {
+				t.Fatalf("Expected search meta, got %v", response.Meta)
+			}
+			if meta["truncated"] != tt.truncated {
+				t.Errorf("Expected truncated %v, got %v", tt.truncated, meta["truncated"])
+			}
+			if meta["limit"] != float64(2) {
+				t.Errorf("Expected limit 2, got %v", meta["limit"])
+			}
+		})
+	}
+}
+
+// TestSearchProducts_PaginatedIgnoresCap tests that paginated searches keep pagination meta
+func TestSearchProducts_PaginatedIgnoresCap(t *testing.T) {
+	viper.Set("SEARCH_MAX_RESULTS", 1)
+	defer viper.Set("SEARCH_MAX_RESULTS", nil)
+
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products?search=pro&limit=5", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if data := response.Data.([]any); len(data) != 3 {
+		t.Errorf("Expected 3 products, got %d", len(data))
+	}
+	meta := response.Meta.(map[string]any)
+	if meta["total"] != float64(3) {
+		t.Errorf("Expected pagination total 3, got %v", meta["total"])
+	}
+}
+
+// TestCompareProducts tests GET /products/compare pairs up fields and lists the differences
+func TestCompareProducts(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/compare?ids=1,4", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	fields := data["fields"].(map[string]any)
+	if name := fields["name"].([]any); name[0] != "iPhone 15 Pro" || name[1] != "iPad Air" {
+		t.Errorf("Expected the two names side by side, got %v", name)
+	}
+	if price := fields["price"].([]any); price[0] != 999.99 || price[1] != 599.99 {
+		t.Errorf("Expected the two prices side by side, got %v", price)
+	}
+
+	var differs []string
+	for _, field := range data["differs"].([]any) {
+		differs = append(differs, field.(string))
+	}
+	if want := []string{"name", "price", "stock"}; !slices.Equal(differs, want) {
+		t.Errorf("Expected differing fields %v, got %v", want, differs)
+	}
+}
+
+// TestCompareProducts_Errors tests GET /products/compare validation and missing products
+func TestCompareProducts_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		status  int
+		message string
+	}{
+		{"missing ids", "/products/compare", http.StatusBadRequest, "ids must list exactly two product IDs"},
+		{"one id", "/products/compare?ids=1", http.StatusBadRequest, "ids must list exactly two product IDs"},
+		{"three ids", "/products/compare?ids=1,2,3", http.StatusBadRequest, "ids must list exactly two product IDs"},
+		{"invalid id", "/products/compare?ids=1,x", http.StatusBadRequest, "ids must list exactly two product IDs"},
+		{"missing product", "/products/compare?ids=1,999", http.StatusNotFound, "Product not found: 999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, response.Message)
+			}
+		})
+	}
+}
+
+// TestSearchEndpoint_Pages tests GET /products/search pages through matches with a total count
+func TestSearchEndpoint_Pages(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		names []string
+		prev  bool
+		next  bool
+	}{
+		{"first page", "/products/search?q=pro&limit=2", []string{"iPhone 15 Pro", "MacBook Pro M3"}, false, true},
+		{"second page", "/products/search?q=PRO&page=2&limit=2", []string{"AirPods Pro"}, true, false},
+		{"past the end", "/products/search?q=pro&page=5&limit=2", []string{}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			names := []string{}
+			for _, item := range response.Data.([]any) {
+				names = append(names, item.(map[string]any)["name"].(string))
+			}
+			if !slices.Equal(names, tt.names) {
+				t.Errorf("Expected %v, got %v", tt.names, names)
+			}
+
+			meta := response.Meta.(map[string]any)
+			if meta["total"] != float64(3) || meta["total_pages"] != float64(2) {
+				t.Errorf("Expected 3 matches over 2 pages, got %v", meta)
+			}
+			links := meta["links"].(map[string]any)
+			if _, ok := links["prev"]; ok != tt.prev {
+				t.Errorf("Expected prev link present=%v, got %v", tt.prev, links)
+			}
+			if _, ok := links["next"]; ok != tt.next {
+				t.Errorf("Expected next link present=%v, got %v", tt.next, links)
+			}
+		})
+	}
+}
+
+// TestSearchEndpoint_Wildcards tests that LIKE wildcards in q match literally
+func TestSearchEndpoint_Wildcards(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/search?q=%25", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if data := response.Data.([]any); len(data) != 0 {
+		t.Errorf("Expected %% to match no product names, got %d", len(data))
+	}
+}
+
+// TestSearchEndpoint_Invalid tests GET /products/search parameter validation
+func TestSearchEndpoint_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+	}{
+		{"missing q", http.MethodGet, "/products/search", http.StatusBadRequest},
+		{"blank q", http.MethodGet, "/products/search?q=%20", http.StatusBadRequest},
+		{"invalid page", http.MethodGet, "/products/search?q=pro&page=0", http.StatusBadRequest},
+		{"invalid limit", http.MethodGet, "/products/search?q=pro&limit=101", http.StatusBadRequest},
+		{"wrong method", http.MethodPost, "/products/search?q=pro", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
+
+// TestListProducts_PriceRange tests GET /products?min_price=&max_price= including inclusive bounds
+func TestListProducts_PriceRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		names []string
+	}{
+		{"both bounds", "/products?min_price=300&max_price=1000", []string{"iPhone 15 Pro", "iPad Air", "Apple Watch Series 9"}},
+		{"inclusive bounds", "/products?min_price=249.99&max_price=399.99", []string{"AirPods Pro", "Apple Watch Series 9"}},
+		{"min only", "/products?min_price=1000", []string{"MacBook Pro M3"}},
+		{"max only", "/products?max_price=250", []string{"AirPods Pro"}},
+		{"equal bounds", "/products?min_price=599.99&max_price=599.99", []string{"iPad Air"}},
+		{"empty band", "/products?min_price=3000", []string{}},
+		{"combined with search", "/products?search=pro&max_price=1000", []string{"iPhone 15 Pro", "AirPods Pro"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			got := make([]string, 0)
+			for _, item := range response.Data.([]any) {
+				got = append(got, item.(map[string]any)["name"].(string))
+			}
+			if !slices.Equal(got, tt.names) {
+				t.Errorf("Expected %v, got %v", tt.names, got)
+			}
+		})
+	}
+}
+
+// TestListProducts_InvalidPriceRange tests that malformed or inverted price bounds are rejected
+func TestListProducts_InvalidPriceRange(t *testing.T) {
+	tests := []struct {
+		url     string
+		message string
+	}{
+		{"/products?min_price=abc", "Invalid min_price parameter (must be a non-negative number)"},
+		{"/products?min_price=-1", "Invalid min_price parameter (must be a non-negative number)"},
+		{"/products?max_price=NaN", "Invalid max_price parameter (must be a non-negative number)"},
+		{"/products?max_price=Inf", "Invalid max_price parameter (must be a non-negative number)"},
+		{"/products?min_price=500&max_price=100", "min_price cannot be greater than max_price"},
+	}
+
+	handler := setupProductTestHandlerWithData()
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.message {
+				t.Errorf("Expected message '%s', got '%s'", tt.message, response.Message)
+			}
+		})
+	}
+}
 
-	// 2. Get the created product
-	getReq := httptest.NewRequest(http.MethodGet, "/products/1", nil)
-	getRec := httptest.NewRecorder()
+// TestMoveProduct_Success tests POST /products/{id}/move changes only the category
+func TestMoveProduct_Success(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
 
-	handler.ServeHTTP(getRec, getReq)
+	req := httptest.NewRequest(http.MethodPost, "/products/1/move", bytes.NewBufferString(`{"category_id":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
 
-	if getRec.Code != http.StatusOK {
-		t.Fatalf("Get failed: expected status %d, got %d", http.StatusOK, getRec.Code)
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
 	}
 
-	// 3. Update the product with new category
-	updateBody, _ := json.Marshal(models.ProductInput{
-		Name:       "Updated Product",
-		Price:      199.99,
-		Stock:      20,
-		CategoryID: 2, // Change category
-	})
-	updateReq := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBuffer(updateBody))
-	updateReq.Header.Set("Content-Type", "application/json")
-	updateRec := httptest.NewRecorder()
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
 
-	handler.ServeHTTP(updateRec, updateReq)
+	data := response.Data.(map[string]any)
+	if data["category_id"] != float64(2) {
+		t.Errorf("Expected category_id 2, got %v", data["category_id"])
+	}
+	category, ok := data["category"].(map[string]any)
+	if !ok || category["id"] != float64(2) {
+		t.Errorf("Expected nested category 2, got %v", data["category"])
+	}
+	if data["name"] != "iPhone 15 Pro" || data["price"] != 999.99 || data["stock"] != float64(50) {
+		t.Errorf("Expected other fields unchanged, got %v", data)
+	}
 
-	if updateRec.Code != http.StatusOK {
-		t.Fatalf("Update failed: expected status %d, got %d", http.StatusOK, updateRec.Code)
+	// The move is recorded in the product's history
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products/1/history", nil))
+	var history Response
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	entries := history.Data.([]any)
+	last := entries[len(entries)-1].(map[string]any)
+	if last["event"] != "category_changed" || last["old_category_id"] != float64(1) || last["new_category_id"] != float64(2) {
+		t.Errorf("Expected the move recorded as 1 -> 2, got %v", last)
 	}
+}
 
-	// 4. Verify the update
-	verifyReq := httptest.NewRequest(http.MethodGet, "/products/1", nil)
-	verifyRec := httptest.NewRecorder()
+// TestMoveProduct_Errors tests POST /products/{id}/move failure cases
+func TestMoveProduct_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{"missing product", http.MethodPost, "/products/999/move", `{"category_id":2}`, http.StatusNotFound},
+		{"missing category", http.MethodPost, "/products/1/move", `{"category_id":999}`, http.StatusBadRequest},
+		{"no category_id", http.MethodPost, "/products/1/move", `{}`, http.StatusBadRequest},
+		{"invalid body", http.MethodPost, "/products/1/move", `{`, http.StatusBadRequest},
+		{"wrong method", http.MethodGet, "/products/1/move", ``, http.StatusMethodNotAllowed},
+		{"unknown sub-resource", http.MethodPost, "/products/1/copy", `{}`, http.StatusNotFound},
+	}
 
-	handler.ServeHTTP(verifyRec, verifyReq)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
 
-	var verifyResponse Response
-	if err := json.NewDecoder(verifyRec.Body).Decode(&verifyResponse); err != nil {
-		t.Fatalf("Failed to decode verify response: %v", err)
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
 	}
+}
 
-	data := verifyResponse.Data.(map[string]any)
-	if data["name"] != "Updated Product" {
-		t.Errorf("Update not persisted: expected 'Updated Product', got '%v'", data["name"])
+// TestGetProductRank tests GET /products/{id}/rank within the product's category
+func TestGetProductRank(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		rank  float64
+		total float64
+	}{
+		{"default by price", "/products/1/rank", 4, 5},
+		{"by price", "/products/3/rank?by=price", 1, 5},
+		{"by stock", "/products/1/rank?by=stock", 3, 5},
 	}
 
-	// 5. Delete the product
-	deleteReq := httptest.NewRequest(http.MethodDelete, "/products/1", nil)
-	deleteRec := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
 
-	handler.ServeHTTP(deleteRec, deleteReq)
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
 
-	if deleteRec.Code != http.StatusOK {
-		t.Fatalf("Delete failed: expected status %d, got %d", http.StatusOK, deleteRec.Code)
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			data := response.Data.(map[string]any)
+			if data["rank"] != tt.rank || data["total"] != tt.total {
+				t.Errorf("Expected rank %v of %v, got %v", tt.rank, tt.total, data)
+			}
+		})
 	}
+}
 
-	// 6. Verify deletion
-	finalReq := httptest.NewRequest(http.MethodGet, "/products/1", nil)
-	finalRec := httptest.NewRecorder()
+// TestGetProductRank_Errors tests GET /products/{id}/rank failure cases
+func TestGetProductRank_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+	}{
+		{"missing product", http.MethodGet, "/products/999/rank", http.StatusNotFound},
+		{"invalid by", http.MethodGet, "/products/1/rank?by=name", http.StatusBadRequest},
+		{"wrong method", http.MethodPost, "/products/1/rank", http.StatusMethodNotAllowed},
+	}
 
-	handler.ServeHTTP(finalRec, finalReq)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
 
-	if finalRec.Code != http.StatusNotFound {
-		t.Errorf("Delete not persisted: expected status %d, got %d", http.StatusNotFound, finalRec.Code)
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
+
+// TestListProducts_StockStatus tests GET /products?stock_status= buckets
+// against the low-stock threshold, alone and combined with category_id
+func TestListProducts_StockStatus(t *testing.T) {
+	viper.Set("LOW_STOCK_THRESHOLD", 40)
+	defer viper.Set("LOW_STOCK_THRESHOLD", nil)
+
+	tests := []struct {
+		name  string
+		url   string
+		names []string
+	}{
+		{"out", "/products?stock_status=out", []string{"Sold Out"}},
+		{"low", "/products?stock_status=low", []string{"MacBook Pro M3", "iPad Air", "Cable"}},
+		{"in", "/products?stock_status=in", []string{"iPhone 15 Pro", "AirPods Pro", "Apple Watch Series 9"}},
+		{"low in category", "/products?stock_status=low&category_id=1", []string{"MacBook Pro M3", "iPad Air"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockProductRepository()
+			repo.SeedData()
+			ctx := context.Background()
+			_, _ = repo.Create(ctx, models.Product{Name: "Sold Out", Price: pricePtr(5), Stock: 0, CategoryID: 2})
+			_, _ = repo.Create(ctx, models.Product{Name: "Cable", Price: pricePtr(5), Stock: 3, CategoryID: 2})
+			handler := NewProductHandler(repo, "/products")
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			var names []string
+			for _, item := range response.Data.([]any) {
+				names = append(names, item.(map[string]any)["name"].(string))
+			}
+			if !slices.Equal(names, tt.names) {
+				t.Errorf("Expected %v, got %v", tt.names, names)
+			}
+		})
+	}
+}
+
+// TestListProducts_InvalidStockStatus tests that an unknown stock_status is rejected
+func TestListProducts_InvalidStockStatus(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products?stock_status=plenty", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// TestListProducts_Sort tests GET /products?sort=&order= ordering of seeded products
+func TestListProducts_Sort(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		names []string
+	}{
+		{"price descending", "/products?sort=price&order=desc", []string{"MacBook Pro M3", "iPhone 15 Pro", "iPad Air", "Apple Watch Series 9", "AirPods Pro"}},
+		{"price ascending", "/products?sort=price", []string{"AirPods Pro", "Apple Watch Series 9", "iPad Air", "iPhone 15 Pro", "MacBook Pro M3"}},
+		{"stock ascending", "/products?sort=stock&order=asc", []string{"MacBook Pro M3", "iPad Air", "iPhone 15 Pro", "Apple Watch Series 9", "AirPods Pro"}},
+		{"id descending", "/products?order=desc", []string{"Apple Watch Series 9", "iPad Air", "AirPods Pro", "MacBook Pro M3", "iPhone 15 Pro"}},
+		{"sort with filter", "/products?search=pro&sort=name", []string{"AirPods Pro", "MacBook Pro M3", "iPhone 15 Pro"}},
+		{"value defaults to descending", "/products?sort=value", []string{"MacBook Pro M3", "iPhone 15 Pro", "AirPods Pro", "iPad Air", "Apple Watch Series 9"}},
+		{"value ascending", "/products?sort=value&order=asc", []string{"Apple Watch Series 9", "iPad Air", "AirPods Pro", "iPhone 15 Pro", "MacBook Pro M3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			got := make([]string, 0)
+			for _, item := range response.Data.([]any) {
+				got = append(got, item.(map[string]any)["name"].(string))
+			}
+			if !slices.Equal(got, tt.names) {
+				t.Errorf("Expected %v, got %v", tt.names, got)
+			}
+		})
+	}
+}
+
+// TestListProducts_SortByValueIncludesTotal tests that value sorts report
+// each product's price * stock and other sorts leave it out
+func TestListProducts_SortByValueIncludesTotal(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	for _, url := range []string{"/products?sort=value", "/products?sort=price"} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		var response Response
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		first := response.Data.([]any)[0].(map[string]any)
+		total, has := first["total_value"]
+		if url == "/products?sort=price" {
+			if has {
+				t.Errorf("%s: expected no total_value, got %v", url, total)
+			}
+			continue
+		}
+		// MacBook Pro M3: 2499.99 * 25
+		if total != 62499.75 {
+			t.Errorf("%s: expected total_value 62499.75, got %v", url, total)
+		}
+	}
+}
+
+// TestGetProductHistory tests GET /products/{id}/history merges creation,
+// price changes and category removal by time
+func TestGetProductHistory(t *testing.T) {
+	base := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	removedAt := base.Add(2 * time.Hour)
+
+	repo := newMockProductRepository()
+	repo.products[1] = models.Product{ID: 1, Name: "Pen", CreatedBy: "alice", CreatedAt: base, CategoryRemovedAt: &removedAt}
+	repo.changes = map[int][]models.ProductHistoryEntry{1: {
+		{At: base.Add(3 * time.Hour), Event: models.ProductPriceChanged, OldPrice: pricePtr(2), NewPrice: pricePtr(3)},
+		{At: base.Add(time.Hour), Event: models.ProductPriceChanged, OldPrice: pricePtr(1), NewPrice: pricePtr(2)},
+	}}
+	handler := NewProductHandler(repo, "/products")
+
+	req := httptest.NewRequest(http.MethodGet, "/products/1/history", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	var events []string
+	for _, item := range response.Data.([]any) {
+		events = append(events, item.(map[string]any)["event"].(string))
+	}
+	want := []string{"created", "price_changed", "category_removed", "price_changed"}
+	if !slices.Equal(events, want) {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+
+	first := response.Data.([]any)[0].(map[string]any)
+	if first["by"] != "alice" {
+		t.Errorf("Expected creation by alice, got %v", first["by"])
+	}
+	last := response.Data.([]any)[3].(map[string]any)
+	if last["old_price"] != float64(2) || last["new_price"] != float64(3) {
+		t.Errorf("Expected price change 2 -> 3, got %v", last)
+	}
+}
+
+// TestGetProductHistory_StockAndCategory tests that an update changing stock
+// and category shows up in the history with the old and new values
+func TestGetProductHistory_StockAndCategory(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	body := `{"name":"iPhone 15 Pro","price":999.99,"stock":45,"category_id":2}`
+	req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products/1/history", nil))
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	entries := response.Data.([]any)
+	if len(entries) != 3 {
+		t.Fatalf("Expected creation, stock and category entries, got %v", entries)
+	}
+
+	stock := entries[1].(map[string]any)
+	if stock["event"] != "stock_changed" || stock["old_stock"] != float64(50) || stock["new_stock"] != float64(45) {
+		t.Errorf("Expected stock change 50 -> 45, got %v", stock)
+	}
+	category := entries[2].(map[string]any)
+	if category["event"] != "category_changed" || category["old_category_id"] != float64(1) || category["new_category_id"] != float64(2) {
+		t.Errorf("Expected category change 1 -> 2, got %v", category)
+	}
+}
+
+// TestGetProductHistory_NotFound tests GET /products/{id}/history for a missing product
+func TestGetProductHistory_NotFound(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/999/history", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+// TestCountProducts tests GET /products/count globally and per category
+func TestCountProducts(t *testing.T) {
+	repo := newMockProductRepository()
+	repo.SeedData()
+	repo.products[6] = models.Product{ID: 6, Name: "Go Book", CategoryID: 3}
+	repo.products[7] = models.Product{ID: 7, Name: "Loose Cable"}
+	handler := NewProductHandler(repo, "/products")
+
+	tests := []struct {
+		url    string
+		status int
+		count  float64
+	}{
+		{"/products/count", http.StatusOK, 7},
+		{"/products/count?category_id=1", http.StatusOK, 5},
+		{"/products/count?category_id=1,3", http.StatusOK, 6},
+		{"/products/count?category_id=none", http.StatusOK, 1},
+		{"/products/count?category_id=2", http.StatusOK, 0},
+		{"/products/count?category_id=abc", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if count := response.Data.(map[string]any)["count"]; count != tt.count {
+				t.Errorf("Expected count %v, got %v", tt.count, count)
+			}
+		})
+	}
+}
+
+// TestListProducts_InvalidSort tests that sort fields and orders outside the whitelist are rejected
+func TestListProducts_InvalidSort(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	for _, url := range []string{"/products?sort=created_at", "/products?sort=price%3BDROP%20TABLE%20products", "/products?sort=price&order=sideways"} {
+		t.Run(url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+// TestOpaqueIDs_RoundTrip tests that with ID_FORMAT=opaque an id read from a response works in GET and PUT paths
+func TestOpaqueIDs_RoundTrip(t *testing.T) {
+	models.Configure(models.Settings{OpaqueIDs: true, PriceScale: 2})
+	defer models.Configure(models.DefaultSettings)
+
+	handler := setupProductTestHandlerWithData()
+
+	listRec := httptest.NewRecorder()
+	handler.ServeHTTP(listRec, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	var list Response
+	if err := json.NewDecoder(listRec.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	first := list.Data.([]any)[0].(map[string]any)
+	id, ok := first["id"].(string)
+	if !ok {
+		t.Fatalf("Expected an opaque string id, got %v", first["id"])
+	}
+	categoryID, ok := first["category_id"].(string)
+	if !ok {
+		t.Fatalf("Expected an opaque string category_id, got %v", first["category_id"])
+	}
+
+	getRec := httptest.NewRecorder()
+	handler.ServeHTTP(getRec, httptest.NewRequest(http.MethodGet, "/products/"+id, nil))
+	if getRec.Code != http.StatusOK {
+		t.Fatalf("GET with opaque id: expected status %d, got %d", http.StatusOK, getRec.Code)
+	}
+
+	body := fmt.Sprintf(`{"name":"Renamed","price":1,"stock":1,"category_id":%q}`, categoryID)
+	putReq := httptest.NewRequest(http.MethodPut, "/products/"+id, bytes.NewBufferString(body))
+	putReq.Header.Set("Content-Type", "application/json")
+	putReq.Header.Set("If-Match", "1")
+	putRec := httptest.NewRecorder()
+	handler.ServeHTTP(putRec, putReq)
+
+	if putRec.Code != http.StatusOK {
+		t.Fatalf("PUT with opaque id: expected status %d, got %d", http.StatusOK, putRec.Code)
+	}
+
+	var updated Response
+	if err := json.NewDecoder(putRec.Body).Decode(&updated); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	data := updated.Data.(map[string]any)
+	if data["id"] != id || data["category_id"] != categoryID || data["name"] != "Renamed" {
+		t.Errorf("Expected renamed product %s in category %s, got %v", id, categoryID, data)
+	}
+
+	// Sequential integers are not accepted while ids are opaque
+	intRec := httptest.NewRecorder()
+	handler.ServeHTTP(intRec, httptest.NewRequest(http.MethodGet, "/products/1", nil))
+	if intRec.Code != http.StatusBadRequest {
+		t.Errorf("GET with integer id: expected status %d, got %d", http.StatusBadRequest, intRec.Code)
 	}
 }
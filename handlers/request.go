@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/KAnggara75/BelajarGolang/config"
+	"github.com/KAnggara75/BelajarGolang/middleware"
+	"github.com/KAnggara75/BelajarGolang/models"
+)
+
+var (
+	errIncompleteBody = errors.New("incomplete request body")
+	errInvalidDate    = errors.New("invalid date")
+	errInvalidIDList  = errors.New("invalid id list")
+	errInvalidInclude = errors.New("invalid include")
+	errInvalidPrice   = errors.New("invalid price")
+	errInvalidVersion = errors.New("invalid version")
+)
+
+// maxSKULength matches the VARCHAR(64) sku column
+const maxSKULength = 64
+
+// skuPattern allows letters, digits and dashes
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// invalidSKU reports whether a non-empty sku is too long or contains anything
+// other than letters, digits and dashes
+func invalidSKU(sku string) bool {
+	return sku != "" && (len(sku) > maxSKULength || !skuPattern.MatchString(sku))
+}
+
+// maxDescriptionLength caps category and product descriptions; the columns
+// themselves are TEXT
+const maxDescriptionLength = 2000
+
+// descriptionTooLong reports whether description exceeds maxDescriptionLength characters
+func descriptionTooLong(description string) bool {
+	return utf8.RuneCountInString(description) > maxDescriptionLength
+}
+
+// validateProductInput trims the fields shared by product create and update,
+// defaults a missing price to zero unless null prices are allowed, and checks
+// them. It returns a *validationErrors listing every invalid field, or nil.
+func validateProductInput(input *models.ProductInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Description = strings.TrimSpace(input.Description)
+	input.SKU = strings.TrimSpace(input.SKU)
+
+	if input.Price == nil && !config.AllowNullPrice() {
+		input.Price = &models.Price{}
+	}
+
+	return validateStruct(input)
+}
+
+// validateCategory trims and checks a category from a create or update
+// request. It returns a *validationErrors listing every invalid field, or nil.
+func validateCategory(cat *models.Category) error {
+	cat.Name = strings.TrimSpace(cat.Name)
+	cat.Description = strings.TrimSpace(cat.Description)
+	return validateStruct(cat)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodeJSON decodes the request body into v. With strict content-length
+// checking enabled, a body shorter than the declared Content-Length is
+// reported as errIncompleteBody instead of a generic decode error.
+func decodeJSON(r *http.Request, v any) error {
+	if !config.IsStrictContentLength() || r.ContentLength < 0 {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+
+	counter := &countingReader{r: r.Body}
+	decodeErr := json.NewDecoder(counter).Decode(v)
+
+	// Drain the remainder so trailing bytes are counted too
+	_, _ = io.Copy(io.Discard, io.LimitReader(counter, r.ContentLength-counter.n))
+	if counter.n != r.ContentLength {
+		return errIncompleteBody
+	}
+
+	return decodeErr
+}
+
+// formFieldError reports a form field whose value could not be parsed
+type formFieldError struct {
+	field string
+	want  string
+}
+
+func (e *formFieldError) Error() string {
+	return "invalid form field " + e.field
+}
+
+// isFormRequest reports whether the request body is form-encoded rather than JSON
+func isFormRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// decodeBody decodes the request body into v. JSON is the default; a
+// form-encoded body is parsed and handed to fromForm instead.
+func decodeBody(r *http.Request, v any, fromForm func(form url.Values) error) error {
+	if !isFormRequest(r) {
+		return decodeJSON(r, v)
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	return fromForm(r.PostForm)
+}
+
+// categoryFromForm reads the category fields of a form-encoded body
+func categoryFromForm(form url.Values, cat *models.Category) error {
+	cat.Name = form.Get("name")
+	cat.Description = form.Get("description")
+	return nil
+}
+
+// productInputFromForm reads the product fields of a form-encoded body.
+// Empty numeric fields are left at their zero value, as when omitted from JSON.
+func productInputFromForm(form url.Values, input *models.ProductInput) error {
+	input.Name = form.Get("name")
+	input.Description = form.Get("description")
+
+	if value := strings.TrimSpace(form.Get("price")); value != "" {
+		price, err := models.ParsePrice(value)
+		if err != nil {
+			return &formFieldError{field: "price", want: "a number"}
+		}
+		input.Price = &price
+	}
+
+	if value := strings.TrimSpace(form.Get("stock")); value != "" {
+		stock, err := strconv.Atoi(value)
+		if err != nil {
+			return &formFieldError{field: "stock", want: "a whole number"}
+		}
+		input.Stock = models.Quantity(stock)
+	}
+
+	if value := strings.TrimSpace(form.Get("category_id")); value != "" {
+		id, err := models.ParseID(value)
+		if err != nil {
+			return &formFieldError{field: "category_id", want: "a valid ID"}
+		}
+		input.CategoryID = models.ID(id)
+	}
+
+	return nil
+}
+
+// requestVersion returns the version an update is conditioned on: the
+// If-Match header, which may be a bare version, the ETag of a product GET or
+// "*" for models.AnyVersion, or else the version field of the body. ok is
+// false when neither is present; err is set for an unparsable or negative
+// version.
+func requestVersion(r *http.Request, bodyVersion *int) (version int, ok bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if bodyVersion == nil {
+			return 0, false, nil
+		}
+		if *bodyVersion < 0 {
+			return 0, false, errInvalidVersion
+		}
+		return *bodyVersion, true, nil
+	}
+	if header == "*" {
+		return models.AnyVersion, true, nil
+	}
+
+	// A product ETag is "<version>-<hash>"; only the version is compared
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	tag, _, _ = strings.Cut(tag, "-")
+	version, err = strconv.Atoi(tag)
+	if err != nil || version < 0 {
+		return 0, false, errInvalidVersion
+	}
+	return version, true, nil
+}
+
+// decodeErrorMessage maps a decodeBody error to a client-facing message
+func decodeErrorMessage(err error) string {
+	if errors.Is(err, errIncompleteBody) {
+		return "Incomplete request body"
+	}
+	var fieldErr *formFieldError
+	if errors.As(err, &fieldErr) {
+		return fmt.Sprintf("Invalid %s: must be %s", fieldErr.field, fieldErr.want)
+	}
+	if errors.Is(err, models.ErrFractionalQuantity) {
+		return "Stock must be a whole number"
+	}
+	return "Invalid request body"
+}
+
+// parseIDList parses a comma-separated list of positive IDs in the configured format,
+// rejecting empty elements and lists longer than max
+func parseIDList(value string, max int) ([]int, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) > max {
+		return nil, errInvalidIDList
+	}
+
+	ids := make([]int, 0, len(parts))
+	for _, part := range parts {
+		id, err := models.ParseID(strings.TrimSpace(part))
+		if err != nil || id <= 0 {
+			return nil, errInvalidIDList
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parsePriceParam parses an optional non-negative price query parameter;
+// an empty value yields nil
+func parsePriceParam(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil || price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+		return nil, errInvalidPrice
+	}
+	return &price, nil
+}
+
+// parseDateParam parses an optional date query parameter, either RFC 3339
+// or YYYY-MM-DD meaning midnight UTC; an empty value yields nil. The result
+// is in UTC, like the stored timestamps.
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, value); err != nil {
+			return nil, errInvalidDate
+		}
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// parseIncludes parses a comma-separated include list, rejecting empty and
+// unknown tokens. Repeated tokens are accepted once.
+func parseIncludes(value string, allowed ...string) (map[string]bool, error) {
+	includes := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		token := strings.TrimSpace(part)
+		if !slices.Contains(allowed, token) {
+			return nil, errInvalidInclude
+		}
+		includes[token] = true
+	}
+	return includes, nil
+}
+
+// parseExpandCategory reports whether an ?expand= value asks for the
+// product category; an empty value expands nothing
+func parseExpandCategory(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	expand, err := parseIncludes(value, "category")
+	if err != nil {
+		return false, err
+	}
+	return expand["category"], nil
+}
+
+// resourcePath returns the request path below basePath without leading or
+// trailing slashes, so "/products", "/products/" and "/products/1/" map to
+// "" and "1". ok is false when a segment is empty, as in "/products//1".
+func resourcePath(r *http.Request, basePath string) (path string, ok bool) {
+	path = strings.TrimPrefix(r.URL.Path, basePath)
+	if strings.Contains(path, "//") {
+		return "", false
+	}
+	path = strings.TrimPrefix(path, "/")
+	return strings.TrimSuffix(path, "/"), true
+}
+
+// setRoute reports the route a request matched, path under basePath, as the
+// path label of its request metrics
+func setRoute(r *http.Request, basePath, path string) {
+	if path != "" {
+		basePath += "/" + path
+	}
+	middleware.SetRoute(r, basePath)
+}
+
+// idRoute returns the route of a single resource or one of its
+// sub-resources, with the id as {id} whatever the client sent
+func idRoute(sub string) string {
+	if sub == "" {
+		return "{id}"
+	}
+	return "{id}/" + sub
+}
+
+// requestUser returns the caller recorded as created_by, taken from the
+// X-User header and defaulting to "system"
+func requestUser(r *http.Request) string {
+	if user := strings.TrimSpace(r.Header.Get("X-User")); user != "" {
+		return user
+	}
+	return "system"
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KAnggara75/BelajarGolang/config"
+)
+
+// ProblemDetails is an RFC 7807 error body, sent instead of the Response
+// envelope when ERROR_FORMAT=problem. Code is an extension member carrying
+// the same error code as the envelope.
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+	// Errors is an extension member listing every invalid field of a request
+	Errors []fieldError `json:"errors,omitempty"`
+}
+
+// bareError is the error body sent to clients that opted out of the envelope
+type bareError struct {
+	Error  string       `json:"error"`
+	Code   string       `json:"code,omitempty"`
+	Errors []fieldError `json:"errors,omitempty"`
+}
+
+// wantsBare reports whether the client opted out of the Response envelope
+// with an X-Envelope: false header or ?envelope=false
+func wantsBare(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("X-Envelope"), "false") ||
+		strings.EqualFold(r.URL.Query().Get("envelope"), "false")
+}
+
+// encodeJSON writes v as the response body, indented by JSON_INDENT spaces
+// when configured. Every handler response body is written through here.
+func encodeJSON(w http.ResponseWriter, v any) {
+	enc := json.NewEncoder(w)
+	if indent := config.GetJSONIndent(); indent > 0 {
+		enc.SetIndent("", strings.Repeat(" ", indent))
+	}
+	enc.Encode(v)
+}
+
+// writeSuccess writes a successful response. Clients that opted out of the
+// envelope get the bare data, and meta is dropped. All handler sendSuccess
+// methods go through here.
+func writeSuccess(w http.ResponseWriter, r *http.Request, status int, message string, data, meta any) {
+	w.WriteHeader(status)
+	if wantsBare(r) {
+		encodeJSON(w, data)
+		return
+	}
+
+	encodeJSON(w, Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+		Meta:    meta,
+	})
+}
+
+// writeError writes an error response in the configured format, or as a
+// plain {"error": ...} body for clients that opted out of the envelope. Every
+// format carries code, one of the ErrCode constants. All handler sendError
+// methods go through here.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if wantsBare(r) {
+		w.WriteHeader(status)
+		encodeJSON(w, bareError{Error: message, Code: code})
+		return
+	}
+
+	if config.IsProblemErrorFormat() {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		encodeJSON(w, ProblemDetails{
+			Type:     "about:blank",
+			Title:    http.StatusText(status),
+			Status:   status,
+			Detail:   message,
+			Instance: r.URL.Path,
+			Code:     code,
+		})
+		return
+	}
+
+	w.WriteHeader(status)
+	encodeJSON(w, Response{
+		Success: false,
+		Message: message,
+		Code:    code,
+	})
+}
+
+// writeValidationError reports a request that failed validateStruct as a 422
+// "Validation failed" listing every invalid field: under data.errors in the
+// envelope, or as an errors member in the problem and bare formats. Any other
+// error is reported as a 500.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr *validationErrors
+	if !errors.As(err, &verr) {
+		writeServerError(w, r, err, "Failed to validate request")
+		return
+	}
+
+	// A body that decoded but holds invalid values is a 422; a body that
+	// cannot be decoded stays a 400
+	const status, message = http.StatusUnprocessableEntity, "Validation failed"
+	if wantsBare(r) {
+		w.WriteHeader(status)
+		encodeJSON(w, bareError{Error: message, Code: ErrCodeValidation, Errors: verr.fields})
+		return
+	}
+
+	if config.IsProblemErrorFormat() {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		encodeJSON(w, ProblemDetails{
+			Type:     "about:blank",
+			Title:    http.StatusText(status),
+			Status:   status,
+			Detail:   message,
+			Instance: r.URL.Path,
+			Code:     ErrCodeValidation,
+			Errors:   verr.fields,
+		})
+		return
+	}
+
+	w.WriteHeader(status)
+	encodeJSON(w, Response{
+		Success: false,
+		Message: message,
+		Code:    ErrCodeValidation,
+		Data:    map[string]any{"errors": verr.fields},
+	})
+}
+
+// writeServerError reports a failed repository call. A query cut off by
+// DB_QUERY_TIMEOUT is a 503 "Service timeout"; anything else is a 500 with
+// message. All handler sendServerError methods go through here.
+func writeServerError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeTimeout, "Service timeout")
+		return
+	}
+	writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, message)
+}
+
+// computeETag returns a strong ETag for v: the SHA-256 of its JSON encoding,
+// so any field change, updated_at included, yields a new tag
+func computeETag(v any) string {
+	body, _ := json.Marshal(v)
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// versionedETag returns a strong ETag of the form "<version>-<hash>": the
+// hash covers the whole body, as in computeETag, and the version prefix lets
+// requestVersion accept the tag back in If-Match
+func versionedETag(version int, v any) string {
+	return `"` + strconv.Itoa(version) + "-" + strings.Trim(computeETag(v), `"`) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value lists etag or is
+// "*". Tags are compared weakly, as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOptions answers an OPTIONS request with 204 and the route's methods in
+// the Allow header
+func writeOptions(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMethodNotAllowed answers 405 with the route's methods in the Allow
+// header, as RFC 9110 requires. All handler methodNotAllowed methods go
+// through here.
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+}
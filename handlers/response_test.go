@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// TestErrorFormat_Problem tests that errors use application/problem+json when ERROR_FORMAT=problem
+func TestErrorFormat_Problem(t *testing.T) {
+	viper.Set("ERROR_FORMAT", "problem")
+	defer viper.Set("ERROR_FORMAT", nil)
+
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/999", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Expected Content-Type 'application/problem+json', got '%s'", got)
+	}
+
+	var problem map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	want := map[string]any{
+		"type":     "about:blank",
+		"title":    "Not Found",
+		"status":   float64(http.StatusNotFound),
+		"detail":   "Product not found",
+		"instance": "/products/999",
+		"code":     ErrCodeProductNotFound,
+	}
+	for key, value := range want {
+		if problem[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, problem[key])
+		}
+	}
+	if _, ok := problem["success"]; ok {
+		t.Error("Expected no envelope fields in a problem response")
+	}
+}
+
+// errorMessage returns what a decoded error response reports: the field
+// messages of a validation failure, joined with "; ", or else the message
+func errorMessage(response Response) string {
+	data, _ := response.Data.(map[string]any)
+	fields, _ := data["errors"].([]any)
+	if response.Message != "Validation failed" || len(fields) == 0 {
+		return response.Message
+	}
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i], _ = field.(map[string]any)["message"].(string)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// TestErrorFormat_ProblemValidation tests that a validation failure lists its
+// field errors as a problem extension member
+func TestErrorFormat_ProblemValidation(t *testing.T) {
+	viper.Set("ERROR_FORMAT", "problem")
+	defer viper.Set("ERROR_FORMAT", nil)
+
+	handler := setupProductTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name":"","stock":-1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+
+	var problem ProblemDetails
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := []fieldError{
+		{Field: "name", Message: "Name is required"},
+		{Field: "stock", Message: "Stock cannot be negative"},
+	}
+	if problem.Status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected problem status %d, got %d", http.StatusUnprocessableEntity, problem.Status)
+	}
+	if problem.Detail != "Validation failed" || problem.Code != ErrCodeValidation || !slices.Equal(problem.Errors, want) {
+		t.Errorf("Expected Validation failed with %v, got %+v", want, problem)
+	}
+}
+
+// TestErrorFormat_DefaultEnvelope tests that errors keep the Response envelope by default
+func TestErrorFormat_DefaultEnvelope(t *testing.T) {
+	handler := setupTestHandler()
+
+	req := httptest.NewRequest(http.MethodPatch, "/categories", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type 'application/json', got '%s'", got)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Success || response.Message != "Method not allowed" || response.Code != ErrCodeMethodNotAllowed {
+		t.Errorf("Unexpected envelope: %+v", response)
+	}
+}
+
+// TestEnvelope_Bare tests that X-Envelope: false and ?envelope=false return bare resources and errors
+func TestEnvelope_Bare(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header string
+	}{
+		{"header", "/products/1", "false"},
+		{"query parameter", "/products/1?envelope=false", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupProductTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Envelope", tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var product map[string]any
+			if err := json.NewDecoder(rec.Body).Decode(&product); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if product["name"] != "iPhone 15 Pro" {
+				t.Errorf("Expected the bare product, got %v", product)
+			}
+			if _, ok := product["success"]; ok {
+				t.Error("Expected no envelope fields in a bare response")
+			}
+		})
+	}
+}
+
+// TestEnvelope_BareList tests that a bare listing is a plain JSON array
+func TestEnvelope_BareList(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.Header.Set("X-Envelope", "false")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var products []map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&products); err != nil {
+		t.Fatalf("Expected a JSON array: %v", err)
+	}
+	if len(products) != 5 {
+		t.Errorf("Expected 5 products, got %d", len(products))
+	}
+}
+
+// TestEnvelope_BareError tests that failures without the envelope use status plus {"error": ..., "code": ...}
+func TestEnvelope_BareError(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/999", nil)
+	req.Header.Set("X-Envelope", "false")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	var body map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body) != 2 || body["error"] != "Product not found" || body["code"] != ErrCodeProductNotFound {
+		t.Errorf(`Expected {"error":"Product not found","code":"PRODUCT_NOT_FOUND"}, got %v`, body)
+	}
+}
+
+// TestEnvelope_Default tests that the envelope is kept unless the client opts out
+func TestEnvelope_Default(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/1", nil)
+	req.Header.Set("X-Envelope", "true")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !response.Success || response.Data == nil {
+		t.Errorf("Expected an enveloped response, got %+v", response)
+	}
+}
+
+// TestJSONIndent tests that JSON_INDENT indents response bodies and that the
+// default keeps them compact
+func TestJSONIndent(t *testing.T) {
+	tests := []struct {
+		name   string
+		indent any
+		want   string
+	}{
+		{"compact by default", nil, `{"success":true,"message":"Category retrieved successfully","data":{"id":1,`},
+		{"zero is compact", 0, `{"success":true,"message":"Category retrieved successfully","data":{"id":1,`},
+		{"two spaces", 2, "{\n  \"success\": true,\n  \"message\": \"Category retrieved successfully\",\n  \"data\": {\n    \"id\": 1,"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("JSON_INDENT", tt.indent)
+			defer viper.Set("JSON_INDENT", nil)
+
+			handler := setupTestHandlerWithData()
+
+			req := httptest.NewRequest(http.MethodGet, "/categories/1", nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if body := rec.Body.String(); !strings.HasPrefix(body, tt.want) {
+				t.Errorf("Expected body to start with %q, got %q", tt.want, body)
+			}
+		})
+	}
+}
+
+// TestServerError_Timeout tests that a repository call cut off by its
+// deadline is reported as 503 rather than 500
+func TestServerError_Timeout(t *testing.T) {
+	handler := setupProductTestHandlerWithData()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/products/1", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Success || response.Message != "Service timeout" || response.Code != ErrCodeTimeout {
+		t.Errorf("Expected a Service timeout error, got %+v", response)
+	}
+}
+
+// TestServerError_Other tests that other repository failures stay 500
+func TestServerError_Other(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeServerError(rec, httptest.NewRequest(http.MethodGet, "/products", nil), context.Canceled, "Failed to retrieve products")
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Code != ErrCodeInternal {
+		t.Errorf("Expected code %s, got %q", ErrCodeInternal, response.Code)
+	}
+}
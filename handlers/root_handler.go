@@ -0,0 +1,54 @@
+package handlers
+
+import "net/http"
+
+// serviceName is reported by GET / to identify the API
+const serviceName = "BelajarGolang"
+
+// rootEndpoints lists the top-level resources advertised by GET /
+var rootEndpoints = []string{
+	APIVersionPrefix + "/categories",
+	APIVersionPrefix + "/products",
+	APIVersionPrefix + "/admin/catalog/import",
+	APIVersionPrefix + "/admin/products/anomalies",
+	"/health",
+	"/metrics",
+}
+
+// ServiceInfo describes the API at its base URL
+type ServiceInfo struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// RootHandler serves a service descriptor at GET /
+type RootHandler struct {
+	version string
+}
+
+func NewRootHandler(version string) *RootHandler {
+	return &RootHandler{version: version}
+}
+
+// ServeHTTP answers the exact root path. Registered at "/", it also receives
+// every path no other route matched and answers those with a JSON 404.
+func (h *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path != "/" {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	writeSuccess(w, r, http.StatusOK, "Service information retrieved successfully", ServiceInfo{
+		Name:      serviceName,
+		Version:   h.version,
+		Endpoints: rootEndpoints,
+	}, nil)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRoot tests GET / returns the service descriptor
+func TestRoot(t *testing.T) {
+	handler := NewRootHandler("1.2.3")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type 'application/json', got '%s'", got)
+	}
+
+	var response Response
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data := response.Data.(map[string]any)
+	if data["name"] != "BelajarGolang" || data["version"] != "1.2.3" {
+		t.Errorf("Unexpected descriptor: %v", data)
+	}
+	endpoints, ok := data["endpoints"].([]any)
+	if !ok || len(endpoints) == 0 || endpoints[0] != "/v1/categories" {
+		t.Errorf("Expected the top-level endpoints, got %v", data["endpoints"])
+	}
+}
+
+// TestRoot_MethodNotAllowed tests that only GET is accepted on /
+func TestRoot_MethodNotAllowed(t *testing.T) {
+	handler := NewRootHandler("dev")
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			req := httptest.NewRequest(method, "/", nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+			}
+		})
+	}
+}
+
+// TestUnknownRoute tests that unmatched paths get a JSON 404 while the real
+// routes registered beside / keep working
+func TestUnknownRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/products", setupProductTestHandlerWithData())
+	mux.Handle("/products/", setupProductTestHandlerWithData())
+	mux.Handle("/categories", setupTestHandlerWithData())
+	mux.Handle("/", NewRootHandler("dev"))
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/productz", http.StatusNotFound},
+		{"/unknown/deeper/path", http.StatusNotFound},
+		{"/products", http.StatusOK},
+		{"/products/1", http.StatusOK},
+		{"/categories", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Expected Content-Type 'application/json', got '%s'", got)
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if tt.status == http.StatusNotFound && (response.Success || response.Message != "Not found") {
+				t.Errorf("Expected the JSON not-found envelope, got %+v", response)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/KAnggara75/BelajarGolang/config"
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/go-playground/validator/v10"
+)
+
+// validate checks the validate struct tags on request models. Besides the
+// built-in rules it knows sku, the product SKU format, and for prices
+// price_min, non-negative, price_scale, the PRICE_SCALE decimal limit, and
+// price_max, the maxPrice bound.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by their JSON name, as clients know them
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	v.RegisterValidation("sku", func(fl validator.FieldLevel) bool {
+		return !invalidSKU(fl.Field().String())
+	})
+	v.RegisterValidation("price_min", func(fl validator.FieldLevel) bool {
+		return !fieldPrice(fl).IsNegative()
+	})
+	v.RegisterValidation("price_scale", func(fl validator.FieldLevel) bool {
+		return fieldPrice(fl).FitsScale(models.PriceScale())
+	})
+	v.RegisterValidation("price_max", func(fl validator.FieldLevel) bool {
+		return !fieldPrice(fl).GreaterThan(maxPrice().Decimal)
+	})
+
+	return v
+}
+
+// fieldPrice returns the price a price_* rule is checking
+func fieldPrice(fl validator.FieldLevel) models.Price {
+	return fl.Field().Interface().(models.Price)
+}
+
+// maxPrice returns the highest accepted price: MAX_PRICE, lowered to what
+// the price column holds at PRICE_SCALE so a price never overflows it
+func maxPrice() models.Price {
+	configured := models.NewPrice(config.GetMaxPrice())
+	if column := models.MaxPrice(models.PriceScale()); column.LessThan(configured.Decimal) {
+		return column
+	}
+	return configured
+}
+
+// priceText renders a price in a message with the decimals JSON gives it
+func priceText(p models.Price) string {
+	return p.StringFixed(int32(models.PriceScale()))
+}
+
+// fieldLabels names fields in messages where capitalizing the JSON name
+// would read badly
+var fieldLabels = map[string]string{
+	"sku":         "SKU",
+	"reorder_qty": "Reorder quantity",
+}
+
+// fieldLabel returns the name a message uses for a field: "reorder_point"
+// becomes "Reorder point"
+func fieldLabel(field string) string {
+	if label, ok := fieldLabels[field]; ok {
+		return label
+	}
+	label := strings.ReplaceAll(field, "_", " ")
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+// fieldError is one invalid field of a request, by JSON name. Field is a
+// path such as products[2].price in a list, and empty when the problem is
+// with the body as a whole.
+type fieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// validationErrors reports every invalid field of a request body, in struct
+// field order
+type validationErrors struct {
+	fields []fieldError
+}
+
+// Error joins every message, for contexts with room for only one string
+func (e *validationErrors) Error() string {
+	messages := make([]string, len(e.fields))
+	for i, f := range e.fields {
+		messages[i] = f.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// add records an invalid field
+func (e *validationErrors) add(field, message string) {
+	e.fields = append(e.fields, fieldError{Field: field, Message: message})
+}
+
+// addRow records the invalid fields validateStruct found in one row of a
+// list, prefixing each with the row, as in categories[1].name. Any other
+// error is returned.
+func (e *validationErrors) addRow(row string, err error) error {
+	var verr *validationErrors
+	if !errors.As(err, &verr) {
+		return err
+	}
+	for _, f := range verr.fields {
+		e.add(row+"."+f.Field, f.Message)
+	}
+	return nil
+}
+
+// orNil returns e, or nil when no field was recorded
+func (e *validationErrors) orNil() error {
+	if len(e.fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// validateStruct checks v against its validate tags, returning a
+// *validationErrors listing every invalid field, or nil
+func validateStruct(v any) error {
+	err := validate.Struct(v)
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	verr := &validationErrors{fields: make([]fieldError, 0, len(fieldErrs))}
+	for _, fe := range fieldErrs {
+		verr.fields = append(verr.fields, fieldError{Field: fe.Field(), Message: fieldMessage(fe)})
+	}
+	return verr
+}
+
+// fieldMessage renders a failed rule in the wording the API has always used
+func fieldMessage(fe validator.FieldError) string {
+	label := fieldLabel(fe.Field())
+	switch fe.Tag() {
+	case "required":
+		return label + " is required"
+	case "max":
+		return fmt.Sprintf("%s too long (max %s characters)", label, fe.Param())
+	case "gte", "price_min":
+		return label + " cannot be negative"
+	case "sku":
+		return fmt.Sprintf("%s must contain only letters, digits and dashes (max %d characters)", label, maxSKULength)
+	case "price_scale":
+		return fmt.Sprintf("%s cannot have more than %d decimal places", label, models.PriceScale())
+	case "price_max":
+		return fmt.Sprintf("%s exceeds maximum (%s)", label, priceText(maxPrice()))
+	}
+	return "Invalid " + fe.Field()
+}
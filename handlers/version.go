@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// APIVersionPrefix is the path prefix the versioned API is mounted under
+const APIVersionPrefix = "/v1"
+
+// VersionRedirect sends requests for a path from before versioning to the
+// same path under a version prefix, keeping the query string
+type VersionRedirect struct {
+	prefix string
+}
+
+func NewVersionRedirect(prefix string) *VersionRedirect {
+	return &VersionRedirect{prefix: prefix}
+}
+
+// ServeHTTP answers GET and HEAD with 301 as the move is permanent. Other
+// methods get 308, which keeps the method and body where a 301 would let
+// clients retry a POST as a GET.
+func (h *VersionRedirect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := url.URL{Path: h.prefix + r.URL.Path, RawQuery: r.URL.RawQuery}
+
+	status := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		status = http.StatusMovedPermanently
+	}
+
+	// With a Content-Type already set, http.Redirect sends no HTML body
+	w.Header().Set("Content-Type", "application/json")
+	http.Redirect(w, r, target.String(), status)
+}
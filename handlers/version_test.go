@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newVersionedMux mounts the product and category handlers under /v1 with
+// redirects from the unversioned paths, as main does
+func newVersionedMux() *http.ServeMux {
+	productRepo := newMockProductRepository()
+	productRepo.SeedData()
+	categoryRepo := newMockCategoryRepository()
+	categoryRepo.SeedData()
+
+	products := NewProductHandler(productRepo, APIVersionPrefix+"/products")
+	categories := NewCategoryHandler(categoryRepo, productRepo, APIVersionPrefix+"/categories")
+	redirect := NewVersionRedirect(APIVersionPrefix)
+
+	mux := http.NewServeMux()
+	mux.Handle(APIVersionPrefix+"/products", products)
+	mux.Handle(APIVersionPrefix+"/products/", products)
+	mux.Handle(APIVersionPrefix+"/categories", categories)
+	mux.Handle(APIVersionPrefix+"/categories/", categories)
+	mux.Handle("/products", redirect)
+	mux.Handle("/products/", redirect)
+	mux.Handle("/categories", redirect)
+	mux.Handle("/categories/", redirect)
+	return mux
+}
+
+// TestVersionedRoutes tests that handlers route correctly under /v1
+func TestVersionedRoutes(t *testing.T) {
+	mux := newVersionedMux()
+
+	tests := []struct {
+		path   string
+		status int
+		name   string
+	}{
+		{"/v1/products/1", http.StatusOK, "iPhone 15 Pro"},
+		{"/v1/products/count", http.StatusOK, ""},
+		{"/v1/categories/1", http.StatusOK, "Electronics"},
+		{"/v1/products/999", http.StatusNotFound, ""},
+		{"/v1/products/abc", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.name == "" {
+				return
+			}
+
+			var response Response
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got := response.Data.(map[string]any)["name"]; got != tt.name {
+				t.Errorf("Expected %s, got %v", tt.name, got)
+			}
+		})
+	}
+}
+
+// TestVersionRedirect tests that unversioned paths redirect to /v1 with the
+// query string kept and the method preserved for writes
+func TestVersionRedirect(t *testing.T) {
+	mux := newVersionedMux()
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{http.MethodGet, "/products/1", http.StatusMovedPermanently, "/v1/products/1"},
+		{http.MethodGet, "/products?sort=price&order=desc", http.StatusMovedPermanently, "/v1/products?sort=price&order=desc"},
+		{http.MethodGet, "/categories", http.StatusMovedPermanently, "/v1/categories"},
+		{http.MethodPost, "/products", http.StatusPermanentRedirect, "/v1/products"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(`{}`))
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != tt.location {
+				t.Errorf("Expected Location %s, got %s", tt.location, got)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("Expected no body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
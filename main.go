@@ -5,39 +5,43 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"strings"
 
 	"github.com/KAnggara75/BelajarGolang/config"
 	"github.com/KAnggara75/BelajarGolang/database"
 	"github.com/KAnggara75/BelajarGolang/handlers"
+	"github.com/KAnggara75/BelajarGolang/middleware"
+	"github.com/KAnggara75/BelajarGolang/models"
 	"github.com/KAnggara75/BelajarGolang/repository"
-	"github.com/spf13/viper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func init() {
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-
-	if _, err := os.Stat(".env"); err == nil {
-		viper.SetConfigFile(".env")
-		_ = viper.ReadInConfig()
+	if path := config.LoadEnv(); path != "" {
+		log.Println("Loaded environment from", path)
 	}
 }
 
 func main() {
+	// Id and price encoding is fixed for the life of the process
+	models.Configure(models.Settings{
+		OpaqueIDs:  config.IsOpaqueIDFormat(),
+		PriceScale: config.GetPriceScale(),
+	})
+
 	// Get database URL
 	dbURL := config.GetDatabaseURL()
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL is not set. Please set DATABASE_URL environment variable or add it to .env file")
+	if err := config.ValidateDatabaseURL(dbURL); err != nil {
+		log.Fatal("Invalid database configuration: ", err)
 	}
 
 	// Initialize database
-	db, err := database.InitDB(dbURL)
+	db, err := database.InitDBWithRetry(dbURL, config.GetDBConnectAttempts(), config.GetDBConnectBackoff())
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
-	defer db.Close(context.Background())
+	defer db.Close()
 
 	// Run migrations
 	if err := database.RunMigrations(db); err != nil {
@@ -52,37 +56,116 @@ func main() {
 		log.Fatal("Failed to seed products:", err)
 	}
 
+	// Optionally verify CRUD paths end-to-end before taking traffic
+	if config.IsSelfTestEnabled() {
+		if err := repository.RunSelfTest(db); err != nil {
+			log.Fatal("Startup self-test failed:", err)
+		}
+	}
+
 	// Initialize repositories
 	categoryRepo := repository.NewCategoryRepository(db)
 	productRepo := repository.NewProductRepository(db)
+	catalogRepo := repository.NewCatalogRepository(db)
 
 	// Initialize handlers
-	categoryHandler := handlers.NewCategoryHandler(categoryRepo)
-	productHandler := handlers.NewProductHandler(productRepo)
+	v1 := handlers.APIVersionPrefix
+	categoryHandler := handlers.NewCategoryHandler(categoryRepo, productRepo, v1+"/categories")
+	productHandler := handlers.NewProductHandler(productRepo, v1+"/products")
+	catalogHandler := handlers.NewCatalogHandler(catalogRepo, v1+"/admin/catalog")
+	adminHandler := handlers.NewAdminHandler(productRepo, v1+"/admin/products")
+	healthHandler := handlers.NewHealthHandler(db)
+	rootHandler := handlers.NewRootHandler(config.GetAppVersion())
 
-	// Setup routes
-	http.Handle("/categories", categoryHandler)
-	http.Handle("/categories/", categoryHandler)
-	http.Handle("/products", productHandler)
-	http.Handle("/products/", productHandler)
+	// Metrics are served from their own registry in the Prometheus text
+	// format, outside the JSON envelope
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	requestMetrics := middleware.NewRequestMetrics(registry)
+	catalogGauges := handlers.NewCatalogGauges(registry, productRepo, categoryRepo)
+	go catalogGauges.Run(context.Background(), config.GetMetricsRefreshInterval())
+
+	// Setup routes. The API lives under /v1; the probe, metrics and the
+	// service descriptor stay unversioned.
+	http.Handle(v1+"/categories", categoryHandler)
+	http.Handle(v1+"/categories/", categoryHandler)
+	http.Handle(v1+"/products", productHandler)
+	http.Handle(v1+"/products/", productHandler)
+	http.Handle(v1+"/admin/catalog/", catalogHandler)
+	http.Handle(v1+"/admin/products/", adminHandler)
+	http.Handle("/health", healthHandler)
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	http.Handle("/", rootHandler)
+
+	// Paths from before versioning redirect to their /v1 equivalents
+	versionRedirect := handlers.NewVersionRedirect(v1)
+	for _, path := range []string{"/categories", "/categories/", "/products", "/products/", "/admin/catalog/", "/admin/products/"} {
+		http.Handle(path, versionRedirect)
+	}
 
 	// Start server
 	port := config.GetPort()
 	fmt.Printf("🚀 Server starting on http://localhost%s\n", port)
-	fmt.Println("📦 Available endpoints:")
-	fmt.Println("   GET    /categories      - Get all categories")
-	fmt.Println("   POST   /categories      - Create a category")
-	fmt.Println("   GET    /categories/{id} - Get a category by ID")
-	fmt.Println("   PUT    /categories/{id} - Update a category")
-	fmt.Println("   DELETE /categories/{id} - Delete a category")
+	fmt.Println("📦 Available endpoints (unversioned paths redirect to /v1):")
+	fmt.Println("   GET    /                - Service name, version and top-level endpoints")
 	fmt.Println("")
-	fmt.Println("   GET    /products        - Get all products")
-	fmt.Println("   POST   /products        - Create a product")
-	fmt.Println("   GET    /products/{id}   - Get a product by ID")
-	fmt.Println("   PUT    /products/{id}   - Update a product")
-	fmt.Println("   DELETE /products/{id}   - Delete a product")
+	fmt.Println("   GET    /v1/categories      - Get all categories (?with_counts=true adds product_count)")
+	fmt.Println("   POST   /v1/categories      - Create a category")
+	fmt.Println("   DELETE /v1/categories?ids= - Delete several categories (?force=true to detach products)")
+	fmt.Println("   GET    /v1/categories/tree - Get the nested category tree")
+	fmt.Println("   GET    /v1/categories/count - Count categories")
+	fmt.Println("   PATCH  /v1/categories/descriptions - Update several category descriptions at once")
+	fmt.Println("   GET    /v1/categories/{id} - Get a category by ID (?include=breadcrumb,count,products)")
+	fmt.Println("   PUT    /v1/categories/{id} - Update a category")
+	fmt.Println("   DELETE /v1/categories/{id} - Delete a category (?reassign_to= moves its products first)")
+	fmt.Println("   GET    /v1/categories/{id}/products  - Get the products in a category")
+	fmt.Println("   POST   /v1/categories/{id}/products  - Create a product in a category")
+	fmt.Println("   GET    /v1/categories/{id}/low-stock - Get products needing restock")
+	fmt.Println("   GET    /v1/categories/{id}/cheapest  - Get the lowest-priced product in a category")
+	fmt.Println("   POST   /v1/categories/{id}/deactivate-products - Deactivate all products in a category")
+	fmt.Println("   POST   /v1/categories/{id}/activate-products   - Activate all products in a category")
+	fmt.Println("")
+	fmt.Println("   GET    /v1/products        - Get all products (?search=, ?category_id= or none, ?min_price=, ?max_price=, ?created_after=, ?created_before=, ?stock_status=, ?sort=, ?order=, ?expand=category)")
+	fmt.Println("   POST   /v1/products        - Create a product (Idempotency-Key header replays a retry)")
+	fmt.Println("   GET    /v1/products/compare - Compare two products field by field (?ids=1,2)")
+	fmt.Println("   GET    /v1/products/count  - Count products (?category_id= or none)")
+	fmt.Println("   GET    /v1/products/search - Search products by name, paginated (?q=, ?page=, ?limit=, ?expand=category)")
+	fmt.Println("   GET    /v1/products/suggest - Suggest up to 10 product names starting with ?q=")
+	fmt.Println("   GET    /v1/products/recent - Get the most recently added products")
+	fmt.Println("   GET    /v1/products/categories - Get categories that have products")
+	fmt.Println("   GET    /v1/products/reorder-suggestions - Get products to restock, most urgent first")
+	fmt.Println("   GET    /v1/products/export - Download all products as CSV")
+	fmt.Println("   POST   /v1/products/import - Create products from an uploaded CSV")
+	fmt.Println("   GET    /v1/products/{id}   - Get a product by ID")
+	fmt.Println("   PUT    /v1/products/{id}   - Update a product")
+	fmt.Println("   DELETE /v1/products/{id}   - Delete a product")
+	fmt.Println("   POST   /v1/products/{id}/move - Move a product to another category")
+	fmt.Println("   GET    /v1/products/{id}/history - Get a product's timeline of recorded changes")
+	fmt.Println("   GET    /v1/products/{id}/rank - Get a product's rank in its category (?by=price|stock)")
+	fmt.Println("   POST   /v1/products/set-active - Set active flag on multiple products")
+	fmt.Println("")
+	fmt.Println("   POST   /v1/admin/catalog/import - Import categories and products in one payload (?duplicate_policy=error|skip|first-wins)")
+	fmt.Println("   GET    /v1/admin/products/anomalies - List products with suspicious data")
+	fmt.Println("")
+	fmt.Println("   GET    /health          - Liveness/readiness probe with a database ping")
+	fmt.Println("   GET    /metrics         - Prometheus metrics")
+
+	var handler http.Handler = http.DefaultServeMux
+	handler = middleware.Recover(handler)
+	handler = middleware.Gzip(handler, config.GetGzipMinSize())
+	handler = middleware.ConcurrencyLimit(handler, config.GetMaxConcurrent())
+	if apiKey := config.GetAPIKey(); apiKey != "" {
+		handler = middleware.RequireAPIKey(handler, apiKey)
+	} else {
+		log.Println("WARN: API_KEY is not set, write requests are not authenticated")
+	}
+	if perMinute := config.GetRateLimitPerMinute(); perMinute > 0 {
+		handler = middleware.RateLimit(handler, perMinute, config.TrustProxyHeaders())
+	}
+	handler = middleware.Timing(handler, config.GetSlowRequestThreshold(), requestMetrics)
+	handler = middleware.CORS(handler, config.GetCORSMaxAge())
 
-	if err := http.ListenAndServe(port, nil); err != nil {
+	if err := http.ListenAndServe(port, handler); err != nil {
 		log.Fatal(err)
 	}
 }
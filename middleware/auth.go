@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireAPIKey rejects POST, PUT, PATCH and DELETE requests with 401 unless
+// they carry "Authorization: Bearer <apiKey>". Reads and preflights pass
+// through. An empty apiKey turns the check off.
+func RequireAPIKey(next http.Handler, apiKey string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKey == "" || !isWriteMethod(r.Method) || validAPIKey(r, apiKey) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Missing or invalid API key")
+	})
+}
+
+// isWriteMethod reports whether method modifies data
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// validAPIKey reports whether the request's bearer token is apiKey, comparing
+// in constant time so response timing does not leak the key
+func validAPIKey(r *http.Request, apiKey string) bool {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(apiKey)) == 1
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRequireAPIKey tests that writes need the bearer key while reads do not
+func TestRequireAPIKey(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		apiKey        string
+		method        string
+		authorization string
+		status        int
+	}{
+		{"authorized post", "s3cret", http.MethodPost, "Bearer s3cret", http.StatusOK},
+		{"scheme is case-insensitive", "s3cret", http.MethodPost, "bearer s3cret", http.StatusOK},
+		{"missing key", "s3cret", http.MethodPost, "", http.StatusUnauthorized},
+		{"wrong key", "s3cret", http.MethodPost, "Bearer guess", http.StatusUnauthorized},
+		{"key prefix", "s3cret", http.MethodPost, "Bearer s3", http.StatusUnauthorized},
+		{"wrong scheme", "s3cret", http.MethodPost, "Basic s3cret", http.StatusUnauthorized},
+		{"unauthorized put", "s3cret", http.MethodPut, "", http.StatusUnauthorized},
+		{"unauthorized patch", "s3cret", http.MethodPatch, "", http.StatusUnauthorized},
+		{"unauthorized delete", "s3cret", http.MethodDelete, "", http.StatusUnauthorized},
+		{"public get", "s3cret", http.MethodGet, "", http.StatusOK},
+		{"public head", "s3cret", http.MethodHead, "", http.StatusOK},
+		{"preflight", "s3cret", http.MethodOptions, "", http.StatusOK},
+		{"auth off", "", http.MethodPost, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireAPIKey(ok, tt.apiKey)
+
+			req := httptest.NewRequest(tt.method, "/v1/products", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status != http.StatusUnauthorized {
+				return
+			}
+
+			if got := rec.Header().Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("Expected WWW-Authenticate Bearer, got %q", got)
+			}
+			var body errorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if body.Success || body.Code != errCodeUnauthorized || body.Message != "Missing or invalid API key" {
+				t.Errorf("Unexpected body: %+v", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/KAnggara75/BelajarGolang/config"
+	"github.com/spf13/viper"
+)
+
+// okHandler is a trivial handler used as the wrapped handler in middleware tests
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// TestCORS_PreflightMaxAge tests that the preflight response carries the configured max-age
+func TestCORS_PreflightMaxAge(t *testing.T) {
+	viper.Set("CORS_MAX_AGE", 120)
+	defer viper.Set("CORS_MAX_AGE", nil)
+
+	handler := CORS(okHandler, config.GetCORSMaxAge())
+
+	req := httptest.NewRequest(http.MethodOptions, "/products", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "120" {
+		t.Errorf("Expected Access-Control-Max-Age '120', got '%s'", got)
+	}
+}
+
+// TestCORS_DefaultMaxAge tests the default max-age when unconfigured
+func TestCORS_DefaultMaxAge(t *testing.T) {
+	handler := CORS(okHandler, config.GetCORSMaxAge())
+
+	req := httptest.NewRequest(http.MethodOptions, "/products", nil)
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != strconv.Itoa(600) {
+		t.Errorf("Expected Access-Control-Max-Age '600', got '%s'", got)
+	}
+}
+
+// TestCORS_PassThrough tests that non-preflight requests reach the wrapped handler
+func TestCORS_PassThrough(t *testing.T) {
+	handler := CORS(okHandler, 600)
+
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Access-Control-Allow-Origin '*', got '%s'", got)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("Expected no Access-Control-Max-Age on a simple request, got '%s'", got)
+	}
+}
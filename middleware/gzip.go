@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipWriter holds the response back until minSize bytes have been written.
+// A body that reaches minSize is gzipped from there on; a smaller one is sent
+// unchanged when the handler returns.
+type gzipWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     []byte
+	gz      *gzip.Writer
+	// passthrough is set once the response is known to go out uncompressed
+	passthrough bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < w.minSize {
+		return len(p), nil
+	}
+
+	// The handler may have encoded the body itself, as promhttp does
+	if w.Header().Get("Content-Encoding") != "" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.status)
+		if _, err := w.ResponseWriter.Write(w.buf); err != nil {
+			return 0, err
+		}
+		w.buf = nil
+		return len(p), nil
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf); err != nil {
+		return 0, err
+	}
+	w.buf = nil
+	return len(p), nil
+}
+
+// finish flushes whatever the handler left behind: the gzip trailer, or the
+// buffered small body and its status
+func (w *gzipWriter) finish() {
+	switch {
+	case w.gz != nil:
+		w.gz.Close()
+	case w.passthrough:
+	case w.status != 0:
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.buf)
+	}
+}
+
+// Gzip compresses responses of at least minSize bytes for clients that
+// accept gzip. Content-Type and the other headers set by the handler are
+// kept; smaller bodies are sent as they are.
+func Gzip(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w, minSize: minSize}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header lists gzip without
+// refusing it with q=0
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
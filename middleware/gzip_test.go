@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// jsonHandler writes a JSON body of the given size
+func jsonHandler(size int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `"`+strings.Repeat("a", size-2)+`"`)
+	})
+}
+
+// TestGzip_CompressesLargeBody tests that a body over the threshold is gzipped
+// with its status and Content-Type kept
+func TestGzip_CompressesLargeBody(t *testing.T) {
+	handler := Gzip(jsonHandler(4096), 1024)
+
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip;q=0.8")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", got)
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	if len(body) != 4096 {
+		t.Errorf("Expected 4096 decompressed bytes, got %d", len(body))
+	}
+}
+
+// TestGzip_PassesThrough tests the cases left uncompressed
+func TestGzip_PassesThrough(t *testing.T) {
+	tests := []struct {
+		name           string
+		size           int
+		acceptEncoding string
+	}{
+		{"small body", 100, "gzip"},
+		{"gzip not accepted", 4096, "br"},
+		{"gzip refused", 4096, "gzip;q=0, br"},
+		{"no header", 4096, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Gzip(jsonHandler(tt.size), 1024)
+
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusCreated {
+				t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Expected no Content-Encoding, got %q", got)
+			}
+			if rec.Body.Len() != tt.size {
+				t.Errorf("Expected %d plain bytes, got %d", tt.size, rec.Body.Len())
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Expected Vary Accept-Encoding, got %q", got)
+			}
+		})
+	}
+}
+
+// TestGzip_AlreadyEncoded tests that a body the handler encoded itself is not
+// compressed twice
+func TestGzip_AlreadyEncoded(t *testing.T) {
+	handler := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte(strings.Repeat("x", 2048)))
+	}), 1024)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Body.String() != strings.Repeat("x", 2048) {
+		t.Errorf("Expected the handler's body unchanged, got %d bytes", rec.Body.Len())
+	}
+}
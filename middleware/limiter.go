@@ -0,0 +1,20 @@
+package middleware
+
+import "net/http"
+
+// ConcurrencyLimit allows at most max requests in flight. Requests arriving
+// while the limit is reached are rejected with 503 instead of queueing.
+func ConcurrencyLimit(next http.Handler, max int) http.Handler {
+	sem := make(chan struct{}, max)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, http.StatusServiceUnavailable, errCodeServerBusy, "Server busy")
+		}
+	})
+}
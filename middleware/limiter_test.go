@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// TestConcurrencyLimit_RejectsWhenFull tests that a second overlapping request gets 503 with a limit of 1
+func TestConcurrencyLimit_RejectsWhenFull(t *testing.T) {
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := ConcurrencyLimit(slow, 1)
+
+	firstDone := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+		firstDone <- rec.Code
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header to be set")
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type 'application/json', got '%s'", got)
+	}
+
+	close(release)
+	if code := <-firstDone; code != http.StatusOK {
+		t.Errorf("Expected first request status %d, got %d", http.StatusOK, code)
+	}
+
+	// The slot is released once the first request finishes
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d after release, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+// TestConcurrencyLimit_ProblemFormat tests that a rejected request uses problem+json when ERROR_FORMAT=problem
+func TestConcurrencyLimit_ProblemFormat(t *testing.T) {
+	viper.Set("ERROR_FORMAT", "problem")
+	defer viper.Set("ERROR_FORMAT", nil)
+
+	// A limit of zero rejects every request
+	handler := ConcurrencyLimit(okHandler, 0)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Expected Content-Type 'application/problem+json', got '%s'", got)
+	}
+
+	var problem map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if problem["status"] != float64(http.StatusServiceUnavailable) || problem["instance"] != "/products" {
+		t.Errorf("Unexpected problem body: %v", problem)
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RequestMetrics holds the Prometheus collectors Timing updates for every
+// request
+type RequestMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewRequestMetrics creates the request counter and latency histogram and
+// registers them with reg
+func NewRequestMetrics(reg prometheus.Registerer) *RequestMetrics {
+	m := &RequestMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests served, by method, route and status.",
+		}, []string{"method", "path", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency, by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "path"}),
+	}
+	reg.MustRegister(m.requests, m.duration)
+	return m
+}
+
+func (m *RequestMetrics) observe(r *http.Request, route string, status int, elapsed time.Duration) {
+	path := routeLabel(r.URL.Path, route, status)
+	m.requests.WithLabelValues(r.Method, path, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(r.Method, path).Observe(elapsed.Seconds())
+}
+
+// routeKey is the context key under which Timing keeps the route a handler
+// reports through SetRoute
+type routeKey struct{}
+
+// SetRoute reports the route pattern a request matched, such as
+// /v1/products/{id}/history, for the path label of its metrics. Handlers call
+// it before they parse ids, so a malformed id is labelled like a valid one.
+// Outside Timing it does nothing.
+func SetRoute(r *http.Request, pattern string) {
+	if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+		*route = pattern
+	}
+}
+
+// routeLabel keeps the path label bounded. It is the route the handler
+// reported, whatever the status, so a missing product counts under
+// /v1/products/{id}. Without a route, 404s share one label, and so do other
+// failures no handler routed, such as rejected API keys or redirects. A
+// success without a route comes from a handler serving one exact path, such
+// as /health, so the path itself is the label.
+func routeLabel(path, route string, status int) string {
+	switch {
+	case route != "":
+		return route
+	case status == http.StatusNotFound:
+		return "unmatched"
+	case status < http.StatusMultipleChoices:
+		return path
+	default:
+		return "unrouted"
+	}
+}
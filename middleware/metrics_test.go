@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestTiming_RecordsMetrics tests that requests are counted by method, route
+// and status, labelled with the route the handler reports
+func TestTiming_RecordsMetrics(t *testing.T) {
+	captureLogs(t)
+
+	reg := prometheus.NewRegistry()
+	metrics := NewRequestMetrics(reg)
+	handler := Timing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/products/") {
+			SetRoute(r, "/v1/products/{id}")
+		}
+		okHandler(w, r)
+	}), time.Second, metrics)
+
+	for _, path := range []string{"/v1/products/1", "/v1/products/2", "/v1/categories"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(metrics.requests.WithLabelValues("GET", "/v1/products/{id}", "200")); got != 2 {
+		t.Errorf("Expected 2 requests for /v1/products/{id}, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.requests.WithLabelValues("GET", "/v1/categories", "200")); got != 1 {
+		t.Errorf("Expected 1 request for /v1/categories, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.duration); got != 2 {
+		t.Errorf("Expected 2 latency series, got %d", got)
+	}
+}
+
+// TestRouteLabel tests that the path label is the reported route, even on a
+// 404, or else one shared label, except for exact-path successes
+func TestRouteLabel(t *testing.T) {
+	tests := []struct {
+		path   string
+		route  string
+		status int
+		want   string
+	}{
+		{"/v1/products/42/history", "/v1/products/{id}/history", http.StatusOK, "/v1/products/{id}/history"},
+		{"/v1/products/MTI", "/v1/products/{id}", http.StatusOK, "/v1/products/{id}"},
+		{"/v1/products/abc", "/v1/products/{id}", http.StatusBadRequest, "/v1/products/{id}"},
+		{"/v1/products/abc", "/v1/products/{id}", http.StatusMethodNotAllowed, "/v1/products/{id}"},
+		{"/health", "", http.StatusOK, "/health"},
+		{"/v1/products/abc", "", http.StatusUnauthorized, "unrouted"},
+		{"/products/abc", "", http.StatusPermanentRedirect, "unrouted"},
+		{"/wp-login.php", "", http.StatusNotFound, "unmatched"},
+		{"/v1/products/999", "/v1/products/{id}", http.StatusNotFound, "/v1/products/{id}"},
+	}
+
+	for _, tt := range tests {
+		if got := routeLabel(tt.path, tt.route, tt.status); got != tt.want {
+			t.Errorf("routeLabel(%q, %q, %d) = %q, want %q", tt.path, tt.route, tt.status, got, tt.want)
+		}
+	}
+}
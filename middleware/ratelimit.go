@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitIdle is how long a client may go without requests before its
+// limiter is dropped; by then its bucket has refilled anyway
+const rateLimitIdle = 3 * time.Minute
+
+// clientLimiter is the token bucket of one client IP
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter holds a token bucket per client IP
+type rateLimiter struct {
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	limit     rate.Limit
+	burst     int
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// allow takes a token from ip's bucket. When the bucket is empty it returns
+// false and how long until the next token.
+func (l *rateLimiter) allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	client, ok := l.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = client
+	}
+	client.lastSeen = now
+
+	reservation := client.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// sweep drops idle clients, at most once per rateLimitIdle so the map is not
+// scanned on every request
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitIdle {
+		return
+	}
+	l.lastSweep = now
+	for ip, client := range l.clients {
+		if now.Sub(client.lastSeen) >= rateLimitIdle {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// RateLimit allows each client IP perMinute requests per minute, in bursts of
+// up to perMinute. Requests over the limit are rejected with 429 and a
+// Retry-After header. With trustProxy the client is the last address in
+// X-Forwarded-For, the one added by the proxy in front of the app.
+func RateLimit(next http.Handler, perMinute int, trustProxy bool) http.Handler {
+	return rateLimit(next, perMinute, trustProxy, time.Now)
+}
+
+// rateLimit is RateLimit with a clock, for tests
+func rateLimit(next http.Handler, perMinute int, trustProxy bool, now func() time.Time) http.Handler {
+	limiter := &rateLimiter{
+		clients:   make(map[string]*clientLimiter),
+		limit:     rate.Limit(float64(perMinute) / 60),
+		burst:     perMinute,
+		lastSweep: now(),
+		now:       now,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, retryAfter := limiter.allow(clientIP(r, trustProxy))
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, r, http.StatusTooManyRequests, errCodeRateLimited, "Too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address a request is rate limited by
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
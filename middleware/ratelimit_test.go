@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for rate limit tests
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// serveFrom sends a GET through handler from remoteAddr, with an optional
+// X-Forwarded-For header
+func serveFrom(handler http.Handler, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestRateLimit_RejectsOverLimit tests that rapid requests from one IP get 429
+// once the bucket is empty, without affecting other IPs
+func TestRateLimit_RejectsOverLimit(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := rateLimit(ok, 5, false, clock.now)
+
+	for i := range 5 {
+		if rec := serveFrom(handler, "203.0.113.7:4000", ""); rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to pass, got %d", i+1, rec.Code)
+		}
+	}
+
+	rec := serveFrom(handler, "203.0.113.7:4001", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	// 5 per minute refills one token every 12 seconds
+	if got := rec.Header().Get("Retry-After"); got != "12" {
+		t.Errorf("Expected Retry-After 12, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type 'application/json', got '%s'", got)
+	}
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Success || body.Code != errCodeRateLimited || body.Message != "Too many requests" {
+		t.Errorf("Unexpected body: %+v", body)
+	}
+
+	if rec := serveFrom(handler, "198.51.100.2:4000", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected another IP to pass, got %d", rec.Code)
+	}
+
+	clock.t = clock.t.Add(12 * time.Second)
+	if rec := serveFrom(handler, "203.0.113.7:4000", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected a request to pass once a token refilled, got %d", rec.Code)
+	}
+}
+
+// TestRateLimit_ForwardedFor tests that behind a proxy each forwarded client
+// gets its own bucket, keyed by the address the proxy appended
+func TestRateLimit_ForwardedFor(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	const proxy = "10.0.0.1:5000"
+
+	tests := []struct {
+		name       string
+		trustProxy bool
+		second     int
+	}{
+		{"trusted", true, http.StatusOK},
+		{"untrusted", false, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Now()}
+			handler := rateLimit(ok, 1, tt.trustProxy, clock.now)
+
+			if rec := serveFrom(handler, proxy, "203.0.113.7"); rec.Code != http.StatusOK {
+				t.Fatalf("Expected the first client to pass, got %d", rec.Code)
+			}
+			// A client-supplied first hop does not change the key
+			if rec := serveFrom(handler, proxy, "192.0.2.99, 203.0.113.7"); rec.Code != http.StatusTooManyRequests {
+				t.Errorf("Expected a spoofed first hop to share the bucket, got %d", rec.Code)
+			}
+			if rec := serveFrom(handler, proxy, "198.51.100.2"); rec.Code != tt.second {
+				t.Errorf("Expected a second client to get %d, got %d", tt.second, rec.Code)
+			}
+		})
+	}
+}
+
+// TestRateLimit_SweepsIdleClients tests that idle clients are dropped
+func TestRateLimit_SweepsIdleClients(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	limiter := &rateLimiter{
+		clients:   make(map[string]*clientLimiter),
+		limit:     1,
+		burst:     1,
+		lastSweep: clock.t,
+		now:       clock.now,
+	}
+
+	limiter.allow("203.0.113.7")
+	clock.t = clock.t.Add(rateLimitIdle)
+	limiter.allow("198.51.100.2")
+
+	if _, ok := limiter.clients["203.0.113.7"]; ok {
+		t.Error("Expected the idle client to be dropped")
+	}
+	if _, ok := limiter.clients["198.51.100.2"]; !ok {
+		t.Error("Expected the active client to be kept")
+	}
+}
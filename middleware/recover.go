@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverWriter remembers whether the response has started, since a 500 can
+// only be sent before the status line goes out
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoverWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoverWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Recover turns a handler panic into a logged stack trace and a 500 error
+// response instead of a dropped connection. http.ErrAbortHandler is
+// re-raised so net/http can abort the response as intended.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			slog.Error("panic serving request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", err,
+				"stack", string(debug.Stack()),
+			)
+			if !rw.wroteHeader {
+				writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
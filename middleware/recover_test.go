@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRecover_Panic tests that a panicking handler yields a 500 JSON error and a logged stack
+func TestRecover_Panic(t *testing.T) {
+	logs := captureLogs(t)
+
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	})
+	handler := Recover(panicking)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type 'application/json', got '%s'", got)
+	}
+
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Success || body.Message != "Internal server error" || body.Code != errCodeInternal {
+		t.Errorf("Unexpected body: %+v", body)
+	}
+
+	out := logs.String()
+	for _, want := range []string{"level=ERROR", `msg="panic serving request"`, "path=/products", "assignment to entry in nil map", "goroutine"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected log to contain %q, got %q", want, out)
+		}
+	}
+}
+
+// TestRecover_PanicAfterWrite tests that a panic after the response started leaves it alone
+func TestRecover_PanicAfterWrite(t *testing.T) {
+	captureLogs(t)
+
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("late failure")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d to be kept, got %d", http.StatusAccepted, rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected no error body after the response started, got %q", rec.Body.String())
+	}
+}
+
+// TestRecover_NoPanic tests that normal responses pass through untouched
+func TestRecover_NoPanic(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Recover(okHandler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/categories", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
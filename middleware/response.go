@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/KAnggara75/BelajarGolang/config"
+)
+
+// Error codes for failures raised by middleware, alongside the handlers'
+// ErrCode constants
+const (
+	errCodeServerBusy   = "SERVER_BUSY"
+	errCodeRateLimited  = "RATE_LIMITED"
+	errCodeUnauthorized = "UNAUTHORIZED"
+	errCodeInternal     = "INTERNAL_ERROR"
+)
+
+// errorResponse mirrors the handlers' JSON envelope for errors raised by middleware
+type errorResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// problemResponse mirrors the handlers' RFC 7807 body used when ERROR_FORMAT=problem
+type problemResponse struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// encodeJSON writes v indented by JSON_INDENT spaces, like the handlers do
+func encodeJSON(w http.ResponseWriter, v any) {
+	enc := json.NewEncoder(w)
+	if indent := config.GetJSONIndent(); indent > 0 {
+		enc.SetIndent("", strings.Repeat(" ", indent))
+	}
+	enc.Encode(v)
+}
+
+// writeError writes an error with the given status in the configured format
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if config.IsProblemErrorFormat() {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		encodeJSON(w, problemResponse{
+			Type:     "about:blank",
+			Title:    http.StatusText(status),
+			Status:   status,
+			Detail:   message,
+			Instance: r.URL.Path,
+			Code:     code,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encodeJSON(w, errorResponse{Success: false, Message: message, Code: code})
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// timingWriter stamps the response-time header just before the status line
+// is written and remembers the status for logging
+type timingWriter struct {
+	http.ResponseWriter
+	start       time.Time
+	status      int
+	wroteHeader bool
+}
+
+func (w *timingWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	w.Header().Set("X-Response-Time", time.Since(w.start).String())
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Timing sets an X-Response-Time header and logs every request with its
+// latency. Requests taking at least slow are logged as warnings, the rest at
+// debug level. When metrics is non-nil every request is also counted and
+// timed there, under the route its handler reports through SetRoute.
+func Timing(next http.Handler, slow time.Duration, metrics *RequestMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &timingWriter{ResponseWriter: w, start: time.Now(), status: http.StatusOK}
+		var route string
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), routeKey{}, &route)))
+		elapsed := time.Since(tw.start)
+		if metrics != nil {
+			metrics.observe(r, route, tw.status, elapsed)
+		}
+
+		level := slog.LevelDebug
+		msg := "request served"
+		if elapsed >= slow {
+			level = slog.LevelWarn
+			msg = "slow request"
+		}
+		slog.Log(r.Context(), level, msg,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", tw.status,
+			"latency", elapsed,
+		)
+	})
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs routes the default slog logger into a buffer for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// TestTiming_LogsSlowRequestAsWarning tests that a request over the threshold is logged at warn level
+func TestTiming_LogsSlowRequestAsWarning(t *testing.T) {
+	logs := captureLogs(t)
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := Timing(slow, 5*time.Millisecond, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products", nil))
+
+	if rec.Header().Get("X-Response-Time") == "" {
+		t.Error("Expected X-Response-Time header to be set")
+	}
+
+	out := logs.String()
+	for _, want := range []string{"level=WARN", `msg="slow request"`, "method=POST", "path=/products", "status=201", "latency="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected log to contain %q, got %q", want, out)
+		}
+	}
+}
+
+// TestTiming_LogsFastRequestAtDebug tests that a request under the threshold is not logged as a warning
+func TestTiming_LogsFastRequestAtDebug(t *testing.T) {
+	logs := captureLogs(t)
+
+	handler := Timing(okHandler, time.Second, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/categories", nil))
+
+	if rec.Header().Get("X-Response-Time") == "" {
+		t.Error("Expected X-Response-Time header to be set")
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, "level=DEBUG") || strings.Contains(out, "level=WARN") {
+		t.Errorf("Expected a single debug entry, got %q", out)
+	}
+}
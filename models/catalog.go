@@ -0,0 +1,52 @@
+package models
+
+// CatalogImport is the payload for a bulk catalog import. Products reference
+// categories by name so the payload does not depend on database ids.
+type CatalogImport struct {
+	Categories []CatalogCategoryInput `json:"categories"`
+	Products   []CatalogProductInput  `json:"products"`
+}
+
+// CatalogCategoryInput is a category row in a catalog import
+type CatalogCategoryInput struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=2000"`
+}
+
+// CatalogProductInput is a product row in a catalog import; Category is the
+// name of a category in the payload or already in the database
+type CatalogProductInput struct {
+	Name     string   `json:"name" validate:"required,max=255"`
+	Price    *Price   `json:"price" validate:"omitnil,price_min,price_scale,price_max"`
+	Stock    Quantity `json:"stock" validate:"gte=0"`
+	Category string   `json:"category,omitempty"`
+}
+
+// CatalogImportResult reports what a catalog import wrote
+type CatalogImportResult struct {
+	CategoriesCreated int                  `json:"categories_created"`
+	ProductsCreated   int                  `json:"products_created"`
+	Skipped           []CatalogSkippedItem `json:"skipped"`
+}
+
+// CatalogSkippedItem is a row left out of an import because it conflicted
+// with existing data
+type CatalogSkippedItem struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ProductImportResult reports a CSV product import. Rows are created or
+// fail independently; Errors lists each failed row by its line in the file.
+type ProductImportResult struct {
+	Created int                  `json:"created"`
+	Failed  int                  `json:"failed"`
+	Errors  []ProductImportError `json:"errors"`
+}
+
+// ProductImportError is a CSV row that could not be imported
+type ProductImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
@@ -1,8 +1,53 @@
 package models
 
+import "time"
+
 // Category represents a category entity
 type Category struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
+	ID          ID        `json:"id"`
+	Name        string    `json:"name" validate:"required,max=255"`
+	Description string    `json:"description" validate:"max=2000"`
+	ParentID    *ID       `json:"parent_id,omitempty" validate:"omitnil,gt=0"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero"`
+}
+
+// CategoryWithCount is a category listed with the number of its products
+type CategoryWithCount struct {
+	Category
+	ProductCount int `json:"product_count"`
+}
+
+// CategoryNode represents a category in the nested category tree
+type CategoryNode struct {
+	ID       ID              `json:"id"`
+	Name     string          `json:"name"`
+	Children []*CategoryNode `json:"children"`
+}
+
+// CategorySummary is a lightweight category reference used by filter listings
+type CategorySummary struct {
+	ID   ID     `json:"id"`
+	Name string `json:"name"`
+}
+
+// Outcomes reported for each id of a bulk category delete
+const (
+	CategoryDeleted  = "deleted"
+	CategoryBlocked  = "blocked"
+	CategoryNotFound = "not_found"
+)
+
+// CategoryDeleteResult reports what a bulk delete did with one category id
+type CategoryDeleteResult struct {
+	ID           ID     `json:"id"`
+	Status       string `json:"status"`
+	ProductCount int    `json:"product_count,omitempty"`
+}
+
+// CategoryDescriptionInput sets the description of one category in a bulk update
+type CategoryDescriptionInput struct {
+	ID          ID     `json:"id"`
 	Description string `json:"description"`
 }
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ErrInvalidID is returned when an id cannot be decoded
+var ErrInvalidID = errors.New("invalid id")
+
+// ID is a primary or foreign key. With ID_FORMAT=opaque it is rendered in
+// JSON as an opaque string instead of the sequential integer. This only hides
+// the sequence from casual enumeration; it is not access control.
+type ID int
+
+// ID deliberately has no String method: pgx encodes fmt.Stringer arguments
+// through it, which would send opaque ids to the database.
+
+// opaque returns the encoded form of the id
+func (id ID) opaque() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(int(id))))
+}
+
+// MarshalJSON encodes the id as a number, or as a string when opaque
+func (id ID) MarshalJSON() ([]byte, error) {
+	if settings.OpaqueIDs {
+		return json.Marshal(id.opaque())
+	}
+	return []byte(strconv.Itoa(int(id))), nil
+}
+
+// UnmarshalJSON accepts a JSON number or, when opaque, an encoded string
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseID(s)
+		if err != nil {
+			return err
+		}
+		*id = ID(parsed)
+		return nil
+	}
+
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = ID(n)
+	return nil
+}
+
+// ParseID decodes an id from a path segment or query value in the configured
+// format. Opaque ids must be canonical, so each id has exactly one spelling.
+func ParseID(s string) (int, error) {
+	if !settings.OpaqueIDs {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, ErrInvalidID
+		}
+		return n, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, ErrInvalidID
+	}
+	n, err := strconv.Atoi(string(raw))
+	if err != nil || ID(n).opaque() != s {
+		return 0, ErrInvalidID
+	}
+	return n, nil
+}
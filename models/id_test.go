@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestID_IntFormat tests that ids are plain integers by default
+func TestID_IntFormat(t *testing.T) {
+	got, err := json.Marshal(ID(42))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(got) != "42" {
+		t.Errorf("Expected 42, got %s", got)
+	}
+
+	if id, err := ParseID("42"); err != nil || id != 42 {
+		t.Errorf("Expected 42, got %d (%v)", id, err)
+	}
+	if _, err := ParseID("NDI"); err != ErrInvalidID {
+		t.Errorf("Expected ErrInvalidID for an opaque id in int mode, got %v", err)
+	}
+}
+
+// TestID_OpaqueFormat tests that opaque ids round-trip through JSON and path parsing
+func TestID_OpaqueFormat(t *testing.T) {
+	Configure(Settings{OpaqueIDs: true, PriceScale: 2})
+	defer Configure(DefaultSettings)
+
+	got, err := json.Marshal(ID(42))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(got) != `"NDI"` {
+		t.Errorf(`Expected "NDI", got %s`, got)
+	}
+
+	var decoded ID
+	if err := json.Unmarshal(got, &decoded); err != nil || decoded != 42 {
+		t.Errorf("Expected 42, got %d (%v)", decoded, err)
+	}
+
+	if id, err := ParseID("NDI"); err != nil || id != 42 {
+		t.Errorf("Expected 42, got %d (%v)", id, err)
+	}
+
+	// Plain integers and non-canonical encodings are rejected
+	for _, s := range []string{"42", "MDQy", "!!", ""} {
+		if _, err := ParseID(s); err != ErrInvalidID {
+			t.Errorf("ParseID(%q): expected ErrInvalidID, got %v", s, err)
+		}
+	}
+}
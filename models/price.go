@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Price is a monetary amount held as an exact decimal, so prices round-trip
+// through the DECIMAL column and multiply without float error. It is always
+// rendered with exactly PRICE_SCALE decimals in JSON (two by default), so 1000
+// encodes as 1000.00 rather than 1000.
+//
+// pgx stores a Price through the embedded Decimal's Value and String, both the
+// exact decimal, and scans one through its Scan.
+type Price struct {
+	decimal.Decimal
+}
+
+// NewPrice returns the price closest to f, as a client sending f gets
+func NewPrice(f float64) Price {
+	return Price{decimal.NewFromFloat(f)}
+}
+
+// ParsePrice parses a decimal literal such as "19.99" or "1e3"
+func ParsePrice(s string) (Price, error) {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return Price{}, err
+	}
+	return Price{d}, nil
+}
+
+// MarshalJSON encodes the price as a JSON number with the configured decimals
+func (p Price) MarshalJSON() ([]byte, error) {
+	return []byte(p.StringFixed(int32(settings.PriceScale))), nil
+}
+
+// UnmarshalJSON accepts a JSON number, keeping every decimal the client sent
+func (p *Price) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return &json.UnmarshalTypeError{Value: "string", Type: reflect.TypeFor[Price]()}
+	}
+	parsed, err := ParsePrice(string(data))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// FitsScale reports whether the price has at most scale decimal places, as
+// written by the client. Trailing zeros do not count, so 1.10 fits scale 1.
+func (p Price) FitsScale(scale int) bool {
+	return p.Equal(p.Truncate(int32(scale)))
+}
+
+// PricesEqual reports whether two nullable prices are the same amount, however
+// many trailing zeros either was written with
+func PricesEqual(a, b *Price) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(b.Decimal)
+}
+
+// MaxPrice returns the largest price the price column stores at scale, such
+// as 999999999999.99 at the default scale. Larger prices would overflow it.
+func MaxPrice(scale int) Price {
+	digits := strings.Repeat("9", PricePrecision-scale)
+	if scale > 0 {
+		digits += "." + strings.Repeat("9", scale)
+	}
+	return Price{decimal.RequireFromString(digits)}
+}
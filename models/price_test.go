@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestPrice_MarshalJSON tests that prices always render with two decimals
+func TestPrice_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		price    float64
+		expected string
+	}{
+		{1000.0, "1000.00"},
+		{19.9, "19.90"},
+		{999.99, "999.99"},
+		{0, "0.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			got, err := json.Marshal(NewPrice(tt.price))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestPrice_NullInProduct tests that a missing price still encodes as null
+func TestPrice_NullInProduct(t *testing.T) {
+	got, err := json.Marshal(struct {
+		Price *Price `json:"price"`
+	}{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(got) != `{"price":null}` {
+		t.Errorf("Expected {\"price\":null}, got %s", got)
+	}
+}
+
+// TestPrice_MarshalJSONScale tests that PRICE_SCALE sets the rendered decimals
+func TestPrice_MarshalJSONScale(t *testing.T) {
+	tests := []struct {
+		scale    int
+		price    float64
+		expected string
+	}{
+		{3, 1.459, "1.459"},
+		{3, 2, "2.000"},
+		{0, 1500, "1500"},
+		{6, 0.5, "0.500000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			Configure(Settings{PriceScale: tt.scale})
+			defer Configure(DefaultSettings)
+
+			got, err := json.Marshal(NewPrice(tt.price))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestPrice_FitsScale tests counting the decimals a client sent
+func TestPrice_FitsScale(t *testing.T) {
+	tests := []struct {
+		input    string
+		scale    int
+		expected bool
+	}{
+		{"19.99", 2, true},
+		{"19.90", 2, true},
+		{"1000", 0, true},
+		{"1.005", 2, false},
+		{"1.005", 3, true},
+		{"0.1", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var p Price
+			if err := json.Unmarshal([]byte(tt.input), &p); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := p.FitsScale(tt.scale); got != tt.expected {
+				t.Errorf("FitsScale(%d) = %v, want %v", tt.scale, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestMaxPrice tests the largest price the column holds at each scale, and
+// that it compares exactly against the same literal sent by a client
+func TestMaxPrice(t *testing.T) {
+	tests := []struct {
+		scale    int
+		expected string
+		over     string
+	}{
+		{2, "999999999999.99", "1000000000000"},
+		{0, "99999999999999", "100000000000000"},
+		{6, "99999999.999999", "100000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			Configure(Settings{PriceScale: tt.scale})
+			defer Configure(DefaultSettings)
+
+			max := MaxPrice(tt.scale)
+			if got := max.String(); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+
+			var sent, over Price
+			if err := json.Unmarshal([]byte(tt.expected), &sent); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := json.Unmarshal([]byte(tt.over), &over); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if sent.GreaterThan(max.Decimal) || !over.GreaterThan(max.Decimal) {
+				t.Errorf("Expected %s to fit and %s not to, with max %v", tt.expected, tt.over, max)
+			}
+		})
+	}
+}
+
+// TestPrice_UnmarshalJSON tests that prices keep every decimal sent and that
+// a quoted price is rejected, as it was when prices were floats
+func TestPrice_UnmarshalJSON(t *testing.T) {
+	var p Price
+	if err := json.Unmarshal([]byte("0.30000000000000000001"), &p); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := p.String(); got != "0.30000000000000000001" {
+		t.Errorf("Expected 0.30000000000000000001, got %s", got)
+	}
+
+	if err := json.Unmarshal([]byte(`"19.99"`), &p); err == nil {
+		t.Error("Expected an error for a quoted price")
+	}
+}
+
+// TestProduct_Value tests that the inventory value is exact, where float
+// multiplication would give 0.30000000000000004
+func TestProduct_Value(t *testing.T) {
+	price := NewPrice(0.1)
+	value := Product{Price: &price, Stock: 3}.Value()
+	if value == nil || value.String() != "0.3" {
+		t.Errorf("Expected 0.3, got %v", value)
+	}
+	if (Product{Stock: 3}).Value() != nil {
+		t.Error("Expected no value without a price")
+	}
+}
@@ -1,29 +1,130 @@
 package models
 
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
 // Product represents a product entity for API responses
 type Product struct {
-	ID         int       `json:"-"`
-	Name       string    `json:"name"`
-	Price      float64   `json:"price"`
-	Stock      int       `json:"stock"`
-	CategoryID int       `json:"-"`
-	Category   *Category `json:"category,omitempty"`
+	ID                ID         `json:"id"`
+	Name              string     `json:"name"`
+	Description       string     `json:"description"`
+	SKU               string     `json:"sku"`
+	Price             *Price     `json:"price"`
+	Stock             int        `json:"stock"`
+	ReorderPoint      int        `json:"reorder_point"`
+	ReorderQty        int        `json:"reorder_qty"`
+	Active            bool       `json:"active"`
+	Version           int        `json:"version"`
+	CategoryID        ID         `json:"category_id,omitempty"`
+	Category          *Category  `json:"category,omitempty"`
+	CategoryRemovedAt *time.Time `json:"category_removed_at"`
+	CreatedBy         string     `json:"created_by"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	// TotalValue is Value, filled in only by listings sorted by value
+	TotalValue *Price `json:"total_value,omitempty"`
+}
+
+// AnyVersion as the Version of a product update matches whatever version is
+// current, as If-Match: * asks
+const AnyVersion = -1
+
+// Value returns the inventory value price * stock, or nil when the product
+// has no price
+func (p Product) Value() *Price {
+	if p.Price == nil {
+		return nil
+	}
+	value := Price{p.Price.Mul(decimal.NewFromInt(int64(p.Stock)))}
+	return &value
 }
 
 // ProductInput is used for API input to accept category_id
 type ProductInput struct {
-	Name       string  `json:"name"`
-	Price      float64 `json:"price"`
-	Stock      int     `json:"stock"`
-	CategoryID int     `json:"category_id,omitempty"`
+	Name         string   `json:"name" validate:"required,max=255"`
+	Description  string   `json:"description" validate:"max=2000"`
+	SKU          string   `json:"sku" validate:"omitempty,sku"`
+	Price        *Price   `json:"price" validate:"omitnil,price_min,price_scale,price_max"`
+	Stock        Quantity `json:"stock" validate:"gte=0"`
+	ReorderPoint int      `json:"reorder_point" validate:"gte=0"`
+	ReorderQty   int      `json:"reorder_qty" validate:"gte=0"`
+	CategoryID   ID       `json:"category_id,omitempty"`
+	// Version is the version the client last read; on update it may be sent
+	// here instead of in an If-Match header
+	Version *int `json:"version,omitempty"`
 }
 
 // ToProduct converts a ProductInput to a Product
 func (r *ProductInput) ToProduct() Product {
 	return Product{
-		Name:       r.Name,
-		Price:      r.Price,
-		Stock:      r.Stock,
-		CategoryID: r.CategoryID,
+		Name:         r.Name,
+		Description:  r.Description,
+		SKU:          r.SKU,
+		Price:        r.Price,
+		Stock:        int(r.Stock),
+		ReorderPoint: r.ReorderPoint,
+		ReorderQty:   r.ReorderQty,
+		CategoryID:   r.CategoryID,
 	}
 }
+
+// MoveInput is used for API input to move a product to another category
+type MoveInput struct {
+	CategoryID ID `json:"category_id"`
+}
+
+// SetActiveInput is used for API input to toggle the active flag on many products
+type SetActiveInput struct {
+	IDs    []ID  `json:"ids"`
+	Active *bool `json:"active"`
+}
+
+// ProductComparison lines up two products field by field. Fields maps each
+// compared field to the pair of values, and Differs lists the fields whose
+// values are not equal.
+type ProductComparison struct {
+	IDs     [2]ID             `json:"ids"`
+	Fields  map[string][2]any `json:"fields"`
+	Differs []string          `json:"differs"`
+}
+
+// Events recorded in a product's history timeline
+const (
+	ProductCreated         = "created"
+	ProductPriceChanged    = "price_changed"
+	ProductStockChanged    = "stock_changed"
+	ProductCategoryChanged = "category_changed"
+	ProductCategoryRemoved = "category_removed"
+)
+
+// ProductHistoryEntry is one recorded change in a product's history. The
+// old and new values are set only for the event they describe; a category id
+// is left out where the product had no category. By is set only where the
+// actor is known.
+type ProductHistoryEntry struct {
+	At            time.Time `json:"at"`
+	Event         string    `json:"event"`
+	By            string    `json:"by,omitempty"`
+	OldPrice      *Price    `json:"old_price,omitempty"`
+	NewPrice      *Price    `json:"new_price,omitempty"`
+	OldStock      *int      `json:"old_stock,omitempty"`
+	NewStock      *int      `json:"new_stock,omitempty"`
+	OldCategoryID *ID       `json:"old_category_id,omitempty"`
+	NewCategoryID *ID       `json:"new_category_id,omitempty"`
+}
+
+// ProductRank is a product's position within its category
+type ProductRank struct {
+	Rank  int `json:"rank"`
+	Total int `json:"total"`
+}
+
+// ProductAnomalies groups products with suspicious data by anomaly type
+type ProductAnomalies struct {
+	NonPositivePrice []Product `json:"non_positive_price"`
+	ActiveOutOfStock []Product `json:"active_out_of_stock"`
+	BlankName        []Product `json:"blank_name"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// ErrFractionalQuantity is returned when a quantity in JSON has a fractional part
+var ErrFractionalQuantity = errors.New("quantity must be a whole number")
+
+// Quantity is a stock count in API input. Whole numbers written with a
+// fraction part, like 10.0, are accepted; 10.5 is rejected rather than
+// truncated.
+type Quantity int
+
+// UnmarshalJSON accepts a JSON number with no fractional value
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if n, err := strconv.Atoi(string(data)); err == nil {
+		*q = Quantity(n)
+		return nil
+	}
+
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	if f != math.Trunc(f) {
+		return ErrFractionalQuantity
+	}
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		return &json.UnmarshalTypeError{Value: "number " + string(data), Type: reflect.TypeFor[Quantity]()}
+	}
+	*q = Quantity(f)
+	return nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestQuantity_UnmarshalJSON tests that whole numbers are accepted in any
+// notation and fractional ones are rejected
+func TestQuantity_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Quantity
+		err      error
+	}{
+		{"10", 10, nil},
+		{"10.0", 10, nil},
+		{"1e2", 100, nil},
+		{"-3", -3, nil},
+		{"10.5", 0, ErrFractionalQuantity},
+		{"0.1", 0, ErrFractionalQuantity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var q Quantity
+			err := json.Unmarshal([]byte(tt.input), &q)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if q != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, q)
+			}
+		})
+	}
+}
+
+// TestQuantity_RejectsNonNumbers tests that strings and out-of-range numbers are not quantities
+func TestQuantity_RejectsNonNumbers(t *testing.T) {
+	for _, input := range []string{`"10"`, `true`, `1e300`} {
+		var q Quantity
+		if err := json.Unmarshal([]byte(input), &q); err == nil {
+			t.Errorf("Expected an error for %s, got %d", input, q)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+// Settings is the configuration that changes how ids and prices are encoded
+type Settings struct {
+	// OpaqueIDs renders ids as opaque strings, as with ID_FORMAT=opaque
+	OpaqueIDs bool
+	// PriceScale is the number of decimals prices are stored and rendered
+	// with, PRICE_SCALE
+	PriceScale int
+}
+
+// DefaultSettings are the settings in effect until Configure is called:
+// integer ids and two price decimals, as with an empty configuration
+var DefaultSettings = Settings{PriceScale: 2}
+
+// PricePrecision is the total number of digits a stored price has, the
+// PriceScale decimals included
+const PricePrecision = 14
+
+var settings = DefaultSettings
+
+// Configure sets how ids and prices are encoded. main calls it once at
+// startup, from the configuration, before serving requests; it must not be
+// called while values are being encoded.
+func Configure(s Settings) {
+	settings = s
+}
+
+// PriceScale returns the number of decimals prices are stored and rendered with
+func PriceScale() int {
+	return settings.PriceScale
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportCategoryError reports a product category that an import could not
+// resolve by name
+type ImportCategoryError struct {
+	Name string
+}
+
+func (e *ImportCategoryError) Error() string {
+	return "import references unknown category: " + e.Name
+}
+
+// CatalogRepository defines the interface for bulk catalog writes
+type CatalogRepository interface {
+	Import(ctx context.Context, input models.CatalogImport, createdBy string) (models.CatalogImportResult, error)
+}
+
+// catalogRepository implements CatalogRepository using PostgreSQL
+type catalogRepository struct {
+	db DB
+}
+
+// NewCatalogRepository creates a new CatalogRepository
+func NewCatalogRepository(db DB) CatalogRepository {
+	return &catalogRepository{db: db}
+}
+
+// Import creates the categories and then the products of input in a single
+// transaction. Rows whose name already exists are skipped and reported; an
+// existing category can still be referenced by the imported products. A
+// product naming an unknown category aborts the whole import.
+func (r *catalogRepository) Import(ctx context.Context, input models.CatalogImport, createdBy string) (models.CatalogImportResult, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result := models.CatalogImportResult{Skipped: []models.CatalogSkippedItem{}}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback(ctx)
+
+	categoryIDs := make(map[string]int, len(input.Categories))
+
+	insertCategory := `INSERT INTO categories (name, description, created_by)
+					   VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'system'))
+					   ON CONFLICT (LOWER(name)) DO NOTHING
+					   RETURNING id`
+	for _, cat := range input.Categories {
+		var id int
+		err := tx.QueryRow(ctx, insertCategory, cat.Name, cat.Description, createdBy).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			result.Skipped = append(result.Skipped, models.CatalogSkippedItem{
+				Type: "category", Name: cat.Name, Reason: "name already exists",
+			})
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		categoryIDs[cat.Name] = id
+		result.CategoriesCreated++
+	}
+
+	insertProduct := `INSERT INTO products (name, price, stock, category_id, created_by)
+					  VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'system'))
+					  ON CONFLICT (LOWER(name)) DO NOTHING
+					  RETURNING id`
+	for _, p := range input.Products {
+		var categoryID *int
+		if p.Category != "" {
+			id, ok := categoryIDs[p.Category]
+			if !ok {
+				err := tx.QueryRow(ctx, `SELECT id FROM categories WHERE LOWER(name) = LOWER($1)`, p.Category).Scan(&id)
+				if errors.Is(err, pgx.ErrNoRows) {
+					return result, &ImportCategoryError{Name: p.Category}
+				}
+				if err != nil {
+					return result, err
+				}
+				categoryIDs[p.Category] = id
+			}
+			categoryID = &id
+		}
+
+		var id int
+		err := tx.QueryRow(ctx, insertProduct, p.Name, p.Price, int(p.Stock), categoryID, createdBy).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			result.Skipped = append(result.Skipped, models.CatalogSkippedItem{
+				Type: "product", Name: p.Name, Reason: "name already exists",
+			})
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.ProductsCreated++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result, err
+	}
+	return result, nil
+}
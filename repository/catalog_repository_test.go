@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+)
+
+// TestCatalogRepository_ImportResolvesNames tests that imported products are
+// linked to categories by name and conflicting rows are skipped
+func TestCatalogRepository_ImportResolvesNames(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCatalogRepository(db)
+	ctx := context.Background()
+
+	if _, err := NewCategoryRepository(db).Create(ctx, models.Category{Name: "Electronics"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result, err := repo.Import(ctx, models.CatalogImport{
+		Categories: []models.CatalogCategoryInput{{Name: "Books"}, {Name: "Electronics"}},
+		Products: []models.CatalogProductInput{
+			{Name: "Go Book", Price: pricePtr(39.5), Stock: 5, Category: "Books"},
+			{Name: "USB Cable", Price: pricePtr(5), Stock: 100, Category: "Electronics"},
+		},
+	}, "importer")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.CategoriesCreated != 1 || result.ProductsCreated != 2 || len(result.Skipped) != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	var category string
+	query := `SELECT c.name FROM products p JOIN categories c ON c.id = p.category_id WHERE p.name = $1`
+	if err := db.QueryRow(ctx, query, "USB Cable").Scan(&category); err != nil {
+		t.Fatalf("Failed to read product category: %v", err)
+	}
+	if category != "Electronics" {
+		t.Errorf("Expected USB Cable in Electronics, got %s", category)
+	}
+}
+
+// TestCatalogRepository_ImportRollsBack tests that an unknown category name
+// leaves the database untouched
+func TestCatalogRepository_ImportRollsBack(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCatalogRepository(db)
+	ctx := context.Background()
+
+	_, err := repo.Import(ctx, models.CatalogImport{
+		Categories: []models.CatalogCategoryInput{{Name: "Books"}},
+		Products:   []models.CatalogProductInput{{Name: "Pen", Price: pricePtr(1), Category: "Stationery"}},
+	}, "")
+
+	var catErr *ImportCategoryError
+	if !errors.As(err, &catErr) || catErr.Name != "Stationery" {
+		t.Fatalf("Expected ImportCategoryError for Stationery, got %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM categories`).Scan(&count); err != nil {
+		t.Fatalf("Failed to count categories: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no categories after rollback, got %d", count)
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxAncestorDepth bounds the recursive ancestor walk in case of parent cycles
+const maxAncestorDepth = 32
+
+// categoryTreeLock is the advisory lock key that serializes parent changes,
+// so two concurrent updates cannot each pass the cycle check and together
+// close a loop
+const categoryTreeLock = 0x63617465
+
+// parentCreatesCycle reports whether making parentID the parent of id would
+// put id among its own ancestors. It takes categoryTreeLock for the rest of
+// tx, so the answer holds until tx commits.
+func parentCreatesCycle(ctx context.Context, tx pgx.Tx, id, parentID int) (bool, error) {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, categoryTreeLock); err != nil {
+		return false, err
+	}
+
+	// UNION rather than UNION ALL stops the walk on a cycle already stored
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id, c.parent_id
+			FROM categories c
+			JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+	`
+
+	var cycle bool
+	if err := tx.QueryRow(ctx, query, parentID, id).Scan(&cycle); err != nil {
+		return false, err
+	}
+	return cycle, nil
+}
+
+// categoryPath returns the category with the given ID and all of its
+// ancestors, ordered from the root down to the category itself
+func categoryPath(ctx context.Context, db DB, id int) ([]models.Category, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, name, description, parent_id, 0 AS depth
+			FROM categories
+			WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.name, c.description, c.parent_id, a.depth + 1
+			FROM categories c
+			JOIN ancestors a ON c.id = a.parent_id
+			WHERE a.depth < $2
+		)
+		SELECT id, name, COALESCE(description, ''), parent_id FROM ancestors ORDER BY depth DESC
+	`
+
+	rows, err := db.Query(ctx, query, id, maxAncestorDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	path := []models.Category{}
+	for rows.Next() {
+		var cat models.Category
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.ParentID); err != nil {
+			return nil, err
+		}
+		path = append(path, cat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return path, nil
+}
@@ -3,38 +3,63 @@ package repository
 import (
 	"context"
 	"errors"
+	"slices"
 
 	"github.com/KAnggara75/BelajarGolang/models"
 	"github.com/jackc/pgx/v5"
 )
 
 var (
-	ErrNotFound   = errors.New("category not found")
-	ErrNameExists = errors.New("category name already exists")
+	ErrNotFound               = errors.New("category not found")
+	ErrNameExists             = errors.New("category name already exists")
+	ErrParentNotFound         = errors.New("parent category not found")
+	ErrParentCycle            = errors.New("parent would create a cycle")
+	ErrReassignTargetNotFound = errors.New("reassign target category not found")
+	ErrReassignSameCategory   = errors.New("cannot reassign products to the same category")
 )
 
 // CategoryRepository defines the interface for category data access
 type CategoryRepository interface {
 	GetAll(ctx context.Context) ([]models.Category, error)
+	GetAllWithCounts(ctx context.Context) ([]models.CategoryWithCount, error)
 	GetByID(ctx context.Context, id int) (models.Category, error)
+	Count(ctx context.Context) (int, error)
 	Create(ctx context.Context, cat models.Category) (models.Category, error)
 	Update(ctx context.Context, id int, cat models.Category) (models.Category, error)
 	Delete(ctx context.Context, id int) error
+	DeleteReassigning(ctx context.Context, id, toID int) error
+	ReassignProducts(ctx context.Context, fromID, toID int) error
+	DeleteMany(ctx context.Context, ids []int, force bool) ([]models.CategoryDeleteResult, error)
+	UpdateDescriptions(ctx context.Context, updates []models.CategoryDescriptionInput) (int, []int, error)
 }
 
 // categoryRepository implements CategoryRepository using PostgreSQL
 type categoryRepository struct {
-	db *pgx.Conn
+	db DB
 }
 
 // NewCategoryRepository creates a new CategoryRepository
-func NewCategoryRepository(db *pgx.Conn) CategoryRepository {
+func NewCategoryRepository(db DB) CategoryRepository {
 	return &categoryRepository{db: db}
 }
 
+// categoryColumns is the select list shared by category queries; it must stay
+// in sync with scanCategory
+const categoryColumns = `id, name, description, parent_id, created_by, created_at, updated_at`
+
+// scanCategory scans a row selected with categoryColumns
+func scanCategory(row pgx.Row) (models.Category, error) {
+	var cat models.Category
+	err := row.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.ParentID, &cat.CreatedBy, &cat.CreatedAt, &cat.UpdatedAt)
+	return cat, err
+}
+
 // GetAll returns all categories from the database
 func (r *categoryRepository) GetAll(ctx context.Context) ([]models.Category, error) {
-	query := `SELECT id, name, description FROM categories ORDER BY id`
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + categoryColumns + ` FROM categories ORDER BY id`
 
 	rows, err := r.db.Query(ctx, query)
 	if err != nil {
@@ -44,8 +69,8 @@ func (r *categoryRepository) GetAll(ctx context.Context) ([]models.Category, err
 
 	var categories []models.Category
 	for rows.Next() {
-		var cat models.Category
-		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Description); err != nil {
+		cat, err := scanCategory(rows)
+		if err != nil {
 			return nil, err
 		}
 		categories = append(categories, cat)
@@ -63,12 +88,50 @@ func (r *categoryRepository) GetAll(ctx context.Context) ([]models.Category, err
 	return categories, nil
 }
 
+// GetAllWithCounts returns all categories ordered by id, each with the
+// number of products in it
+func (r *categoryRepository) GetAllWithCounts(ctx context.Context) ([]models.CategoryWithCount, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT c.id, c.name, c.description, c.parent_id, c.created_by, c.created_at, c.updated_at, COUNT(p.id)
+			  FROM categories c
+			  LEFT JOIN products p ON p.category_id = c.id
+			  GROUP BY c.id
+			  ORDER BY c.id`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.CategoryWithCount{}
+	for rows.Next() {
+		var cat models.CategoryWithCount
+		err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.ParentID, &cat.CreatedBy, &cat.CreatedAt, &cat.UpdatedAt,
+			&cat.ProductCount)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
 // GetByID returns a category by its ID
 func (r *categoryRepository) GetByID(ctx context.Context, id int) (models.Category, error) {
-	query := `SELECT id, name, description FROM categories WHERE id = $1`
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
 
-	var cat models.Category
-	err := r.db.QueryRow(ctx, query, id).Scan(&cat.ID, &cat.Name, &cat.Description)
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE id = $1`
+
+	cat, err := scanCategory(r.db.QueryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Category{}, ErrNotFound
@@ -79,56 +142,334 @@ func (r *categoryRepository) GetByID(ctx context.Context, id int) (models.Catego
 	return cat, nil
 }
 
-// Create adds a new category to the database
-func (r *categoryRepository) Create(ctx context.Context, cat models.Category) (models.Category, error) {
-	// Check if name already exists
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM categories WHERE name = $1)`
-	if err := r.db.QueryRow(ctx, checkQuery, cat.Name).Scan(&exists); err != nil {
-		return models.Category{}, err
-	}
-	if exists {
-		return models.Category{}, ErrNameExists
+// Count returns the number of categories
+func (r *categoryRepository) Count(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM categories`).Scan(&count); err != nil {
+		return 0, err
 	}
+	return count, nil
+}
+
+// Create adds a new category to the database. Duplicate names, compared
+// case-insensitively, are detected via the unique index on LOWER(name) so
+// concurrent creates cannot both succeed.
+func (r *categoryRepository) Create(ctx context.Context, cat models.Category) (models.Category, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
 
-	// Insert the new category
-	query := `INSERT INTO categories (name, description) VALUES ($1, $2) RETURNING id`
-	err := r.db.QueryRow(ctx, query, cat.Name, cat.Description).Scan(&cat.ID)
+	query := `INSERT INTO categories (name, description, parent_id, created_by)
+			  VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), 'system'))
+			  RETURNING ` + categoryColumns
+
+	created, err := scanCategory(r.db.QueryRow(ctx, query, cat.Name, cat.Description, cat.ParentID, cat.CreatedBy))
 	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Category{}, ErrNameExists
+		}
+		if isForeignKeyViolation(err) {
+			return models.Category{}, ErrParentNotFound
+		}
 		return models.Category{}, err
 	}
 
-	return cat, nil
+	return created, nil
 }
 
-// Update updates an existing category
+// Update updates an existing category, returning ErrParentCycle if its new
+// parent is the category itself or one of its descendants
 func (r *categoryRepository) Update(ctx context.Context, id int, cat models.Category) (models.Category, error) {
-	query := `UPDATE categories SET name = $1, description = $2 WHERE id = $3 RETURNING id, name, description`
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Category{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if cat.ParentID != nil {
+		cycle, err := parentCreatesCycle(ctx, tx, id, int(*cat.ParentID))
+		if err != nil {
+			return models.Category{}, err
+		}
+		if cycle {
+			return models.Category{}, ErrParentCycle
+		}
+	}
+
+	query := `UPDATE categories SET name = $1, description = $2, parent_id = $3, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $4
+			  RETURNING ` + categoryColumns
 
-	var updated models.Category
-	err := r.db.QueryRow(ctx, query, cat.Name, cat.Description, id).Scan(&updated.ID, &updated.Name, &updated.Description)
+	updated, err := scanCategory(tx.QueryRow(ctx, query, cat.Name, cat.Description, cat.ParentID, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Category{}, ErrNotFound
 		}
+		if isUniqueViolation(err) {
+			return models.Category{}, ErrNameExists
+		}
+		if isForeignKeyViolation(err) {
+			return models.Category{}, ErrParentNotFound
+		}
 		return models.Category{}, err
 	}
 
-	return updated, nil
+	return updated, tx.Commit(ctx)
 }
 
-// Delete removes a category by its ID
+// Delete removes a category by its ID. Products in the category are detached
+// and stamped with category_removed_at in the same transaction.
 func (r *categoryRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	detachQuery := `UPDATE products SET category_id = NULL, category_removed_at = CURRENT_TIMESTAMP,
+						version = version + 1, updated_at = CURRENT_TIMESTAMP
+					WHERE category_id = $1`
+	if _, err := tx.Exec(ctx, detachQuery, id); err != nil {
+		return err
+	}
+
 	query := `DELETE FROM categories WHERE id = $1`
 
-	result, err := r.db.Exec(ctx, query, id)
+	result, err := tx.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteReassigning moves every product of category id to toID and deletes
+// the emptied category, in one transaction, so no product is left without a
+// category. It returns ErrReassignTargetNotFound if toID does not exist and
+// ErrNotFound if id does not.
+func (r *categoryRepository) DeleteReassigning(ctx context.Context, id, toID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
+
+	if err := reassignProducts(ctx, tx, id, toID); err != nil {
+		return err
+	}
 
+	result, err := tx.Exec(ctx, `DELETE FROM categories WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
 	if result.RowsAffected() == 0 {
 		return ErrNotFound
 	}
 
-	return nil
+	return tx.Commit(ctx)
+}
+
+// ReassignProducts moves every product of category fromID to toID, returning
+// ErrReassignTargetNotFound if toID does not exist
+func (r *categoryRepository) ReassignProducts(ctx context.Context, fromID, toID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := reassignProducts(ctx, tx, fromID, toID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// reassignProducts moves the products of fromID to toID inside tx, recording
+// each move in the category history. Like any write to a product row it bumps
+// the version.
+func reassignProducts(ctx context.Context, tx pgx.Tx, fromID, toID int) error {
+	if fromID == toID {
+		return ErrReassignSameCategory
+	}
+
+	// FOR SHARE keeps the target from being deleted before commit
+	var found int
+	if err := tx.QueryRow(ctx, `SELECT id FROM categories WHERE id = $1 FOR SHARE`, toID).Scan(&found); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrReassignTargetNotFound
+		}
+		return err
+	}
+
+	historyQuery := `INSERT INTO product_category_history (product_id, old_category_id, new_category_id, changed_at)
+					 SELECT id, $2, $1, CURRENT_TIMESTAMP FROM products WHERE category_id = $2`
+	if _, err := tx.Exec(ctx, historyQuery, toID, fromID); err != nil {
+		return err
+	}
+
+	query := `UPDATE products SET category_id = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP
+			  WHERE category_id = $2`
+	_, err := tx.Exec(ctx, query, toID, fromID)
+	return err
+}
+
+// UpdateDescriptions sets the description of several categories in one
+// transaction. It returns the number of categories updated and the ids that
+// were not found; ids are expected to be unique.
+func (r *categoryRepository) UpdateDescriptions(ctx context.Context, updates []models.CategoryDescriptionInput) (int, []int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	ids := make([]int, 0, len(updates))
+	descriptions := make([]string, 0, len(updates))
+	for _, u := range updates {
+		ids = append(ids, int(u.ID))
+		descriptions = append(descriptions, u.Description)
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE categories c SET description = u.description, updated_at = CURRENT_TIMESTAMP
+			  FROM unnest($1::INTEGER[], $2::TEXT[]) AS u(id, description)
+			  WHERE c.id = u.id
+			  RETURNING c.id`
+
+	rows, err := tx.Query(ctx, query, ids, descriptions)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	found := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		found[id] = true
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, nil, err
+	}
+
+	missing := []int{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	return len(found), missing, nil
+}
+
+// DeleteMany removes several categories in one transaction. Categories that
+// still have products are reported as blocked and kept, unless force is set,
+// in which case their products are detached as in Delete. Results follow the
+// order of ids with duplicates dropped.
+func (r *categoryRepository) DeleteMany(ctx context.Context, ids []int, force bool) ([]models.CategoryDeleteResult, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the rows keeps products from being added to them until commit
+	rows, err := tx.Query(ctx, `SELECT id FROM categories WHERE id = ANY($1) ORDER BY id FOR UPDATE`, ids)
+	if err != nil {
+		return nil, err
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int)
+	countQuery := `SELECT category_id, COUNT(*) FROM products WHERE category_id = ANY($1) GROUP BY category_id`
+	rows, err = tx.Query(ctx, countQuery, found)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, count int
+		if err := rows.Scan(&id, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		counts[id] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.CategoryDeleteResult, 0, len(ids))
+	var deletable []int
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		result := models.CategoryDeleteResult{ID: models.ID(id), ProductCount: counts[id]}
+		switch {
+		case !slices.Contains(found, id):
+			result.Status = models.CategoryNotFound
+		case counts[id] > 0 && !force:
+			result.Status = models.CategoryBlocked
+		default:
+			result.Status = models.CategoryDeleted
+			deletable = append(deletable, id)
+		}
+		results = append(results, result)
+	}
+
+	if len(deletable) > 0 {
+		detachQuery := `UPDATE products SET category_id = NULL, category_removed_at = CURRENT_TIMESTAMP,
+						version = version + 1, updated_at = CURRENT_TIMESTAMP
+						WHERE category_id = ANY($1)`
+		if _, err := tx.Exec(ctx, detachQuery, deletable); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM categories WHERE id = ANY($1)`, deletable); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return results, nil
 }
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"testing"
 
 	"github.com/KAnggara75/BelajarGolang/models"
@@ -28,6 +30,16 @@ func (m *mockRepository) GetAll(ctx context.Context) ([]models.Category, error)
 	return result, nil
 }
 
+// GetAllWithCounts reports zero products; the mock holds no products
+func (m *mockRepository) GetAllWithCounts(ctx context.Context) ([]models.CategoryWithCount, error) {
+	categories, _ := m.GetAll(ctx)
+	result := make([]models.CategoryWithCount, len(categories))
+	for i, cat := range categories {
+		result[i] = models.CategoryWithCount{Category: cat}
+	}
+	return result, nil
+}
+
 func (m *mockRepository) GetByID(ctx context.Context, id int) (models.Category, error) {
 	cat, exists := m.categories[id]
 	if !exists {
@@ -36,6 +48,10 @@ func (m *mockRepository) GetByID(ctx context.Context, id int) (models.Category,
 	return cat, nil
 }
 
+func (m *mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.categories), nil
+}
+
 func (m *mockRepository) Create(ctx context.Context, cat models.Category) (models.Category, error) {
 	for _, existing := range m.categories {
 		if existing.Name == cat.Name {
@@ -43,9 +59,9 @@ func (m *mockRepository) Create(ctx context.Context, cat models.Category) (model
 		}
 	}
 
-	cat.ID = m.nextID
+	cat.ID = models.ID(m.nextID)
 	m.nextID++
-	m.categories[cat.ID] = cat
+	m.categories[int(cat.ID)] = cat
 	return cat, nil
 }
 
@@ -54,7 +70,7 @@ func (m *mockRepository) Update(ctx context.Context, id int, cat models.Category
 		return models.Category{}, ErrNotFound
 	}
 
-	cat.ID = id
+	cat.ID = models.ID(id)
 	m.categories[id] = cat
 	return cat, nil
 }
@@ -68,6 +84,51 @@ func (m *mockRepository) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
+func (m *mockRepository) DeleteReassigning(ctx context.Context, id, toID int) error {
+	if err := m.ReassignProducts(ctx, id, toID); err != nil {
+		return err
+	}
+	return m.Delete(ctx, id)
+}
+
+// ReassignProducts only checks the target; the mock holds no products
+func (m *mockRepository) ReassignProducts(ctx context.Context, fromID, toID int) error {
+	if fromID == toID {
+		return ErrReassignSameCategory
+	}
+	if _, exists := m.categories[toID]; !exists {
+		return ErrReassignTargetNotFound
+	}
+	return nil
+}
+
+func (m *mockRepository) UpdateDescriptions(ctx context.Context, updates []models.CategoryDescriptionInput) (int, []int, error) {
+	updated, missing := 0, []int{}
+	for _, u := range updates {
+		cat, exists := m.categories[int(u.ID)]
+		if !exists {
+			missing = append(missing, int(u.ID))
+			continue
+		}
+		cat.Description = u.Description
+		m.categories[int(u.ID)] = cat
+		updated++
+	}
+	return updated, missing, nil
+}
+
+func (m *mockRepository) DeleteMany(ctx context.Context, ids []int, force bool) ([]models.CategoryDeleteResult, error) {
+	results := make([]models.CategoryDeleteResult, 0, len(ids))
+	for _, id := range ids {
+		result := models.CategoryDeleteResult{ID: models.ID(id), Status: models.CategoryDeleted}
+		if err := m.Delete(ctx, id); err != nil {
+			result.Status = models.CategoryNotFound
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // TestMockRepository_GetAll tests GetAll functionality
 func TestMockRepository_GetAll(t *testing.T) {
 	repo := newMockRepository()
@@ -144,7 +205,7 @@ func TestMockRepository_GetByID(t *testing.T) {
 		Description: "Electronic devices",
 	})
 
-	retrieved, err := repo.GetByID(ctx, created.ID)
+	retrieved, err := repo.GetByID(ctx, int(created.ID))
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -181,7 +242,7 @@ func TestMockRepository_Update(t *testing.T) {
 		Description: "Original description",
 	})
 
-	updated, err := repo.Update(ctx, original.ID, models.Category{
+	updated, err := repo.Update(ctx, int(original.ID), models.Category{
 		Name:        "Updated",
 		Description: "Updated description",
 	})
@@ -219,12 +280,12 @@ func TestMockRepository_Delete(t *testing.T) {
 
 	created, _ := repo.Create(ctx, models.Category{Name: "To Delete"})
 
-	err := repo.Delete(ctx, created.ID)
+	err := repo.Delete(ctx, int(created.ID))
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	_, err = repo.GetByID(ctx, created.ID)
+	_, err = repo.GetByID(ctx, int(created.ID))
 	if err != ErrNotFound {
 		t.Error("Category should have been deleted")
 	}
@@ -248,3 +309,266 @@ func TestMockRepository_Delete_NotFound(t *testing.T) {
 func TestCategoryRepositoryInterface(t *testing.T) {
 	var _ CategoryRepository = (*mockRepository)(nil)
 }
+
+// TestCategoryRepository_DeleteMany tests that categories with products are
+// kept unless forced, and that forced deletes detach their products
+func TestCategoryRepository_DeleteMany(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCategoryRepository(db)
+	products := NewProductRepository(db)
+	ctx := context.Background()
+
+	full, err := repo.Create(ctx, models.Category{Name: "Full"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	empty, err := repo.Create(ctx, models.Category{Name: "Empty"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	product, err := products.Create(ctx, models.Product{Name: "Kept", Price: pricePtr(1), CategoryID: full.ID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	missing := int(empty.ID) + 1
+	results, err := repo.DeleteMany(ctx, []int{int(full.ID), int(empty.ID), missing}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []models.CategoryDeleteResult{
+		{ID: full.ID, Status: models.CategoryBlocked, ProductCount: 1},
+		{ID: empty.ID, Status: models.CategoryDeleted},
+		{ID: models.ID(missing), Status: models.CategoryNotFound},
+	}
+	if !slices.Equal(results, want) {
+		t.Errorf("Expected %+v, got %+v", want, results)
+	}
+	if _, err := repo.GetByID(ctx, int(full.ID)); err != nil {
+		t.Errorf("Expected blocked category to remain, got %v", err)
+	}
+
+	results, err = repo.DeleteMany(ctx, []int{int(full.ID)}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != models.CategoryDeleted {
+		t.Errorf("Expected forced delete, got %+v", results)
+	}
+
+	detached, err := products.GetByID(ctx, int(product.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if detached.CategoryID != 0 || detached.CategoryRemovedAt == nil {
+		t.Errorf("Expected product detached from deleted category, got %+v", detached)
+	}
+}
+
+// TestCategoryRepository_GetAllWithCounts tests that each category reports
+// its own products, including categories without any
+func TestCategoryRepository_GetAllWithCounts(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCategoryRepository(db)
+	products := NewProductRepository(db)
+	ctx := context.Background()
+
+	full, err := repo.Create(ctx, models.Category{Name: "Full"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, models.Category{Name: "Empty"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, name := range []string{"One", "Two"} {
+		if _, err := products.Create(ctx, models.Product{Name: name, Price: pricePtr(1), CategoryID: full.ID}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if _, err := products.Create(ctx, models.Product{Name: "Loose", Price: pricePtr(1)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	categories, err := repo.GetAllWithCounts(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(categories) != 2 || categories[0].Name != "Full" || categories[0].ProductCount != 2 ||
+		categories[1].Name != "Empty" || categories[1].ProductCount != 0 {
+		t.Errorf("Expected Full with 2 products and Empty with none, got %+v", categories)
+	}
+}
+
+// TestCategoryRepository_DeleteReassigning tests that products move to the
+// target before their category is deleted, and that a missing target leaves
+// everything in place
+func TestCategoryRepository_DeleteReassigning(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCategoryRepository(db)
+	products := NewProductRepository(db)
+	ctx := context.Background()
+
+	from, err := repo.Create(ctx, models.Category{Name: "Old"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	to, err := repo.Create(ctx, models.Category{Name: "New"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	product, err := products.Create(ctx, models.Product{Name: "Moved", Price: pricePtr(1), CategoryID: from.ID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := repo.DeleteReassigning(ctx, int(from.ID), int(to.ID)+1); !errors.Is(err, ErrReassignTargetNotFound) {
+		t.Fatalf("Expected ErrReassignTargetNotFound, got %v", err)
+	}
+	if err := repo.DeleteReassigning(ctx, int(from.ID), int(from.ID)); !errors.Is(err, ErrReassignSameCategory) {
+		t.Fatalf("Expected ErrReassignSameCategory, got %v", err)
+	}
+	if _, err := repo.GetByID(ctx, int(from.ID)); err != nil {
+		t.Fatalf("Expected category kept after a failed reassign, got %v", err)
+	}
+
+	if err := repo.DeleteReassigning(ctx, int(from.ID), int(to.ID)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.GetByID(ctx, int(from.ID)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected category deleted, got %v", err)
+	}
+
+	moved, err := products.GetByID(ctx, int(product.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if moved.CategoryID != to.ID || moved.CategoryRemovedAt != nil || moved.Version != product.Version+1 {
+		t.Errorf("Expected product moved to category %d at version %d, got %+v", to.ID, product.Version+1, moved)
+	}
+}
+
+// TestCategoryRepository_UpdateAdvancesUpdatedAt tests that Update refreshes
+// updated_at and returns the new value while created_at stays put
+func TestCategoryRepository_UpdateAdvancesUpdatedAt(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCategoryRepository(db)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, models.Category{Name: "Garden"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	updated, err := repo.Update(ctx, int(created.ID), models.Category{Name: "Garden", Description: "Outdoor"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("Expected updated_at to advance past %v, got %v", created.UpdatedAt, updated.UpdatedAt)
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Expected created_at %v to be kept, got %v", created.CreatedAt, updated.CreatedAt)
+	}
+}
+
+// TestCategoryRepository_UpdateParentCycle tests that a parent naming the
+// category itself, its child or its grandchild is rejected and left unsaved
+func TestCategoryRepository_UpdateParentCycle(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCategoryRepository(db)
+	ctx := context.Background()
+
+	root, err := repo.Create(ctx, models.Category{Name: "Home"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	child, err := repo.Create(ctx, models.Category{Name: "Kitchen", ParentID: &root.ID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	grandchild, err := repo.Create(ctx, models.Category{Name: "Cookware", ParentID: &child.ID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, parent := range []models.ID{root.ID, child.ID, grandchild.ID} {
+		if _, err := repo.Update(ctx, int(root.ID), models.Category{Name: "Home", ParentID: &parent}); err != ErrParentCycle {
+			t.Errorf("Parent %d: expected ErrParentCycle, got %v", parent, err)
+		}
+	}
+
+	current, err := repo.GetByID(ctx, int(root.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if current.ParentID != nil {
+		t.Errorf("Expected the root to stay without a parent, got %d", *current.ParentID)
+	}
+
+	// Moving a leaf under a sibling branch is not a cycle
+	other, err := repo.Create(ctx, models.Category{Name: "Garden"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, int(grandchild.ID), models.Category{Name: "Cookware", ParentID: &other.ID}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// TestCategoryRepository_NameUniqueIgnoringCase tests that the LOWER(name)
+// index rejects names differing only in case on create and update
+func TestCategoryRepository_NameUniqueIgnoringCase(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCategoryRepository(db)
+	ctx := context.Background()
+
+	if _, err := repo.Create(ctx, models.Category{Name: "Electronics"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, models.Category{Name: "electronics"}); err != ErrNameExists {
+		t.Errorf("Expected ErrNameExists on create, got %v", err)
+	}
+
+	books, err := repo.Create(ctx, models.Category{Name: "Books"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, int(books.ID), models.Category{Name: "ELECTRONICS"}); err != ErrNameExists {
+		t.Errorf("Expected ErrNameExists on update, got %v", err)
+	}
+	if _, err := repo.Update(ctx, int(books.ID), models.Category{Name: "BOOKS"}); err != nil {
+		t.Errorf("Expected a case-only rename of the same category to succeed, got %v", err)
+	}
+}
+
+// TestCategoryRepository_UpdateDescriptions tests that known categories are
+// updated together and unknown ids are reported
+func TestCategoryRepository_UpdateDescriptions(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCategoryRepository(db)
+	ctx := context.Background()
+
+	books, err := repo.Create(ctx, models.Category{Name: "Books", Description: "Old"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	updated, missing, err := repo.UpdateDescriptions(ctx, []models.CategoryDescriptionInput{
+		{ID: books.ID, Description: "Reading material"},
+		{ID: 999, Description: "Ghost"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated != 1 || len(missing) != 1 || missing[0] != 999 {
+		t.Errorf("Expected 1 updated and 999 missing, got %d and %v", updated, missing)
+	}
+
+	got, err := repo.GetByID(ctx, int(books.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Description != "Reading material" {
+		t.Errorf("Expected the new description, got %q", got.Description)
+	}
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TestIsUniqueViolation tests detection of the Postgres unique-violation code
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"wrapped unique violation", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}), true},
+		{"other pg error", &pgconn.PgError{Code: "23503"}, false},
+		{"plain error", errors.New("boom"), false},
+		{"nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestProductConflict tests that unique violations on products map to the
+// duplicated field
+func TestProductConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"sku", &pgconn.PgError{Code: "23505", ConstraintName: "products_sku_key"}, ErrProductSKUExists},
+		{"wrapped sku", fmt.Errorf("update: %w", &pgconn.PgError{Code: "23505", ConstraintName: "products_sku_key"}), ErrProductSKUExists},
+		{"name", &pgconn.PgError{Code: "23505", ConstraintName: "products_name_lower_key"}, ErrProductNameExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := productConflict(tt.err); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// IdempotencyKeyTTL is how long a product create is remembered by its
+	// Idempotency-Key; older keys are purged and may be reused
+	IdempotencyKeyTTL = 24 * time.Hour
+	// MaxIdempotencyKeyLength is the longest Idempotency-Key stored
+	MaxIdempotencyKeyLength = 255
+)
+
+// CreateIdempotent creates product once per key. The first call creates the
+// product and remembers its ID under key; a later call with the same key
+// returns that product instead, with replayed set. Keys expire after
+// IdempotencyKeyTTL. A create that fails, such as with ErrProductNameExists,
+// leaves the key unused so a retry tries again. The product is returned with
+// its category attached, as GetByID does.
+func (r *productRepository) CreateIdempotent(ctx context.Context, key string, product models.Product) (models.Product, bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	purgeQuery := `DELETE FROM product_idempotency_keys WHERE created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)`
+	if _, err := r.db.Exec(ctx, purgeQuery, IdempotencyKeyTTL.Seconds()); err != nil {
+		return models.Product{}, false, err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Product{}, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Claiming the key first makes a concurrent request with the same key
+	// wait here until this one commits or rolls back
+	claimQuery := `INSERT INTO product_idempotency_keys (key) VALUES ($1) ON CONFLICT (key) DO NOTHING`
+	tag, err := tx.Exec(ctx, claimQuery, key)
+	if err != nil {
+		return models.Product{}, false, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		var id *int
+		err := tx.QueryRow(ctx, `SELECT product_id FROM product_idempotency_keys WHERE key = $1`, key).Scan(&id)
+		if err != nil {
+			return models.Product{}, false, err
+		}
+		if id == nil {
+			return models.Product{}, false, errors.New("idempotency key has no product")
+		}
+		replayed, err := getProductTx(ctx, tx, *id)
+		return replayed, true, err
+	}
+
+	id, err := createInSavepoint(ctx, tx, product)
+	if err != nil {
+		return models.Product{}, false, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE product_idempotency_keys SET product_id = $2 WHERE key = $1`, key, id); err != nil {
+		return models.Product{}, false, err
+	}
+
+	created, err := getProductTx(ctx, tx, id)
+	if err != nil {
+		return models.Product{}, false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.Product{}, false, err
+	}
+	return created, false, nil
+}
+
+// getProductTx reads a product with its category inside tx
+func getProductTx(ctx context.Context, tx pgx.Tx, id int) (models.Product, error) {
+	query := `
+		SELECT ` + productColumns + `
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE p.id = $1
+	`
+	p, err := scanProduct(tx.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Product{}, ErrProductNotFound
+	}
+	return p, err
+}
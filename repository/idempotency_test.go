@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+)
+
+// TestProductRepository_CreateIdempotent tests that a key creates one product,
+// replays it while fresh and is forgotten once expired
+func TestProductRepository_CreateIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	first, replayed, err := repo.CreateIdempotent(ctx, "order-1", models.Product{Name: "Phone Case", Price: pricePtr(15)})
+	if err != nil || replayed {
+		t.Fatalf("Expected a new product, got replayed=%v err=%v", replayed, err)
+	}
+
+	again, replayed, err := repo.CreateIdempotent(ctx, "order-1", models.Product{Name: "Phone case 2", Price: pricePtr(15)})
+	if err != nil || !replayed || again.ID != first.ID {
+		t.Fatalf("Expected product %d replayed, got %d replayed=%v err=%v", first.ID, again.ID, replayed, err)
+	}
+
+	// A failed create leaves the key free for the retry
+	if _, _, err := repo.CreateIdempotent(ctx, "order-2", models.Product{Name: "phone case", Price: pricePtr(15)}); !errors.Is(err, ErrProductNameExists) {
+		t.Fatalf("Expected ErrProductNameExists, got %v", err)
+	}
+	if _, replayed, err := repo.CreateIdempotent(ctx, "order-2", models.Product{Name: "Screen Guard", Price: pricePtr(9)}); err != nil || replayed {
+		t.Fatalf("Expected the retry to create a product, got replayed=%v err=%v", replayed, err)
+	}
+
+	expire := `UPDATE product_idempotency_keys SET created_at = created_at - INTERVAL '25 hours' WHERE key = 'order-1'`
+	if _, err := db.Exec(ctx, expire); err != nil {
+		t.Fatalf("Failed to age key: %v", err)
+	}
+	fresh, replayed, err := repo.CreateIdempotent(ctx, "order-1", models.Product{Name: "Charger", Price: pricePtr(20)})
+	if err != nil || replayed || fresh.ID == first.ID {
+		t.Fatalf("Expected an expired key to create a new product, got %d replayed=%v err=%v", fresh.ID, replayed, err)
+	}
+
+	count, err := repo.Count(ctx, ProductFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 products, got %d", count)
+	}
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/KAnggara75/BelajarGolang/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// openTestDB connects to the database named by TEST_DATABASE_URL, runs the
+// migrations and empties every table. Tests are skipped when it is unset.
+func openTestDB(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping database integration test")
+	}
+
+	db, err := database.InitDB(url)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	truncate := `TRUNCATE product_idempotency_keys, product_price_history, product_stock_history, product_category_history, products, categories RESTART IDENTITY CASCADE`
+	if _, err := db.Exec(context.Background(), truncate); err != nil {
+		t.Fatalf("Failed to truncate tables: %v", err)
+	}
+
+	return db
+}
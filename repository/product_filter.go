@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProductFilter describes a filtered, paginated product listing. Zero values
+// mean "no constraint"; a zero Limit returns every matching row.
+type ProductFilter struct {
+	CategoryIDs []int
+	// Uncategorized matches only products without a category
+	Uncategorized bool
+	// Search matches products whose name contains it, case-insensitively
+	Search string
+	// MinPrice and MaxPrice bound the price inclusively; products without a
+	// price never match a price bound
+	MinPrice *float64
+	MaxPrice *float64
+	// CreatedAfter and CreatedBefore bound created_at inclusively
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// StockStatus is one of StockStatuses; LowStockThreshold is the highest
+	// stock still counted as low
+	StockStatus       string
+	LowStockThreshold int
+	// SortBy is one of ProductSortFields; empty or unknown sorts by id
+	SortBy   string
+	SortDesc bool
+	Limit    int
+	Offset   int
+	// ExpandCategory joins each product's category; without it Category is nil
+	ExpandCategory bool
+}
+
+// productSortColumns maps the sort fields clients may request to columns.
+// ORDER BY is built only from these values, never from raw input.
+var productSortColumns = map[string]string{
+	"id":    "p.id",
+	"name":  "p.name",
+	"price": "p.price",
+	"stock": "p.stock",
+	"value": "(p.price * p.stock)",
+}
+
+// ProductSortFields lists the accepted ProductFilter.SortBy values
+var ProductSortFields = []string{"id", "name", "price", "stock", "value"}
+
+// ProductRankFields lists the fields a product can be ranked by
+var ProductRankFields = []string{"price", "stock"}
+
+// Stock statuses accepted by ProductFilter.StockStatus
+const (
+	StockOut = "out"
+	StockLow = "low"
+	StockIn  = "in"
+)
+
+// StockStatuses lists the accepted ProductFilter.StockStatus values
+var StockStatuses = []string{StockOut, StockLow, StockIn}
+
+// likeEscaper escapes LIKE wildcards so a search term matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// where builds the WHERE clause and its positional arguments for the filter
+func (f ProductFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	if len(f.CategoryIDs) > 0 {
+		args = append(args, f.CategoryIDs)
+		conditions = append(conditions, fmt.Sprintf("p.category_id = ANY($%d)", len(args)))
+	}
+
+	if f.Uncategorized {
+		conditions = append(conditions, "p.category_id IS NULL")
+	}
+
+	if f.Search != "" {
+		args = append(args, likeEscaper.Replace(f.Search))
+		conditions = append(conditions, fmt.Sprintf("p.name ILIKE '%%' || $%d || '%%'", len(args)))
+	}
+
+	if f.MinPrice != nil {
+		args = append(args, *f.MinPrice)
+		conditions = append(conditions, fmt.Sprintf("p.price >= $%d", len(args)))
+	}
+
+	if f.MaxPrice != nil {
+		args = append(args, *f.MaxPrice)
+		conditions = append(conditions, fmt.Sprintf("p.price <= $%d", len(args)))
+	}
+
+	if f.CreatedAfter != nil {
+		args = append(args, *f.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("p.created_at >= $%d", len(args)))
+	}
+
+	if f.CreatedBefore != nil {
+		args = append(args, *f.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("p.created_at <= $%d", len(args)))
+	}
+
+	switch f.StockStatus {
+	case StockOut:
+		conditions = append(conditions, "p.stock = 0")
+	case StockLow:
+		args = append(args, f.LowStockThreshold)
+		conditions = append(conditions, fmt.Sprintf("p.stock > 0 AND p.stock <= $%d", len(args)))
+	case StockIn:
+		args = append(args, f.LowStockThreshold)
+		conditions = append(conditions, fmt.Sprintf("p.stock > $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// orderBy builds the ORDER BY clause. Products without a price sort last in
+// either direction, and id breaks ties so pages are stable.
+func (f ProductFilter) orderBy() string {
+	column, ok := productSortColumns[f.SortBy]
+	if !ok {
+		column = "p.id"
+	}
+
+	direction := "ASC"
+	if f.SortDesc {
+		direction = "DESC"
+	}
+
+	if column == "p.id" {
+		return "ORDER BY p.id " + direction
+	}
+	return fmt.Sprintf("ORDER BY %s %s NULLS LAST, p.id", column, direction)
+}
+
+// limitOffset builds the LIMIT/OFFSET clause, numbering placeholders after args
+func (f ProductFilter) limitOffset(args []any) (string, []any) {
+	if f.Limit <= 0 {
+		return "", args
+	}
+	args = append(args, f.Limit, f.Offset)
+	return fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args
+}
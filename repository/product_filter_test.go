@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestProductFilter_Where tests the generated WHERE clause and argument numbering
+func TestProductFilter_Where(t *testing.T) {
+	jan1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb1 := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter ProductFilter
+		clause string
+		args   []any
+	}{
+		{"no filter", ProductFilter{}, "", nil},
+		{"categories", ProductFilter{CategoryIDs: []int{1, 2}}, "WHERE p.category_id = ANY($1)", []any{[]int{1, 2}}},
+		{"uncategorized", ProductFilter{Uncategorized: true}, "WHERE p.category_id IS NULL", nil},
+		{
+			"search with categories",
+			ProductFilter{CategoryIDs: []int{1}, Search: "pro"},
+			"WHERE p.category_id = ANY($1) AND p.name ILIKE '%' || $2 || '%'",
+			[]any{[]int{1}, "pro"},
+		},
+		{
+			"price range",
+			ProductFilter{MinPrice: floatPtr(100), MaxPrice: floatPtr(500)},
+			"WHERE p.price >= $1 AND p.price <= $2",
+			[]any{100.0, 500.0},
+		},
+		{
+			"created range",
+			ProductFilter{CreatedAfter: &jan1, CreatedBefore: &feb1},
+			"WHERE p.created_at >= $1 AND p.created_at <= $2",
+			[]any{jan1, feb1},
+		},
+		{"created after only", ProductFilter{CreatedAfter: &jan1}, "WHERE p.created_at >= $1", []any{jan1}},
+		{"out of stock", ProductFilter{StockStatus: StockOut, LowStockThreshold: 10}, "WHERE p.stock = 0", nil},
+		{
+			"low stock with categories",
+			ProductFilter{CategoryIDs: []int{3}, StockStatus: StockLow, LowStockThreshold: 10},
+			"WHERE p.category_id = ANY($1) AND p.stock > 0 AND p.stock <= $2",
+			[]any{[]int{3}, 10},
+		},
+		{"in stock", ProductFilter{StockStatus: StockIn, LowStockThreshold: 5}, "WHERE p.stock > $1", []any{5}},
+		{"search escapes wildcards", ProductFilter{Search: `50%_off\`}, "WHERE p.name ILIKE '%' || $1 || '%'", []any{`50\%\_off\\`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args := tt.filter.where()
+			if clause != tt.clause {
+				t.Errorf("Expected clause %q, got %q", tt.clause, clause)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("Expected args %v, got %v", tt.args, args)
+			}
+		})
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// TestProductFilter_OrderBy tests that ORDER BY only uses whitelisted columns
+func TestProductFilter_OrderBy(t *testing.T) {
+	tests := []struct {
+		filter ProductFilter
+		want   string
+	}{
+		{ProductFilter{}, "ORDER BY p.id ASC"},
+		{ProductFilter{SortDesc: true}, "ORDER BY p.id DESC"},
+		{ProductFilter{SortBy: "price", SortDesc: true}, "ORDER BY p.price DESC NULLS LAST, p.id"},
+		{ProductFilter{SortBy: "name"}, "ORDER BY p.name ASC NULLS LAST, p.id"},
+		{ProductFilter{SortBy: "value", SortDesc: true}, "ORDER BY (p.price * p.stock) DESC NULLS LAST, p.id"},
+		{ProductFilter{SortBy: "price; DROP TABLE products"}, "ORDER BY p.id ASC"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.orderBy(); got != tt.want {
+			t.Errorf("SortBy %q desc %v: expected %q, got %q", tt.filter.SortBy, tt.filter.SortDesc, tt.want, got)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/KAnggara75/BelajarGolang/models"
 	"github.com/jackc/pgx/v5"
@@ -11,40 +13,113 @@ import (
 var (
 	ErrProductNotFound         = errors.New("product not found")
 	ErrProductNameExists       = errors.New("product name already exists")
+	ErrProductSKUExists        = errors.New("product sku already exists")
+	ErrVersionConflict         = errors.New("product was modified by another request")
 	ErrProductCategoryNotFound = errors.New("category not found")
+	ErrInvalidRankField        = errors.New("invalid rank field")
 )
 
+// productSKUKey is the unique constraint Postgres names for products.sku
+const productSKUKey = "products_sku_key"
+
+// productConflict maps a unique violation on products to the duplicated field
+func productConflict(err error) error {
+	if violatedConstraint(err) == productSKUKey {
+		return ErrProductSKUExists
+	}
+	return ErrProductNameExists
+}
+
 // ProductRepository defines the interface for product data access
 type ProductRepository interface {
 	GetAll(ctx context.Context) ([]models.Product, error)
+	StreamAll(ctx context.Context, fn func(models.Product) error) error
+	List(ctx context.Context, filter ProductFilter) ([]models.Product, error)
+	Count(ctx context.Context, filter ProductFilter) (int, error)
 	GetByID(ctx context.Context, id int) (models.Product, error)
 	GetByCategory(ctx context.Context, categoryID int) ([]models.Product, error)
+	GetLowStockByCategory(ctx context.Context, categoryID, threshold int) ([]models.Product, error)
+	GetCheapestByCategory(ctx context.Context, categoryID int) (models.Product, error)
+	GetRank(ctx context.Context, id int, by string) (models.ProductRank, error)
+	GetHistory(ctx context.Context, id int) ([]models.ProductHistoryEntry, error)
+	GetRecent(ctx context.Context, limit int) ([]models.Product, error)
+	SuggestNames(ctx context.Context, prefix string, limit int) ([]string, error)
+	GetReorderSuggestions(ctx context.Context) ([]models.Product, error)
+	GetUsedCategories(ctx context.Context) ([]models.CategorySummary, error)
+	GetAnomalies(ctx context.Context) (models.ProductAnomalies, error)
 	Create(ctx context.Context, product models.Product) (models.Product, error)
+	CreateInCategory(ctx context.Context, categoryID int, product models.Product) (models.Product, error)
+	CreateMany(ctx context.Context, products []models.Product) ([]error, error)
+	CreateIdempotent(ctx context.Context, key string, product models.Product) (models.Product, bool, error)
 	Update(ctx context.Context, id int, product models.Product) (models.Product, error)
+	MoveToCategory(ctx context.Context, id, categoryID int) (models.Product, error)
 	Delete(ctx context.Context, id int) error
+	SetActive(ctx context.Context, ids []int, active bool) (int, []int, error)
+	SetActiveByCategory(ctx context.Context, categoryID int, active bool) (int, error)
 	CategoryExists(ctx context.Context, categoryID int) (bool, error)
+	GetCategoryPath(ctx context.Context, categoryID int) ([]models.Category, error)
 }
 
 // productRepository implements ProductRepository using PostgreSQL
 type productRepository struct {
-	db *pgx.Conn
+	db DB
 }
 
 // NewProductRepository creates a new ProductRepository
-func NewProductRepository(db *pgx.Conn) ProductRepository {
+func NewProductRepository(db DB) ProductRepository {
 	return &productRepository{db: db}
 }
 
-// GetAll returns all products from the database with their category
-func (r *productRepository) GetAll(ctx context.Context) ([]models.Product, error) {
-	query := `
-		SELECT p.id, p.name, p.price, p.stock, COALESCE(p.category_id, 0), c.id, c.name, c.description
+// productColumns is the select list shared by product queries; it must stay in
+// sync with scanProduct
+const productColumns = productOwnColumns + `, c.id, c.name, c.description`
+
+// productOwnColumns is productColumns without the joined category columns
+const productOwnColumns = `
+	p.id, p.name, p.description, COALESCE(p.sku, ''), p.price, p.stock, p.reorder_point, p.reorder_qty, p.active, p.version, COALESCE(p.category_id, 0), p.category_removed_at, p.created_by,
+	p.created_at, p.updated_at`
+
+// productFrom returns the select list and FROM clause for a product query.
+// Without expandCategory the categories join is skipped and the category
+// columns are NULL, so scanProduct leaves Category nil.
+func productFrom(expandCategory bool) string {
+	if expandCategory {
+		return productColumns + `
 		FROM products p
-		LEFT JOIN categories c ON p.category_id = c.id
-		ORDER BY p.id
-	`
+		LEFT JOIN categories c ON p.category_id = c.id`
+	}
+	return productOwnColumns + `, NULL::int, NULL::text, NULL::text
+		FROM products p`
+}
 
-	rows, err := r.db.Query(ctx, query)
+// scanProduct scans a row selected with productColumns, attaching the category if present
+func scanProduct(row pgx.Row) (models.Product, error) {
+	var p models.Product
+	var catID *models.ID
+	var catName, catDesc *string
+
+	if err := row.Scan(&p.ID, &p.Name, &p.Description, &p.SKU, &p.Price, &p.Stock, &p.ReorderPoint, &p.ReorderQty, &p.Active, &p.Version, &p.CategoryID, &p.CategoryRemovedAt,
+		&p.CreatedBy, &p.CreatedAt, &p.UpdatedAt, &catID, &catName, &catDesc); err != nil {
+		return models.Product{}, err
+	}
+
+	// Attach category if exists
+	if catID != nil && catName != nil {
+		p.Category = &models.Category{
+			ID:   *catID,
+			Name: *catName,
+		}
+		if catDesc != nil {
+			p.Category.Description = *catDesc
+		}
+	}
+
+	return p, nil
+}
+
+// queryProducts runs a query selecting productColumns and collects the results
+func (r *productRepository) queryProducts(ctx context.Context, query string, args ...any) ([]models.Product, error) {
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -52,26 +127,10 @@ func (r *productRepository) GetAll(ctx context.Context) ([]models.Product, error
 
 	var products []models.Product
 	for rows.Next() {
-		var p models.Product
-		var catIDFromJoin *int
-		var catName, catDesc *string
-
-		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID,
-			&catIDFromJoin, &catName, &catDesc); err != nil {
+		p, err := scanProduct(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		// Attach category if exists
-		if catIDFromJoin != nil && catName != nil {
-			p.Category = &models.Category{
-				ID:   *catIDFromJoin,
-				Name: *catName,
-			}
-			if catDesc != nil {
-				p.Category.Description = *catDesc
-			}
-		}
-
 		products = append(products, p)
 	}
 
@@ -87,22 +146,99 @@ func (r *productRepository) GetAll(ctx context.Context) ([]models.Product, error
 	return products, nil
 }
 
+// GetAll returns all products from the database without their category;
+// use List with ExpandCategory to attach it
+func (r *productRepository) GetAll(ctx context.Context) ([]models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + productFrom(false) + `
+		ORDER BY p.id
+	`
+
+	return r.queryProducts(ctx, query)
+}
+
+// StreamAll calls fn for every product in id order, with its category
+// attached, without holding the whole table in memory. An error from fn stops
+// the iteration and is returned. Only the query start is bounded by
+// DB_QUERY_TIMEOUT; the rows are read for as long as fn keeps up.
+func (r *productRepository) StreamAll(ctx context.Context, fn func(models.Product) error) error {
+	ctx, started, cancel := withStartTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + productFrom(true) + `
+		ORDER BY p.id
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return startTimeoutErr(ctx, err)
+	}
+	defer rows.Close()
+
+	for first := true; rows.Next(); first = false {
+		if first {
+			started()
+		}
+		p, err := scanProduct(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return startTimeoutErr(ctx, rows.Err())
+}
+
+// List returns the products matching the filter in the filter's sort order
+func (r *productRepository) List(ctx context.Context, filter ProductFilter) ([]models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	where, args := filter.where()
+	limit, args := filter.limitOffset(args)
+	query := `
+		SELECT ` + productFrom(filter.ExpandCategory) + `
+		` + where + `
+		` + filter.orderBy() + `
+		` + limit
+
+	return r.queryProducts(ctx, query, args...)
+}
+
+// Count returns the number of products matching the filter, ignoring pagination
+func (r *productRepository) Count(ctx context.Context, filter ProductFilter) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	where, args := filter.where()
+	query := `SELECT COUNT(*) FROM products p ` + where
+
+	var count int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 // GetByID returns a product by its ID with category
 func (r *productRepository) GetByID(ctx context.Context, id int) (models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT p.id, p.name, p.price, p.stock, COALESCE(p.category_id, 0),
-			   c.id, c.name, c.description
+		SELECT ` + productColumns + `
 		FROM products p
 		LEFT JOIN categories c ON p.category_id = c.id
 		WHERE p.id = $1
 	`
 
-	var p models.Product
-	var catID *int
-	var catName, catDesc *string
-
-	err := r.db.QueryRow(ctx, query, id).Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID,
-		&catID, &catName, &catDesc)
+	p, err := scanProduct(r.db.QueryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Product{}, ErrProductNotFound
@@ -110,76 +246,292 @@ func (r *productRepository) GetByID(ctx context.Context, id int) (models.Product
 		return models.Product{}, err
 	}
 
-	// Attach category if exists
-	if catID != nil && catName != nil {
-		p.Category = &models.Category{
-			ID:   *catID,
-			Name: *catName,
-		}
-		if catDesc != nil {
-			p.Category.Description = *catDesc
-		}
-	}
-
 	return p, nil
 }
 
 // GetByCategory returns all products for a specific category
 func (r *productRepository) GetByCategory(ctx context.Context, categoryID int) ([]models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT p.id, p.name, p.price, p.stock, COALESCE(p.category_id, 0),
-			   c.id, c.name, c.description
+		SELECT ` + productColumns + `
 		FROM products p
 		LEFT JOIN categories c ON p.category_id = c.id
 		WHERE p.category_id = $1
 		ORDER BY p.id
 	`
 
-	rows, err := r.db.Query(ctx, query, categoryID)
+	return r.queryProducts(ctx, query, categoryID)
+}
+
+// GetLowStockByCategory returns products in a category whose stock is at or below the threshold
+func (r *productRepository) GetLowStockByCategory(ctx context.Context, categoryID, threshold int) ([]models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + productColumns + `
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE p.category_id = $1 AND p.stock <= $2
+		ORDER BY p.stock, p.id
+	`
+
+	return r.queryProducts(ctx, query, categoryID, threshold)
+}
+
+// GetReorderSuggestions returns products at or below their reorder point that
+// have a reorder quantity set, most urgent first: out of stock, then by stock
+// as a fraction of the reorder point
+func (r *productRepository) GetReorderSuggestions(ctx context.Context) ([]models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + productColumns + `
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE p.stock <= p.reorder_point AND p.reorder_qty > 0
+		ORDER BY COALESCE(p.stock::float8 / NULLIF(p.reorder_point, 0), 0), p.id
+	`
+
+	return r.queryProducts(ctx, query)
+}
+
+// GetCheapestByCategory returns the lowest-priced product in a category,
+// ignoring products without a price. ErrProductNotFound means the category
+// has no priced products.
+func (r *productRepository) GetCheapestByCategory(ctx context.Context, categoryID int) (models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + productColumns + `
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE p.category_id = $1 AND p.price IS NOT NULL
+		ORDER BY p.price ASC, p.id
+		LIMIT 1
+	`
+
+	p, err := scanProduct(r.db.QueryRow(ctx, query, categoryID))
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Product{}, ErrProductNotFound
+		}
+		return models.Product{}, err
+	}
+
+	return p, nil
+}
+
+// GetRank returns a product's position within its category ordered by the
+// given field, one of ProductRankFields. Ties share a rank, and uncategorized
+// products are ranked among themselves.
+func (r *productRepository) GetRank(ctx context.Context, id int, by string) (models.ProductRank, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if !slices.Contains(ProductRankFields, by) {
+		return models.ProductRank{}, ErrInvalidRankField
+	}
+	column := productSortColumns[by]
+
+	query := `
+		SELECT rank, total FROM (
+			SELECT p.id,
+				   RANK() OVER (PARTITION BY p.category_id ORDER BY ` + column + `) AS rank,
+				   COUNT(*) OVER (PARTITION BY p.category_id) AS total
+			FROM products p
+		) ranked
+		WHERE id = $1
+	`
+
+	var rank models.ProductRank
+	if err := r.db.QueryRow(ctx, query, id).Scan(&rank.Rank, &rank.Total); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ProductRank{}, ErrProductNotFound
+		}
+		return models.ProductRank{}, err
+	}
+
+	return rank, nil
+}
+
+// GetHistory returns a product's recorded changes, oldest first. The timeline
+// is assembled from the product's creation stamp, its price, stock and
+// category history and the time its category was last removed.
+func (r *productRepository) GetHistory(ctx context.Context, id int) ([]models.ProductHistoryEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	created := models.ProductHistoryEntry{Event: models.ProductCreated}
+	var categoryRemovedAt *time.Time
+	productQuery := `SELECT created_at, created_by, category_removed_at FROM products WHERE id = $1`
+	if err := r.db.QueryRow(ctx, productQuery, id).Scan(&created.At, &created.By, &categoryRemovedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
 		return nil, err
 	}
-	defer rows.Close()
 
-	var products []models.Product
-	for rows.Next() {
-		var p models.Product
-		var catID *int
-		var catName, catDesc *string
+	history := []models.ProductHistoryEntry{created}
+	if categoryRemovedAt != nil {
+		history = append(history, models.ProductHistoryEntry{At: *categoryRemovedAt, Event: models.ProductCategoryRemoved})
+	}
 
-		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID,
-			&catID, &catName, &catDesc); err != nil {
+	tables := []struct {
+		query string
+		event string
+		dest  func(e *models.ProductHistoryEntry) []any
+	}{
+		{`SELECT changed_at, old_price, new_price FROM product_price_history WHERE product_id = $1 ORDER BY id`,
+			models.ProductPriceChanged,
+			func(e *models.ProductHistoryEntry) []any { return []any{&e.OldPrice, &e.NewPrice} }},
+		{`SELECT changed_at, old_stock, new_stock FROM product_stock_history WHERE product_id = $1 ORDER BY id`,
+			models.ProductStockChanged,
+			func(e *models.ProductHistoryEntry) []any { return []any{&e.OldStock, &e.NewStock} }},
+		{`SELECT changed_at, old_category_id, new_category_id FROM product_category_history WHERE product_id = $1 ORDER BY id`,
+			models.ProductCategoryChanged,
+			func(e *models.ProductHistoryEntry) []any { return []any{&e.OldCategoryID, &e.NewCategoryID} }},
+	}
+	for _, table := range tables {
+		rows, err := r.db.Query(ctx, table.query, id)
+		if err != nil {
 			return nil, err
 		}
-
-		// Attach category if exists
-		if catID != nil && catName != nil {
-			p.Category = &models.Category{
-				ID:   *catID,
-				Name: *catName,
-			}
-			if catDesc != nil {
-				p.Category.Description = *catDesc
+		for rows.Next() {
+			entry := models.ProductHistoryEntry{Event: table.event}
+			if err := rows.Scan(append([]any{&entry.At}, table.dest(&entry)...)...); err != nil {
+				rows.Close()
+				return nil, err
 			}
+			history = append(history, entry)
 		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
 
-		products = append(products, p)
+	// Stable, so creation stays first and changes made together keep their
+	// price, stock, category order when timestamps tie
+	slices.SortStableFunc(history, func(a, b models.ProductHistoryEntry) int { return a.At.Compare(b.At) })
+	return history, nil
+}
+
+// GetRecent returns the most recently added products, newest first
+func (r *productRepository) GetRecent(ctx context.Context, limit int) ([]models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + productColumns + `
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $1
+	`
+
+	return r.queryProducts(ctx, query, limit)
+}
+
+// SuggestNames returns up to limit product names starting with prefix,
+// case-insensitively, ordered by name. The prefix is matched literally.
+func (r *productRepository) SuggestNames(ctx context.Context, prefix string, limit int) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT name FROM products WHERE name ILIKE $1 || '%' ORDER BY name LIMIT $2`
+
+	rows, err := r.db.Query(ctx, query, likeEscaper.Replace(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if names == nil {
+		names = []string{}
+	}
+	return names, nil
+}
+
+// GetUsedCategories returns the categories that have at least one product, ordered by name
+func (r *productRepository) GetUsedCategories(ctx context.Context) ([]models.CategorySummary, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT c.id, c.name
+		FROM categories c
+		WHERE c.id IN (SELECT DISTINCT category_id FROM products WHERE category_id IS NOT NULL)
+		ORDER BY c.name
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.CategorySummary{}
+	for rows.Next() {
+		var cat models.CategorySummary
+		if err := rows.Scan(&cat.ID, &cat.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	// Return empty slice instead of nil
-	if products == nil {
-		products = []models.Product{}
+	return categories, nil
+}
+
+// GetAnomalies returns products with suspicious data, one list per anomaly
+// type. A product may appear in several lists.
+func (r *productRepository) GetAnomalies(ctx context.Context) (models.ProductAnomalies, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var anomalies models.ProductAnomalies
+	queries := []struct {
+		condition string
+		dst       *[]models.Product
+	}{
+		{`p.price <= 0`, &anomalies.NonPositivePrice},
+		{`p.stock = 0 AND p.active`, &anomalies.ActiveOutOfStock},
+		{`TRIM(p.name) = ''`, &anomalies.BlankName},
 	}
 
-	return products, nil
+	for _, q := range queries {
+		query := `
+			SELECT ` + productColumns + `
+			FROM products p
+			LEFT JOIN categories c ON p.category_id = c.id
+			WHERE ` + q.condition + `
+			ORDER BY p.id
+		`
+		products, err := r.queryProducts(ctx, query)
+		if err != nil {
+			return models.ProductAnomalies{}, err
+		}
+		*q.dst = products
+	}
+
+	return anomalies, nil
 }
 
 // CategoryExists checks if a category with the given ID exists
 func (r *productRepository) CategoryExists(ctx context.Context, categoryID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)`
 	err := r.db.QueryRow(ctx, query, categoryID).Scan(&exists)
@@ -189,89 +541,341 @@ func (r *productRepository) CategoryExists(ctx context.Context, categoryID int)
 	return exists, nil
 }
 
-// Create adds a new product to the database
+// GetCategoryPath returns the category lineage from the root down to categoryID
+func (r *productRepository) GetCategoryPath(ctx context.Context, categoryID int) ([]models.Category, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return categoryPath(ctx, r.db, categoryID)
+}
+
+// Create adds a new product to the database. Duplicate names, compared
+// case-insensitively, and duplicate SKUs are detected via their unique
+// indexes so concurrent creates cannot both succeed. A missing category is
+// detected the same way, via the category_id foreign key, so one deleted
+// mid-request is still reported as ErrProductCategoryNotFound.
 func (r *productRepository) Create(ctx context.Context, product models.Product) (models.Product, error) {
-	// Check if name already exists
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM products WHERE name = $1)`
-	if err := r.db.QueryRow(ctx, checkQuery, product.Name).Scan(&exists); err != nil {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var categoryID *models.ID
+	if product.CategoryID > 0 {
+		categoryID = &product.CategoryID
+	}
+
+	query := `INSERT INTO products (name, description, sku, price, stock, reorder_point, reorder_qty, category_id, created_by)
+			  VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), 'system'))
+			  RETURNING id, active, version, created_by, created_at, updated_at`
+	err := r.db.QueryRow(ctx, query, product.Name, product.Description, product.SKU, product.Price, product.Stock, product.ReorderPoint, product.ReorderQty,
+		categoryID, product.CreatedBy).
+		Scan(&product.ID, &product.Active, &product.Version, &product.CreatedBy, &product.CreatedAt, &product.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Product{}, productConflict(err)
+		}
+		if isForeignKeyViolation(err) {
+			return models.Product{}, ErrProductCategoryNotFound
+		}
+		return models.Product{}, err
+	}
+
+	return product, nil
+}
+
+// CreateInCategory adds a product to categoryID in one transaction, returning
+// ErrProductCategoryNotFound if the category does not exist. Nothing is
+// written unless the whole insert succeeds. The created product is returned
+// with its category attached.
+func (r *productRepository) CreateInCategory(ctx context.Context, categoryID int, product models.Product) (models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
 		return models.Product{}, err
 	}
-	if exists {
-		return models.Product{}, ErrProductNameExists
+	defer tx.Rollback(ctx)
+
+	// FOR SHARE keeps the category from being deleted before commit
+	var found int
+	categoryQuery := `SELECT id FROM categories WHERE id = $1 FOR SHARE`
+	if err := tx.QueryRow(ctx, categoryQuery, categoryID).Scan(&found); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Product{}, ErrProductCategoryNotFound
+		}
+		return models.Product{}, err
 	}
 
-	// Check if category exists (if specified)
-	if product.CategoryID > 0 {
-		catExists, err := r.CategoryExists(ctx, product.CategoryID)
-		if err != nil {
-			return models.Product{}, err
+	var id int
+	insertQuery := `INSERT INTO products (name, description, sku, price, stock, reorder_point, reorder_qty, category_id, created_by)
+					VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), 'system'))
+					RETURNING id`
+	err = tx.QueryRow(ctx, insertQuery, product.Name, product.Description, product.SKU, product.Price, product.Stock, product.ReorderPoint, product.ReorderQty,
+		categoryID, product.CreatedBy).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Product{}, productConflict(err)
 		}
-		if !catExists {
-			return models.Product{}, ErrProductCategoryNotFound
+		return models.Product{}, err
+	}
+
+	query := `
+		SELECT ` + productColumns + `
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE p.id = $1
+	`
+	created, err := scanProduct(tx.QueryRow(ctx, query, id))
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Product{}, err
+	}
+
+	return created, nil
+}
+
+// CreateMany adds products in one transaction, each under its own savepoint
+// so a failing product does not undo the others. It returns one error per
+// product, nil for those created, such as ErrProductNameExists or
+// ErrProductCategoryNotFound. The second result is set only when the batch as
+// a whole failed and nothing was written.
+func (r *productRepository) CreateMany(ctx context.Context, products []models.Product) ([]error, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	results := make([]error, len(products))
+	for i, product := range products {
+		_, err := createInSavepoint(ctx, tx, product)
+		if err != nil && !errors.Is(err, ErrProductNameExists) && !errors.Is(err, ErrProductSKUExists) &&
+			!errors.Is(err, ErrProductCategoryNotFound) {
+			return nil, err
 		}
+		results[i] = err
 	}
 
-	// Insert the new product
-	var query string
-	var err error
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// createInSavepoint inserts one product of a batch, rolling back only its own
+// savepoint on failure, and returns the new product's ID
+func createInSavepoint(ctx context.Context, tx pgx.Tx, product models.Product) (int, error) {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer sp.Rollback(ctx)
 
+	var categoryID *models.ID
 	if product.CategoryID > 0 {
-		query = `INSERT INTO products (name, price, stock, category_id) VALUES ($1, $2, $3, $4) RETURNING id`
-		err = r.db.QueryRow(ctx, query, product.Name, product.Price, product.Stock, product.CategoryID).Scan(&product.ID)
-	} else {
-		query = `INSERT INTO products (name, price, stock) VALUES ($1, $2, $3) RETURNING id`
-		err = r.db.QueryRow(ctx, query, product.Name, product.Price, product.Stock).Scan(&product.ID)
+		// FOR SHARE keeps the category from being deleted before commit
+		var found int
+		categoryQuery := `SELECT id FROM categories WHERE id = $1 FOR SHARE`
+		if err := sp.QueryRow(ctx, categoryQuery, product.CategoryID).Scan(&found); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, ErrProductCategoryNotFound
+			}
+			return 0, err
+		}
+		categoryID = &product.CategoryID
 	}
 
+	var id int
+	query := `INSERT INTO products (name, description, sku, price, stock, reorder_point, reorder_qty, category_id, created_by)
+			  VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), 'system'))
+			  RETURNING id`
+	err = sp.QueryRow(ctx, query, product.Name, product.Description, product.SKU, product.Price, product.Stock, product.ReorderPoint, product.ReorderQty,
+		categoryID, product.CreatedBy).Scan(&id)
 	if err != nil {
-		return models.Product{}, err
+		if isUniqueViolation(err) {
+			return 0, productConflict(err)
+		}
+		return 0, err
 	}
 
-	return product, nil
+	return id, sp.Commit(ctx)
 }
 
-// Update updates an existing product
+// Update updates an existing product if it is still at product.Version,
+// returning ErrVersionConflict otherwise; models.AnyVersion matches the
+// current version. Every write to a product row bumps its version. A missing
+// category is detected via the category_id foreign key, as in Create.
 func (r *productRepository) Update(ctx context.Context, id int, product models.Product) (models.Product, error) {
-	// Check if category exists (if specified)
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	// Every statement below runs in one transaction. CURRENT_TIMESTAMP is fixed
+	// at transaction start in Postgres, so updated_at and the price history
+	// changed_at share exactly the same value.
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Product{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var oldPrice *models.Price
+	var oldStock int
+	var oldCategoryID *models.ID
+	var currentVersion int
+	lockQuery := `SELECT price, stock, category_id, version FROM products WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, lockQuery, id).Scan(&oldPrice, &oldStock, &oldCategoryID, &currentVersion); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Product{}, ErrProductNotFound
+		}
+		return models.Product{}, err
+	}
+	if product.Version == models.AnyVersion {
+		product.Version = currentVersion
+	}
+
+	var categoryID *models.ID
 	if product.CategoryID > 0 {
-		catExists, err := r.CategoryExists(ctx, product.CategoryID)
-		if err != nil {
-			return models.Product{}, err
+		categoryID = &product.CategoryID
+	}
+
+	// Assigning a category clears any earlier category_removed_at stamp
+	query := `UPDATE products SET name = $1, description = $2, sku = NULLIF($3, ''), price = $4, stock = $5,
+				 reorder_point = $6, reorder_qty = $7, category_id = $8,
+				 category_removed_at = CASE WHEN $8::INTEGER IS NULL THEN category_removed_at END,
+				 version = version + 1, updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $9 AND version = $10
+			 RETURNING id, name, description, COALESCE(sku, ''), price, stock, reorder_point, reorder_qty, active, version,
+					   COALESCE(category_id, 0), category_removed_at, created_by, created_at, updated_at`
+
+	var updated models.Product
+	err = tx.QueryRow(ctx, query, product.Name, product.Description, product.SKU, product.Price, product.Stock, product.ReorderPoint, product.ReorderQty,
+		categoryID, id, product.Version).
+		Scan(&updated.ID, &updated.Name, &updated.Description, &updated.SKU, &updated.Price, &updated.Stock, &updated.ReorderPoint, &updated.ReorderQty,
+			&updated.Active, &updated.Version, &updated.CategoryID,
+			&updated.CategoryRemovedAt, &updated.CreatedBy, &updated.CreatedAt, &updated.UpdatedAt)
+	if err != nil {
+		// The row is locked and exists, so no match means a stale version
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Product{}, ErrVersionConflict
+		}
+		if isUniqueViolation(err) {
+			return models.Product{}, productConflict(err)
 		}
-		if !catExists {
+		if isForeignKeyViolation(err) {
 			return models.Product{}, ErrProductCategoryNotFound
 		}
+		return models.Product{}, err
 	}
 
-	var query string
-	var updated models.Product
-	var err error
+	if !models.PricesEqual(oldPrice, updated.Price) {
+		historyQuery := `INSERT INTO product_price_history (product_id, old_price, new_price, changed_at)
+						 VALUES ($1, $2, $3, CURRENT_TIMESTAMP)`
+		if _, err := tx.Exec(ctx, historyQuery, id, oldPrice, updated.Price); err != nil {
+			return models.Product{}, err
+		}
+	}
+	if oldStock != updated.Stock {
+		historyQuery := `INSERT INTO product_stock_history (product_id, old_stock, new_stock, changed_at)
+						 VALUES ($1, $2, $3, CURRENT_TIMESTAMP)`
+		if _, err := tx.Exec(ctx, historyQuery, id, oldStock, updated.Stock); err != nil {
+			return models.Product{}, err
+		}
+	}
+	if err := recordCategoryChange(ctx, tx, id, oldCategoryID, categoryID); err != nil {
+		return models.Product{}, err
+	}
 
-	if product.CategoryID > 0 {
-		query = `UPDATE products SET name = $1, price = $2, stock = $3, category_id = $4 WHERE id = $5 
-				 RETURNING id, name, price, stock, COALESCE(category_id, 0)`
-		err = r.db.QueryRow(ctx, query, product.Name, product.Price, product.Stock, product.CategoryID, id).
-			Scan(&updated.ID, &updated.Name, &updated.Price, &updated.Stock, &updated.CategoryID)
-	} else {
-		query = `UPDATE products SET name = $1, price = $2, stock = $3, category_id = NULL WHERE id = $4 
-				 RETURNING id, name, price, stock, COALESCE(category_id, 0)`
-		err = r.db.QueryRow(ctx, query, product.Name, product.Price, product.Stock, id).
-			Scan(&updated.ID, &updated.Name, &updated.Price, &updated.Stock, &updated.CategoryID)
+	if err := tx.Commit(ctx); err != nil {
+		return models.Product{}, err
 	}
 
+	return updated, nil
+}
+
+// MoveToCategory reassigns a product to another category in one transaction,
+// touching only category_id, category_removed_at and updated_at, and records
+// the move in the category history
+func (r *productRepository) MoveToCategory(ctx context.Context, id, categoryID int) (models.Product, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
+		return models.Product{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var oldCategoryID *models.ID
+	lockQuery := `SELECT category_id FROM products WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, lockQuery, id).Scan(&oldCategoryID); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Product{}, ErrProductNotFound
 		}
 		return models.Product{}, err
 	}
 
-	return updated, nil
+	// FOR SHARE keeps the target category from being deleted before commit
+	var found int
+	categoryQuery := `SELECT id FROM categories WHERE id = $1 FOR SHARE`
+	if err := tx.QueryRow(ctx, categoryQuery, categoryID).Scan(&found); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Product{}, ErrProductCategoryNotFound
+		}
+		return models.Product{}, err
+	}
+
+	moveQuery := `UPDATE products SET category_id = $1, category_removed_at = NULL, version = version + 1,
+					  updated_at = CURRENT_TIMESTAMP
+				  WHERE id = $2`
+	if _, err := tx.Exec(ctx, moveQuery, categoryID, id); err != nil {
+		return models.Product{}, err
+	}
+	newCategoryID := models.ID(categoryID)
+	if err := recordCategoryChange(ctx, tx, id, oldCategoryID, &newCategoryID); err != nil {
+		return models.Product{}, err
+	}
+
+	query := `
+		SELECT ` + productColumns + `
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE p.id = $1
+	`
+	moved, err := scanProduct(tx.QueryRow(ctx, query, id))
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Product{}, err
+	}
+
+	return moved, nil
+}
+
+// recordCategoryChange writes a category history row inside tx when a
+// product's category changed from oldID to newID, nil meaning none
+func recordCategoryChange(ctx context.Context, tx pgx.Tx, id int, oldID, newID *models.ID) error {
+	if oldID == nil && newID == nil || oldID != nil && newID != nil && *oldID == *newID {
+		return nil
+	}
+	historyQuery := `INSERT INTO product_category_history (product_id, old_category_id, new_category_id, changed_at)
+					 VALUES ($1, $2, $3, CURRENT_TIMESTAMP)`
+	_, err := tx.Exec(ctx, historyQuery, id, oldID, newID)
+	return err
 }
 
 // Delete removes a product by its ID
 func (r *productRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `DELETE FROM products WHERE id = $1`
 
 	result, err := r.db.Exec(ctx, query, id)
@@ -285,3 +889,81 @@ func (r *productRepository) Delete(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// SetActive sets the active flag on the given products in one transaction.
+// It returns the number of products updated and the ids that were not found,
+// each once however often it was listed.
+func (r *productRepository) SetActive(ctx context.Context, ids []int, active bool) (int, []int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE products SET active = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = ANY($2) RETURNING id`
+
+	rows, err := tx.Query(ctx, query, active, ids)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	found := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		found[id] = true
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, nil, err
+	}
+
+	// An id repeated in the request is reported once
+	missing := []int{}
+	for _, id := range ids {
+		if !found[id] && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+
+	return len(found), missing, nil
+}
+
+// SetActiveByCategory sets the active flag on every product in a category in
+// one transaction and returns the number of products updated
+func (r *productRepository) SetActiveByCategory(ctx context.Context, categoryID int, active bool) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE products SET active = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP
+			  WHERE category_id = $2`
+
+	result, err := tx.Exec(ctx, query, active, categoryID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return int(result.RowsAffected()), nil
+}
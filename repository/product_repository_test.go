@@ -0,0 +1,724 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/spf13/viper"
+)
+
+func pricePtr(v float64) *models.Price {
+	p := models.NewPrice(v)
+	return &p
+}
+
+// TestProductRepository_UpdateSharesTimestamp tests that updated_at and the
+// price history changed_at are identical for a single update
+func TestProductRepository_UpdateSharesTimestamp(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, models.Product{Name: "Widget", Price: pricePtr(10), Stock: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := repo.Update(ctx, int(created.ID), models.Product{Name: "Widget", Price: pricePtr(12.5), Stock: 1, Version: 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var updatedAt, changedAt time.Time
+	query := `SELECT p.updated_at, h.changed_at
+			  FROM products p JOIN product_price_history h ON h.product_id = p.id
+			  WHERE p.id = $1`
+	if err := db.QueryRow(ctx, query, created.ID).Scan(&updatedAt, &changedAt); err != nil {
+		t.Fatalf("Failed to read timestamps: %v", err)
+	}
+
+	if !updatedAt.Equal(changedAt) {
+		t.Errorf("Expected updated_at %v to equal changed_at %v", updatedAt, changedAt)
+	}
+}
+
+// TestProductRepository_MoveToCategory tests that a move changes only the
+// category and reports missing products and categories
+func TestProductRepository_MoveToCategory(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	categories := NewCategoryRepository(db)
+	ctx := context.Background()
+
+	target, err := categories.Create(ctx, models.Category{Name: "Clothing"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	created, err := repo.Create(ctx, models.Product{Name: "Widget", Price: pricePtr(10), Stock: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	moved, err := repo.MoveToCategory(ctx, int(created.ID), int(target.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if moved.CategoryID != target.ID || moved.Category == nil || moved.Category.Name != "Clothing" {
+		t.Errorf("Expected product in Clothing, got %+v", moved)
+	}
+	if moved.Name != "Widget" || moved.Stock != 3 || !models.PricesEqual(moved.Price, pricePtr(10)) {
+		t.Errorf("Expected other fields unchanged, got %+v", moved)
+	}
+
+	history, err := repo.GetHistory(ctx, int(created.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if last := history[len(history)-1]; last.Event != models.ProductCategoryChanged || last.OldCategoryID != nil || *last.NewCategoryID != target.ID {
+		t.Errorf("Expected the move recorded as none -> %d, got %+v", target.ID, last)
+	}
+
+	if _, err := repo.MoveToCategory(ctx, int(created.ID)+1, int(target.ID)); err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+	if _, err := repo.MoveToCategory(ctx, int(created.ID), int(target.ID)+1); err != ErrProductCategoryNotFound {
+		t.Errorf("Expected ErrProductCategoryNotFound, got %v", err)
+	}
+}
+
+// TestProductRepository_CreateInCategory tests that a product is created with
+// its category attached, and that a failed insert leaves no row behind
+func TestProductRepository_CreateInCategory(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	cat, err := NewCategoryRepository(db).Create(ctx, models.Category{Name: "Stationery"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	created, err := repo.CreateInCategory(ctx, int(cat.ID), models.Product{Name: "Pencil", Price: pricePtr(1), Stock: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if created.CategoryID != cat.ID || created.Category == nil || created.Category.Name != "Stationery" {
+		t.Errorf("Expected product in Stationery, got %+v", created)
+	}
+
+	if _, err := repo.CreateInCategory(ctx, int(cat.ID), models.Product{Name: "PENCIL", Price: pricePtr(2)}); err != ErrProductNameExists {
+		t.Fatalf("Expected ErrProductNameExists, got %v", err)
+	}
+	if _, err := repo.CreateInCategory(ctx, int(cat.ID)+1, models.Product{Name: "Eraser", Price: pricePtr(1)}); err != ErrProductCategoryNotFound {
+		t.Fatalf("Expected ErrProductCategoryNotFound, got %v", err)
+	}
+
+	products, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(products) != 1 {
+		t.Errorf("Expected only the first product to be stored, got %d products", len(products))
+	}
+}
+
+// TestProductRepository_CreateMany tests that a failing product in a batch
+// does not undo the ones around it
+func TestProductRepository_CreateMany(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	errs, err := repo.CreateMany(ctx, []models.Product{
+		{Name: "Pen", Price: pricePtr(2)},
+		{Name: "PEN", Price: pricePtr(3)},
+		{Name: "Ruler", Price: pricePtr(4), CategoryID: 99},
+		{Name: "Stapler", Price: pricePtr(9)},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []error{nil, ErrProductNameExists, ErrProductCategoryNotFound, nil}
+	if !slices.Equal(errs, want) {
+		t.Errorf("Expected %v, got %v", want, errs)
+	}
+
+	products, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(products) != 2 || products[0].Name != "Pen" || products[1].Name != "Stapler" {
+		t.Errorf("Expected Pen and Stapler stored, got %+v", products)
+	}
+}
+
+// TestProductRepository_GetRank tests that products are ranked within their
+// own category and uncategorized products among themselves
+func TestProductRepository_GetRank(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	books, err := NewCategoryRepository(db).Create(ctx, models.Category{Name: "Books"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var ids []int
+	for _, p := range []models.Product{
+		{Name: "Novel", Price: pricePtr(20), Stock: 1, CategoryID: books.ID},
+		{Name: "Atlas", Price: pricePtr(50), Stock: 9, CategoryID: books.ID},
+		{Name: "Loose A", Price: pricePtr(5), Stock: 4},
+		{Name: "Loose B", Price: pricePtr(1), Stock: 2},
+	} {
+		created, err := repo.Create(ctx, p)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ids = append(ids, int(created.ID))
+	}
+
+	tests := []struct {
+		id   int
+		by   string
+		want models.ProductRank
+	}{
+		{ids[1], "price", models.ProductRank{Rank: 2, Total: 2}},
+		{ids[1], "stock", models.ProductRank{Rank: 2, Total: 2}},
+		{ids[2], "price", models.ProductRank{Rank: 2, Total: 2}},
+		{ids[2], "stock", models.ProductRank{Rank: 2, Total: 2}},
+		{ids[3], "price", models.ProductRank{Rank: 1, Total: 2}},
+	}
+	for _, tt := range tests {
+		got, err := repo.GetRank(ctx, tt.id, tt.by)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("GetRank(%d, %s) = %+v, want %+v", tt.id, tt.by, got, tt.want)
+		}
+	}
+
+	if _, err := repo.GetRank(ctx, ids[3]+1, "price"); err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+	if _, err := repo.GetRank(ctx, ids[0], "name"); err != ErrInvalidRankField {
+		t.Errorf("Expected ErrInvalidRankField, got %v", err)
+	}
+}
+
+// TestProductRepository_Timestamps tests that Create and Update return the
+// row's timestamps and that Update advances updated_at
+func TestProductRepository_Timestamps(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, models.Product{Name: "Lamp", Price: pricePtr(30), Stock: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+		t.Fatalf("Expected timestamps on create, got %+v", created)
+	}
+
+	updated, err := repo.Update(ctx, int(created.ID), models.Product{Name: "Lamp", Price: pricePtr(35), Stock: 2, Version: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Expected created_at %v to be kept, got %v", created.CreatedAt, updated.CreatedAt)
+	}
+	if !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("Expected updated_at to advance, got %v after %v", updated.UpdatedAt, created.UpdatedAt)
+	}
+
+	fetched, err := repo.GetByID(ctx, int(created.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !fetched.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Errorf("Expected GetByID updated_at %v, got %v", updated.UpdatedAt, fetched.UpdatedAt)
+	}
+}
+
+// TestProductRepository_UpdateRollsBackOnHistoryFailure tests that a failed
+// price history insert leaves the product row untouched
+func TestProductRepository_UpdateRollsBackOnHistoryFailure(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, models.Product{Name: "Kettle", Price: pricePtr(25), Stock: 4})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// NOT VALID skips existing rows, so only the insert made by Update is rejected
+	reject := `ALTER TABLE product_price_history ADD CONSTRAINT reject_all CHECK (false) NOT VALID`
+	if _, err := db.Exec(ctx, reject); err != nil {
+		t.Fatalf("Failed to add constraint: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(context.Background(), `ALTER TABLE product_price_history DROP CONSTRAINT IF EXISTS reject_all`)
+	})
+
+	_, err = repo.Update(ctx, int(created.ID), models.Product{Name: "Kettle Pro", Price: pricePtr(30), Stock: 9, Version: 1})
+	if err == nil {
+		t.Fatal("Expected the update to fail when the history insert fails")
+	}
+
+	got, err := repo.GetByID(ctx, int(created.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Name != "Kettle" || !models.PricesEqual(got.Price, pricePtr(25)) || got.Stock != 4 || !got.UpdatedAt.Equal(created.UpdatedAt) {
+		t.Errorf("Expected the product row unchanged, got %+v", got)
+	}
+}
+
+// TestProductRepository_ListExpandCategory tests that List attaches the
+// category only when ExpandCategory is set and GetAll never does
+func TestProductRepository_ListExpandCategory(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	cat, err := NewCategoryRepository(db).Create(ctx, models.Category{Name: "Books"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, models.Product{Name: "Go Book", Price: pricePtr(39.5), Stock: 5, CategoryID: cat.ID}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lazy, err := repo.List(ctx, ProductFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	all, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, products := range [][]models.Product{lazy, all} {
+		if len(products) != 1 || products[0].CategoryID != cat.ID || products[0].Category != nil {
+			t.Errorf("Expected category_id without category, got %+v", products)
+		}
+	}
+
+	eager, err := repo.List(ctx, ProductFilter{ExpandCategory: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(eager) != 1 || eager[0].Category == nil || eager[0].Category.Name != "Books" {
+		t.Errorf("Expected the Books category attached, got %+v", eager)
+	}
+}
+
+// TestProductRepository_ListByCategories tests that CategoryIDs is passed to
+// ANY($1) as an int array, for one ID or several
+func TestProductRepository_ListByCategories(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	categories := NewCategoryRepository(db)
+	ctx := context.Background()
+
+	var ids []int
+	for _, name := range []string{"Books", "Games", "Music"} {
+		cat, err := categories.Create(ctx, models.Category{Name: name})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := repo.Create(ctx, models.Product{Name: name + " Item", Price: pricePtr(10), Stock: 1, CategoryID: cat.ID}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ids = append(ids, int(cat.ID))
+	}
+	if _, err := repo.Create(ctx, models.Product{Name: "Loose Item", Price: pricePtr(10), Stock: 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter ProductFilter
+		want   []string
+	}{
+		{"one category", ProductFilter{CategoryIDs: ids[:1]}, []string{"Books Item"}},
+		{"two categories", ProductFilter{CategoryIDs: ids[1:]}, []string{"Games Item", "Music Item"}},
+		{"uncategorized", ProductFilter{Uncategorized: true}, []string{"Loose Item"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products, err := repo.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			names := make([]string, len(products))
+			for i, p := range products {
+				names[i] = p.Name
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, names)
+			}
+		})
+	}
+}
+
+// TestProductRepository_SuggestNames tests prefix matching ignores case and
+// treats LIKE wildcards in the prefix literally
+func TestProductRepository_SuggestNames(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	for _, name := range []string{"iPhone", "iPad", "Pixel", "50% Off Case"} {
+		if _, err := repo.Create(ctx, models.Product{Name: name, Price: pricePtr(1)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"i", 10, []string{"iPad", "iPhone"}},
+		{"I", 1, []string{"iPad"}},
+		{"%", 10, []string{}},
+		{"50%", 10, []string{"50% Off Case"}},
+	}
+
+	for _, tt := range tests {
+		names, err := repo.SuggestNames(ctx, tt.prefix, tt.limit)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !slices.Equal(names, tt.want) || names == nil {
+			t.Errorf("%q: expected %q, got %q", tt.prefix, tt.want, names)
+		}
+	}
+}
+
+// TestProductRepository_PriceRoundTrip tests that prices come back from the
+// NUMERIC column exactly as written, up to the largest price it holds
+func TestProductRepository_PriceRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	for i, price := range []models.Price{models.NewPrice(19.99), models.NewPrice(0.1), models.MaxPrice(models.PriceScale())} {
+		created, err := repo.Create(ctx, models.Product{Name: fmt.Sprintf("Priced %d", i), Price: &price})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got, err := repo.GetByID(ctx, int(created.ID))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !models.PricesEqual(got.Price, &price) {
+			t.Errorf("Expected price %v, got %v", price, got.Price)
+		}
+	}
+}
+
+// BenchmarkProductRepository_List compares listing a large catalog with and
+// without the category join
+func BenchmarkProductRepository_List(b *testing.B) {
+	db := openTestDB(b)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	seed := `
+		WITH cats AS (
+			INSERT INTO categories (name) SELECT 'Category ' || i FROM generate_series(1, 100) i RETURNING id
+		)
+		INSERT INTO products (name, price, stock, category_id)
+		SELECT 'Product ' || i, i % 1000, i % 50, (SELECT MIN(id) FROM cats) + i % 100
+		FROM generate_series(1, 20000) i`
+	if _, err := db.Exec(ctx, seed); err != nil {
+		b.Fatalf("Failed to seed products: %v", err)
+	}
+
+	for _, expand := range []bool{false, true} {
+		b.Run(fmt.Sprintf("expand=%v", expand), func(b *testing.B) {
+			filter := ProductFilter{ExpandCategory: expand}
+			for b.Loop() {
+				if _, err := repo.List(ctx, filter); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// TestProductRepository_NameUniqueIgnoringCase tests that product names
+// differing only in case are rejected on create and update
+func TestProductRepository_NameUniqueIgnoringCase(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	if _, err := repo.Create(ctx, models.Product{Name: "Books", Price: pricePtr(1)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, models.Product{Name: "BOOKS", Price: pricePtr(1)}); err != ErrProductNameExists {
+		t.Errorf("Expected ErrProductNameExists on create, got %v", err)
+	}
+
+	pens, err := repo.Create(ctx, models.Product{Name: "Pens", Price: pricePtr(1)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, int(pens.ID), models.Product{Name: "books", Price: pricePtr(1), Version: 1}); err != ErrProductNameExists {
+		t.Errorf("Expected ErrProductNameExists on update, got %v", err)
+	}
+}
+
+// TestProductRepository_UpdateVersion tests that an update at a stale
+// version fails with ErrVersionConflict and leaves the row untouched
+func TestProductRepository_UpdateVersion(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, models.Product{Name: "Globe", Price: pricePtr(20), Stock: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if created.Version != 1 {
+		t.Fatalf("Expected a new product at version 1, got %d", created.Version)
+	}
+
+	first, err := repo.Update(ctx, int(created.ID), models.Product{Name: "Globe", Price: pricePtr(25), Stock: 2, Version: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Expected version 2 after an update, got %d", first.Version)
+	}
+
+	if _, err := repo.Update(ctx, int(created.ID), models.Product{Name: "Globe", Price: pricePtr(30), Stock: 2, Version: 1}); err != ErrVersionConflict {
+		t.Fatalf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	current, err := repo.GetByID(ctx, int(created.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !models.PricesEqual(current.Price, pricePtr(25)) || current.Version != 2 {
+		t.Errorf("Expected price 25 at version 2, got %v at %d", *current.Price, current.Version)
+	}
+}
+
+// TestProductRepository_ConcurrentCreate tests that concurrent creates of the
+// same name leave exactly one product, the rest failing with
+// ErrProductNameExists rather than a raw database error
+func TestProductRepository_ConcurrentCreate(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	const attempts = 8
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.Create(ctx, models.Product{Name: "Stapler", Price: pricePtr(4)})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			created++
+		case ErrProductNameExists:
+		default:
+			t.Errorf("Expected ErrProductNameExists, got %v", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected exactly one create to succeed, got %d", created)
+	}
+}
+
+// TestProductRepository_SetActiveRepeatedIDs tests that an id listed twice
+// is counted once and, when unknown, reported missing once
+func TestProductRepository_SetActiveRepeatedIDs(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, models.Product{Name: "Widget", Price: pricePtr(10), Stock: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id := int(created.ID)
+
+	updated, missing, err := repo.SetActive(ctx, []int{id, id + 1, id, id + 1}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated != 1 || !slices.Equal(missing, []int{id + 1}) {
+		t.Errorf("Expected 1 updated and %d missing once, got %d and %v", id+1, updated, missing)
+	}
+}
+
+// TestProductRepository_GetHistory tests that creation and price changes are
+// returned oldest first and a missing product is reported
+func TestProductRepository_GetHistory(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, models.Product{Name: "Widget", Price: pricePtr(10), Stock: 1, CreatedBy: "alice"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, price := range []float64{12, 15} {
+		if _, err := repo.Update(ctx, int(created.ID), models.Product{Name: "Widget", Price: pricePtr(price), Stock: 1, Version: models.AnyVersion}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	history, err := repo.GetHistory(ctx, int(created.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(history) != 3 || history[0].Event != models.ProductCreated || history[0].By != "alice" {
+		t.Fatalf("Expected creation followed by two price changes, got %+v", history)
+	}
+	if last := history[2]; last.Event != models.ProductPriceChanged || !models.PricesEqual(last.OldPrice, pricePtr(12)) || !models.PricesEqual(last.NewPrice, pricePtr(15)) {
+		t.Errorf("Expected the last change to be 12 -> 15, got %+v", last)
+	}
+
+	if _, err := repo.GetHistory(ctx, 999); err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+}
+
+// TestProductRepository_GetHistoryStockAndCategory tests that stock changes
+// and category moves made by Update and by reassigning a category are
+// recorded and merged into the timeline
+func TestProductRepository_GetHistoryStockAndCategory(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	categories := NewCategoryRepository(db)
+	ctx := context.Background()
+
+	books, err := categories.Create(ctx, models.Category{Name: "Books"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	music, err := categories.Create(ctx, models.Category{Name: "Music"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	created, err := repo.Create(ctx, models.Product{Name: "Widget", Price: pricePtr(10), Stock: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, int(created.ID), models.Product{Name: "Widget", Price: pricePtr(10), Stock: 4, CategoryID: books.ID, Version: 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := categories.ReassignProducts(ctx, int(books.ID), int(music.ID)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	history, err := repo.GetHistory(ctx, int(created.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("Expected creation, a stock change and two category changes, got %+v", history)
+	}
+	if stock := history[1]; stock.Event != models.ProductStockChanged || *stock.OldStock != 1 || *stock.NewStock != 4 {
+		t.Errorf("Expected stock change 1 -> 4, got %+v", stock)
+	}
+	if moved := history[2]; moved.Event != models.ProductCategoryChanged || moved.OldCategoryID != nil || *moved.NewCategoryID != books.ID {
+		t.Errorf("Expected category change none -> %d, got %+v", books.ID, moved)
+	}
+	if moved := history[3]; moved.Event != models.ProductCategoryChanged || *moved.OldCategoryID != books.ID || *moved.NewCategoryID != music.ID {
+		t.Errorf("Expected category change %d -> %d, got %+v", books.ID, music.ID, moved)
+	}
+}
+
+// TestProductRepository_StreamAllOutlastsQueryTimeout tests that an export
+// reading its rows for longer than DB_QUERY_TIMEOUT, as to a slow client,
+// still delivers every product
+func TestProductRepository_StreamAllOutlastsQueryTimeout(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	for _, name := range []string{"Pen", "Pencil", "Ruler"} {
+		if _, err := repo.Create(ctx, models.Product{Name: name, Price: pricePtr(1)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	viper.Set("DB_QUERY_TIMEOUT", "50ms")
+	defer viper.Set("DB_QUERY_TIMEOUT", nil)
+
+	var names []string
+	err := repo.StreamAll(ctx, func(p models.Product) error {
+		time.Sleep(40 * time.Millisecond)
+		names = append(names, p.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !slices.Equal(names, []string{"Pen", "Pencil", "Ruler"}) {
+		t.Errorf("Expected all three products, got %v", names)
+	}
+}
+
+// TestProductRepository_MissingCategory tests that Create and Update report a
+// category that does not exist, caught by the foreign key, as
+// ErrProductCategoryNotFound and write nothing
+func TestProductRepository_MissingCategory(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewProductRepository(db)
+	categories := NewCategoryRepository(db)
+	ctx := context.Background()
+
+	gone, err := categories.Create(ctx, models.Category{Name: "Discontinued"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := categories.Delete(ctx, int(gone.ID)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := repo.Create(ctx, models.Product{Name: "Stapler", Price: pricePtr(5), CategoryID: gone.ID}); err != ErrProductCategoryNotFound {
+		t.Errorf("Expected ErrProductCategoryNotFound on create, got %v", err)
+	}
+
+	created, err := repo.Create(ctx, models.Product{Name: "Stapler", Price: pricePtr(5)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = repo.Update(ctx, int(created.ID), models.Product{Name: "Stapler", Price: pricePtr(6), CategoryID: gone.ID, Version: created.Version})
+	if err != ErrProductCategoryNotFound {
+		t.Errorf("Expected ErrProductCategoryNotFound on update, got %v", err)
+	}
+
+	current, err := repo.GetByID(ctx, int(created.ID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if current.Version != created.Version || current.CategoryID != 0 {
+		t.Errorf("Expected the failed update to leave the product unchanged, got %+v", current)
+	}
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/KAnggara75/BelajarGolang/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RunSelfTest exercises the category and product CRUD paths through the
+// repositories the API uses, inside a transaction that is always rolled
+// back, so no test data persists
+func RunSelfTest(db *pgxpool.Pool) error {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	categories := NewCategoryRepository(tx)
+	products := NewProductRepository(tx)
+
+	var category models.Category
+	var product models.Product
+	price := models.NewPrice(1.23)
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"create category", func() (err error) {
+			category, err = categories.Create(ctx, models.Category{Name: "__self_test_category__", Description: "self-test"})
+			return err
+		}},
+		{"create product", func() (err error) {
+			product, err = products.Create(ctx, models.Product{Name: "__self_test_product__", Price: &price, Stock: 1, CategoryID: category.ID})
+			return err
+		}},
+		{"read category", func() error {
+			_, err := categories.GetByID(ctx, int(category.ID))
+			return err
+		}},
+		{"read product", func() error {
+			_, err := products.GetByID(ctx, int(product.ID))
+			return err
+		}},
+		{"update category", func() error {
+			category.Description = "updated"
+			_, err := categories.Update(ctx, int(category.ID), category)
+			return err
+		}},
+		{"update product", func() error {
+			product.Stock = 2
+			updated, err := products.Update(ctx, int(product.ID), product)
+			if err == nil && updated.Stock != 2 {
+				return errors.New("update did not apply")
+			}
+			return err
+		}},
+		{"delete product", func() error {
+			return products.Delete(ctx, int(product.ID))
+		}},
+		{"delete category", func() error {
+			return categories.Delete(ctx, int(category.ID))
+		}},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			log.Printf("Self-test FAIL: %s: %v", step.name, err)
+			return fmt.Errorf("self-test step %q failed: %w", step.name, err)
+		}
+		log.Printf("Self-test PASS: %s", step.name)
+	}
+
+	log.Println("Self-test completed successfully")
+	return nil
+}
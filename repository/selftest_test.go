@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+// TestRunSelfTest tests that the self-test passes on a migrated database and
+// leaves no rows behind
+func TestRunSelfTest(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := RunSelfTest(db); err != nil {
+		t.Fatalf("Expected the self-test to pass, got %v", err)
+	}
+
+	var categories, products int
+	query := `SELECT (SELECT COUNT(*) FROM categories), (SELECT COUNT(*) FROM products)`
+	if err := db.QueryRow(context.Background(), query).Scan(&categories, &products); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if categories != 0 || products != 0 {
+		t.Errorf("Expected no rows left behind, got %d categories and %d products", categories, products)
+	}
+}
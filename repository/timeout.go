@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/KAnggara75/BelajarGolang/config"
+)
+
+// withTimeout bounds one repository call by DB_QUERY_TIMEOUT so a hung query
+// cannot hold its caller indefinitely. A deadline already on ctx still
+// applies if it is sooner.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, config.GetDBQueryTimeout())
+}
+
+// withStartTimeout bounds only the start of a streaming repository call by
+// DB_QUERY_TIMEOUT: ctx is cancelled unless started is called in time, and
+// after that it runs until the caller's ctx ends. A stream may legitimately
+// take far longer than one query, such as an export to a slow client.
+func withStartTimeout(ctx context.Context) (_ context.Context, started func(), cancel context.CancelFunc) {
+	ctx, cancelCause := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(config.GetDBQueryTimeout(), func() {
+		cancelCause(context.DeadlineExceeded)
+	})
+	started = func() { timer.Stop() }
+	cancel = func() {
+		timer.Stop()
+		cancelCause(context.Canceled)
+	}
+	return ctx, started, cancel
+}
+
+// startTimeoutErr reports a call cut off by withStartTimeout as
+// context.DeadlineExceeded, as withTimeout would, rather than as the
+// context.Canceled the driver sees
+func startTimeoutErr(ctx context.Context, err error) error {
+	if err != nil && context.Cause(ctx) == context.DeadlineExceeded {
+		return context.DeadlineExceeded
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// TestWithTimeout_Deadline tests that repository calls are bounded by DB_QUERY_TIMEOUT
+func TestWithTimeout_Deadline(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    time.Duration
+	}{
+		{"", 5 * time.Second},
+		{"750ms", 750 * time.Millisecond},
+		{"invalid", 5 * time.Second},
+		{"-1s", 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.setting, func(t *testing.T) {
+			viper.Set("DB_QUERY_TIMEOUT", tt.setting)
+			defer viper.Set("DB_QUERY_TIMEOUT", nil)
+
+			start := time.Now()
+			ctx, cancel := withTimeout(context.Background())
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatal("Expected a deadline")
+			}
+			if got := deadline.Sub(start); got < tt.want || got > tt.want+time.Second {
+				t.Errorf("Expected a deadline about %v away, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestWithTimeout_CancelledParent tests that an already cancelled context
+// stays cancelled, so the query is never sent
+func TestWithTimeout_CancelledParent(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	cancelParent()
+
+	ctx, cancel := withTimeout(parent)
+	defer cancel()
+
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", ctx.Err())
+	}
+}
+
+// TestWithStartTimeout tests that a stream is cancelled with DeadlineExceeded
+// when it does not start within DB_QUERY_TIMEOUT, and runs on once started
+func TestWithStartTimeout(t *testing.T) {
+	viper.Set("DB_QUERY_TIMEOUT", "20ms")
+	defer viper.Set("DB_QUERY_TIMEOUT", nil)
+
+	t.Run("not started", func(t *testing.T) {
+		ctx, _, cancel := withStartTimeout(context.Background())
+		defer cancel()
+
+		<-ctx.Done()
+		if err := startTimeoutErr(ctx, ctx.Err()); err != context.DeadlineExceeded {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+
+	t.Run("started", func(t *testing.T) {
+		ctx, started, cancel := withStartTimeout(context.Background())
+		defer cancel()
+
+		started()
+		time.Sleep(60 * time.Millisecond)
+		if ctx.Err() != nil {
+			t.Errorf("Expected the started stream to run past the timeout, got %v", ctx.Err())
+		}
+	})
+}